@@ -9,7 +9,11 @@ import (
 	"go-fiber-gorm/core/logger"
 	"go-fiber-gorm/core/middleware"
 	"go-fiber-gorm/migrations"
+	"go-fiber-gorm/modules/apikeys"
 	"go-fiber-gorm/modules/auth"
+	"go-fiber-gorm/modules/invitations"
+	"go-fiber-gorm/modules/oauthclients"
+	"go-fiber-gorm/modules/rbac"
 	"go-fiber-gorm/modules/user"
 	"go-fiber-gorm/routes"
 	"os"
@@ -87,6 +91,7 @@ func main() {
 	})
 
 	// Apply global middleware
+	app.Use(middleware.RealIP(cfg.Server.TrustedProxies))
 	app.Use(fiberLogger.New())
 	// app.Use(middleware.Logger())
 	app.Use(middleware.RateLimiter())
@@ -95,6 +100,19 @@ func main() {
 	if err := dbConn.AutoMigrate(
 		&user.User{},
 		&auth.Session{},
+		&auth.PasswordResetToken{},
+		&auth.TOTPFactor{},
+		&auth.RecoveryCode{},
+		&auth.OAuthIdentity{},
+		&auth.WebAuthnCredential{},
+		&auth.AuditLog{},
+		&auth.LoginEvent{},
+		&apikeys.APIKey{},
+		&oauthclients.Client{},
+		&invitations.Invitation{},
+		&rbac.Permission{},
+		&rbac.Role{},
+		&rbac.UserRole{},
 	); err != nil {
 		logger.Fatal("Failed to auto migrate models:", err)
 	}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -14,12 +15,17 @@ type Config struct {
 	Database DatabaseConfig
 	JWT      JWTConfig
 	Redis    RedisConfig
+	Auth     AuthConfig
+	Mail     MailConfig
 }
 
 // ServerConfig stores server related configuration
 type ServerConfig struct {
-	Port string
-	Env  string
+	Port           string
+	Env            string
+	FrontendURL    string
+	TrustedProxies []string // IPs or CIDR ranges allowed to set X-Forwarded-For
+	CORSOrigins    []string // Origins allowed to make credentialed requests; any origin without credentials when empty
 }
 
 // DatabaseConfig stores database configuration
@@ -34,9 +40,67 @@ type DatabaseConfig struct {
 
 // JWTConfig stores JWT configuration
 type JWTConfig struct {
-	Secret          string
-	AccessExpiryIn  uint
-	RefreshExpiryIn uint
+	Secret               string
+	AccessExpiryIn       uint
+	RefreshExpiryIn      uint
+	SigningKeyFile       string   // PEM private key for access tokens; HS256 with Secret when empty
+	VerificationKeyFiles []string // Additional PEM keys still accepted, e.g. the previous signing key
+}
+
+// AuthConfig stores authentication flow configuration
+type AuthConfig struct {
+	PasswordResetExpiryIn     uint
+	EmailVerificationExpiryIn uint
+	RequireEmailVerification  bool
+	MagicLinkExpiryIn         uint   // Seconds a passwordless sign-in link stays valid
+	ImpersonationExpiryIn     uint   // Seconds an admin impersonation token stays valid
+	ClientTokenExpiryIn       uint   // Seconds an OAuth client access token stays valid
+	TokenAudience             string // Audience of client tokens for this API; when empty, only tokens without an audience are accepted
+	RegistrationMode          string // open, invite or disabled
+	InvitationExpiryIn        uint   // Seconds an invitation link stays valid
+	ReauthMaxAgeIn            uint   // Seconds a login counts as recent for sensitive operations
+	LoginHistoryRetentionDays uint   // Days login events are kept before they are pruned
+	NotifyNewDevices          bool   // Email users when they log in from a new device
+	MFAIssuer                 string
+	LoginMaxAttempts          int  // Failed logins per email before the account is locked
+	LoginIPMaxAttempts        int  // Failed logins per IP before the IP is locked
+	LoginLockoutDurationIn    uint // Seconds an account or IP stays locked
+	Argon2Memory              uint // KiB of memory used to hash a password
+	Argon2Iterations          uint
+	Argon2Parallelism         uint
+	PasswordMinLength         int
+	PasswordMinClasses        int    // Character classes a password must mix; zero disables the rule
+	PasswordMinScore          int    // Minimum strength score from 1 to 4
+	BreachedPasswordsFile     string // Breached password list; the bundled list is used when empty
+	TokenTransport            string // header or cookie; clients may override it with X-Auth-Transport
+	CookieDomain              string
+	CookieSecure              bool
+	CookieSameSite            string // Lax, Strict or None
+	OAuthProviders            []OAuthProviderConfig
+	WebAuthnRPID              string   // Domain passkeys are scoped to; defaults to the frontend host
+	WebAuthnRPName            string   // Name shown by authenticators
+	WebAuthnOrigins           []string // Origins allowed to use passkeys; defaults to the frontend URL
+}
+
+// OAuthProviderConfig stores the settings of an OpenID Connect provider
+type OAuthProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// MailConfig stores outgoing mail configuration
+type MailConfig struct {
+	Driver       string // log, smtp, file or memory
+	From         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	FileDir      string
 }
 
 // RedisConfig stores Redis configuration
@@ -78,10 +142,152 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	passwordResetExpiryIn, err := parseEnvUint("AUTH_PASSWORD_RESET_EXPIRY", 3600) // 1 hour
+	if err != nil {
+		return nil, err
+	}
+
+	emailVerificationExpiryIn, err := parseEnvUint("AUTH_EMAIL_VERIFICATION_EXPIRY", 86400) // 24 hours
+	if err != nil {
+		return nil, err
+	}
+
+	requireEmailVerification, err := parseEnvBool("AUTH_REQUIRE_EMAIL_VERIFICATION", false)
+	if err != nil {
+		return nil, err
+	}
+
+	magicLinkExpiryIn, err := parseEnvUint("AUTH_MAGIC_LINK_EXPIRY", 900) // 15 minutes
+	if err != nil {
+		return nil, err
+	}
+
+	impersonationExpiryIn, err := parseEnvUint("AUTH_IMPERSONATION_EXPIRY", 900) // 15 minutes
+	if err != nil {
+		return nil, err
+	}
+
+	clientTokenExpiryIn, err := parseEnvUint("AUTH_CLIENT_TOKEN_EXPIRY", 900) // 15 minutes
+	if err != nil {
+		return nil, err
+	}
+
+	invitationExpiryIn, err := parseEnvUint("AUTH_INVITATION_EXPIRY", 604800) // 7 days
+	if err != nil {
+		return nil, err
+	}
+
+	reauthMaxAgeIn, err := parseEnvUint("AUTH_REAUTH_MAX_AGE", 300) // 5 minutes
+	if err != nil {
+		return nil, err
+	}
+
+	loginHistoryRetentionDays, err := parseEnvUint("AUTH_LOGIN_HISTORY_RETENTION_DAYS", 90)
+	if err != nil {
+		return nil, err
+	}
+
+	notifyNewDevices, err := parseEnvBool("AUTH_NOTIFY_NEW_DEVICES", true)
+	if err != nil {
+		return nil, err
+	}
+
+	loginMaxAttempts, err := parseEnvInt("AUTH_LOGIN_MAX_ATTEMPTS", 10)
+	if err != nil {
+		return nil, err
+	}
+
+	loginIPMaxAttempts, err := parseEnvInt("AUTH_LOGIN_IP_MAX_ATTEMPTS", 50)
+	if err != nil {
+		return nil, err
+	}
+
+	loginLockoutDurationIn, err := parseEnvUint("AUTH_LOGIN_LOCKOUT_DURATION", 900) // 15 minutes
+	if err != nil {
+		return nil, err
+	}
+
+	argon2Memory, err := parseEnvUint("AUTH_ARGON2_MEMORY", 19456) // 19 MiB
+	if err != nil {
+		return nil, err
+	}
+
+	argon2Iterations, err := parseEnvUint("AUTH_ARGON2_ITERATIONS", 2)
+	if err != nil {
+		return nil, err
+	}
+
+	argon2Parallelism, err := parseEnvUint("AUTH_ARGON2_PARALLELISM", 1)
+	if err != nil {
+		return nil, err
+	}
+	if argon2Parallelism > 255 {
+		return nil, fmt.Errorf("invalid AUTH_ARGON2_PARALLELISM: must be at most 255")
+	}
+
+	passwordMinLength, err := parseEnvInt("AUTH_PASSWORD_MIN_LENGTH", 8)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordMinClasses, err := parseEnvInt("AUTH_PASSWORD_MIN_CLASSES", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordMinScore, err := parseEnvInt("AUTH_PASSWORD_MIN_SCORE", 2)
+	if err != nil {
+		return nil, err
+	}
+	if passwordMinScore < 1 || passwordMinScore > 4 {
+		return nil, fmt.Errorf("invalid AUTH_PASSWORD_MIN_SCORE: must be between 1 and 4")
+	}
+
+	tokenTransport := strings.ToLower(getEnv("AUTH_TOKEN_TRANSPORT", "header"))
+	if tokenTransport != "header" && tokenTransport != "cookie" {
+		return nil, fmt.Errorf("invalid AUTH_TOKEN_TRANSPORT: must be header or cookie")
+	}
+
+	registrationMode := strings.ToLower(getEnv("AUTH_REGISTRATION_MODE", "open"))
+	if registrationMode != "open" && registrationMode != "invite" && registrationMode != "disabled" {
+		return nil, fmt.Errorf("invalid AUTH_REGISTRATION_MODE: must be open, invite or disabled")
+	}
+
+	cookieSecure, err := parseEnvBool("AUTH_COOKIE_SECURE", true)
+	if err != nil {
+		return nil, err
+	}
+
+	cookieSameSite := getEnv("AUTH_COOKIE_SAMESITE", "Lax")
+	switch strings.ToLower(cookieSameSite) {
+	case "lax", "strict":
+	case "none":
+		if !cookieSecure {
+			return nil, fmt.Errorf("invalid AUTH_COOKIE_SAMESITE: None requires AUTH_COOKIE_SECURE")
+		}
+	default:
+		return nil, fmt.Errorf("invalid AUTH_COOKIE_SAMESITE: must be Lax, Strict or None")
+	}
+
+	smtpPort, err := parseEnvInt("SMTP_PORT", 587)
+	if err != nil {
+		return nil, err
+	}
+
+	frontendURL := getEnv("FRONTEND_URL", "http://localhost:3000")
+
+	oauthProviders, err := loadOAuthProviders(frontendURL)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
 		Server: ServerConfig{
-			Port: getEnv("SERVER_PORT", "8080"),
-			Env:  getEnv("ENV", "development"),
+			Port:           getEnv("SERVER_PORT", "8080"),
+			Env:            getEnv("ENV", "development"),
+			FrontendURL:    frontendURL,
+			TrustedProxies: getEnvList("SERVER_TRUSTED_PROXIES", nil),
+			CORSOrigins:    getEnvList("SERVER_CORS_ORIGINS", nil),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -92,9 +298,11 @@ func LoadConfig() (*Config, error) {
 			SSLMode:  getEnv("DB_SSL_MODE", "disable"),
 		},
 		JWT: JWTConfig{
-			Secret:          getEnv("JWT_SECRET", "your_secret_key"),
-			AccessExpiryIn:  uint(accessExpiryIn),
-			RefreshExpiryIn: uint(refreshExpiryIn),
+			Secret:               getEnv("JWT_SECRET", "your_secret_key"),
+			AccessExpiryIn:       uint(accessExpiryIn),
+			RefreshExpiryIn:      uint(refreshExpiryIn),
+			SigningKeyFile:       getEnv("JWT_SIGNING_KEY_FILE", ""),
+			VerificationKeyFiles: getEnvList("JWT_VERIFICATION_KEY_FILES", nil),
 		},
 		Redis: RedisConfig{
 			Host:     getEnv("REDIS_HOST", "localhost"),
@@ -102,9 +310,78 @@ func LoadConfig() (*Config, error) {
 			Password: getEnv("REDIS_PASSWORD", ""),
 			DB:       redisDB,
 		},
+		Auth: AuthConfig{
+			PasswordResetExpiryIn:     passwordResetExpiryIn,
+			EmailVerificationExpiryIn: emailVerificationExpiryIn,
+			RequireEmailVerification:  requireEmailVerification,
+			MagicLinkExpiryIn:         magicLinkExpiryIn,
+			ImpersonationExpiryIn:     impersonationExpiryIn,
+			ClientTokenExpiryIn:       clientTokenExpiryIn,
+			TokenAudience:             getEnv("AUTH_TOKEN_AUDIENCE", ""),
+			RegistrationMode:          registrationMode,
+			InvitationExpiryIn:        invitationExpiryIn,
+			ReauthMaxAgeIn:            reauthMaxAgeIn,
+			LoginHistoryRetentionDays: loginHistoryRetentionDays,
+			NotifyNewDevices:          notifyNewDevices,
+			MFAIssuer:                 getEnv("AUTH_MFA_ISSUER", "fiber-gorm-api"),
+			LoginMaxAttempts:          loginMaxAttempts,
+			LoginIPMaxAttempts:        loginIPMaxAttempts,
+			LoginLockoutDurationIn:    uint(loginLockoutDurationIn),
+			Argon2Memory:              argon2Memory,
+			Argon2Iterations:          argon2Iterations,
+			Argon2Parallelism:         argon2Parallelism,
+			PasswordMinLength:         passwordMinLength,
+			PasswordMinClasses:        passwordMinClasses,
+			PasswordMinScore:          passwordMinScore,
+			BreachedPasswordsFile:     getEnv("AUTH_BREACHED_PASSWORDS_FILE", ""),
+			TokenTransport:            tokenTransport,
+			CookieDomain:              getEnv("AUTH_COOKIE_DOMAIN", ""),
+			CookieSecure:              cookieSecure,
+			CookieSameSite:            cookieSameSite,
+			OAuthProviders:            oauthProviders,
+			WebAuthnRPID:              getEnv("WEBAUTHN_RP_ID", ""),
+			WebAuthnRPName:            getEnv("WEBAUTHN_RP_NAME", ""),
+			WebAuthnOrigins:           getEnvList("WEBAUTHN_ORIGINS", []string{frontendURL}),
+		},
+		Mail: MailConfig{
+			Driver:       getEnv("MAIL_DRIVER", "log"),
+			From:         getEnv("MAIL_FROM", "no-reply@localhost"),
+			SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+			SMTPPort:     smtpPort,
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			FileDir:      getEnv("MAIL_FILE_DIR", "./tmp/mail"),
+		},
 	}, nil
 }
 
+// loadOAuthProviders reads the providers listed in OAUTH_PROVIDERS, each
+// configured with OAUTH_<NAME>_* variables
+func loadOAuthProviders(frontendURL string) ([]OAuthProviderConfig, error) {
+	var providers []OAuthProviderConfig
+	for _, name := range getEnvList("OAUTH_PROVIDERS", nil) {
+		name = strings.ToLower(name)
+		prefix := "OAUTH_" + strings.ToUpper(name) + "_"
+
+		provider := OAuthProviderConfig{
+			Name:         name,
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", ""),
+			Scopes:       getEnvList(prefix+"SCOPES", nil),
+		}
+		if provider.RedirectURL == "" {
+			provider.RedirectURL = frontendURL + "/oauth/" + name + "/callback"
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID are required", prefix, prefix)
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
 // getEnv reads environment variable with a default value
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -113,6 +390,22 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvList reads a comma-separated environment variable with a default value
+func getEnvList(key string, defaultValue []string) []string {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 // parseEnvInt parses an integer environment variable with a default value
 func parseEnvInt(key string, defaultValue int) (int, error) {
 	if value, exists := os.LookupEnv(key); exists {
@@ -137,6 +430,18 @@ func parseEnvUint(key string, defaultValue uint) (uint, error) {
 	return defaultValue, nil
 }
 
+// parseEnvBool parses a boolean environment variable with a default value
+func parseEnvBool(key string, defaultValue bool) (bool, error) {
+	if value, exists := os.LookupEnv(key); exists {
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		return boolValue, nil
+	}
+	return defaultValue, nil
+}
+
 // GetDSN returns the PostgreSQL connection string
 func (c *DatabaseConfig) GetDSN() string {
 	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s",
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"strconv"
+	"time"
+)
+
+// AttemptStore counts failed attempts per key (e.g. an email or IP address)
+// within a window and holds temporary locks on keys.
+type AttemptStore struct {
+	store Store
+}
+
+// NewAttemptStore creates a new attempt store
+func NewAttemptStore(store Store) *AttemptStore {
+	return &AttemptStore{
+		store: store,
+	}
+}
+
+// RecordFailure counts a failed attempt and returns the number of failures
+// in the current window. The window starts with the first failure.
+func (a *AttemptStore) RecordFailure(key string, window time.Duration) (int64, error) {
+	return a.store.Increment(attemptsKey(key), window)
+}
+
+// Lock locks a key for the given duration
+func (a *AttemptStore) Lock(key string, duration time.Duration) error {
+	until := time.Now().Add(duration)
+	return a.store.Set(lockKey(key), strconv.FormatInt(until.UnixMilli(), 10), duration)
+}
+
+// LockedFor returns how long a key remains locked
+func (a *AttemptStore) LockedFor(key string) (time.Duration, bool) {
+	value, ok := a.store.Get(lockKey(key))
+	if !ok {
+		return 0, false
+	}
+
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	remaining := time.Until(time.UnixMilli(millis))
+	if remaining <= 0 {
+		return 0, false
+	}
+	return remaining, true
+}
+
+// Reset clears the failure count and any lock of a key
+func (a *AttemptStore) Reset(key string) error {
+	return a.store.Delete(attemptsKey(key), lockKey(key))
+}
+
+func attemptsKey(key string) string {
+	return "attempts:" + key
+}
+
+func lockKey(key string) string {
+	return "lockout:" + key
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// RevocationStore tracks revoked access tokens until they would have expired
+// anyway, so entries never outlive the tokens they describe.
+type RevocationStore struct {
+	store Store
+}
+
+// NewRevocationStore creates a new revocation store
+func NewRevocationStore(store Store) *RevocationStore {
+	return &RevocationStore{
+		store: store,
+	}
+}
+
+// RevokeToken revokes a single token by its ID (the JWT "uuid" claim)
+func (r *RevocationStore) RevokeToken(tokenID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return r.store.Set(tokenKey(tokenID), "1", ttl)
+}
+
+// IsTokenRevoked reports whether a token has been revoked
+func (r *RevocationStore) IsTokenRevoked(tokenID string) bool {
+	_, revoked := r.store.Get(tokenKey(tokenID))
+	return revoked
+}
+
+// RevokeSession revokes all access tokens issued for a session
+func (r *RevocationStore) RevokeSession(sessionID uint, ttl time.Duration) error {
+	return r.store.Set(sessionKey(sessionID), "1", ttl)
+}
+
+// IsSessionRevoked reports whether the tokens of a session have been revoked
+func (r *RevocationStore) IsSessionRevoked(sessionID uint) bool {
+	_, revoked := r.store.Get(sessionKey(sessionID))
+	return revoked
+}
+
+// RevokeUserTokens revokes every token of a user issued before now. The
+// time is kept to the millisecond, so tokens issued right after the
+// revocation stay valid. ttl should be the longest lifetime of any token the
+// user can hold, after which older tokens are expired.
+func (r *RevocationStore) RevokeUserTokens(userID uint, ttl time.Duration) error {
+	return r.store.Set(userKey(userID), strconv.FormatInt(time.Now().UnixMilli(), 10), ttl)
+}
+
+// UserTokensValidAfter returns the time before which the user's tokens are revoked
+func (r *RevocationStore) UserTokensValidAfter(userID uint) (time.Time, bool) {
+	value, ok := r.store.Get(userKey(userID))
+	if !ok {
+		return time.Time{}, false
+	}
+
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(millis), true
+}
+
+func tokenKey(tokenID string) string {
+	return "revoked:token:" + tokenID
+}
+
+func sessionKey(sessionID uint) string {
+	return fmt.Sprintf("revoked:session:%d", sessionID)
+}
+
+func userKey(userID uint) string {
+	return fmt.Sprintf("revoked:user:%d", userID)
+}
@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"context"
+	"go-fiber-gorm/core/logger"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store is a minimal key-value store with per-key expiry
+type Store interface {
+	Get(key string) (string, bool)
+	Set(key, value string, ttl time.Duration) error
+	Delete(keys ...string) error
+	// Increment atomically adds one to a counter and returns the new value.
+	// The TTL is only applied when the counter is created.
+	Increment(key string, ttl time.Duration) (int64, error)
+}
+
+// NewStore returns a Redis-backed store, or an in-memory store when no
+// Redis client is available
+func NewStore(client *redis.Client) Store {
+	if client == nil {
+		logger.Warn("Redis not available, using in-memory store")
+		return NewMemoryStore()
+	}
+	return NewRedisStore(client)
+}
+
+// RedisStore is a Store backed by Redis
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a new Redis store
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{
+		client: client,
+	}
+}
+
+// Get retrieves a value by key
+func (s *RedisStore) Get(key string) (string, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	value, err := s.client.Get(ctx, key).Result()
+	if err != nil {
+		if err != redis.Nil {
+			logger.Error("Failed to read from Redis:", err)
+		}
+		return "", false
+	}
+	return value, true
+}
+
+// Set stores a value with a TTL
+func (s *RedisStore) Set(key, value string, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+// Delete removes values by key
+func (s *RedisStore) Delete(keys ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return s.client.Del(ctx, keys...).Err()
+}
+
+// incrementScript increments a counter and sets its TTL in one step, so a
+// counter can never be left without an expiry. Counters that have none, e.g.
+// from an interrupted increment, get the TTL as well.
+var incrementScript = redis.NewScript(`
+local value = redis.call("INCR", KEYS[1])
+local ttl = tonumber(ARGV[1])
+if ttl > 0 and (value == 1 or redis.call("PTTL", KEYS[1]) == -1) then
+	redis.call("PEXPIRE", KEYS[1], ttl)
+end
+return value
+`)
+
+// Increment atomically increments a counter, setting the TTL when it is created
+func (s *RedisStore) Increment(key string, ttl time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return incrementScript.Run(ctx, s.client, []string{key}, ttl.Milliseconds()).Int64()
+}
+
+// memoryItem is a value held by MemoryStore
+type memoryItem struct {
+	value     string
+	expiresAt time.Time
+}
+
+// expired reports whether the item has expired
+func (i memoryItem) expired(now time.Time) bool {
+	return !i.expiresAt.IsZero() && now.After(i.expiresAt)
+}
+
+// MemoryStore is an in-process Store. Data is not shared between instances
+// and is lost on restart, so it is only a fallback for single-node setups.
+type MemoryStore struct {
+	mu    sync.Mutex
+	items map[string]memoryItem
+}
+
+// NewMemoryStore creates a new in-memory store and starts its cleanup loop
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		items: make(map[string]memoryItem),
+	}
+	go s.cleanup(time.Minute)
+	return s
+}
+
+// Get retrieves a value by key
+func (s *MemoryStore) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[key]
+	if !ok {
+		return "", false
+	}
+	if item.expired(time.Now()) {
+		delete(s.items, key)
+		return "", false
+	}
+	return item.value, true
+}
+
+// Set stores a value with a TTL. A TTL of zero means no expiry.
+func (s *MemoryStore) Set(key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item := memoryItem{value: value}
+	if ttl > 0 {
+		item.expiresAt = time.Now().Add(ttl)
+	}
+	s.items[key] = item
+	return nil
+}
+
+// Delete removes values by key
+func (s *MemoryStore) Delete(keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.items, key)
+	}
+	return nil
+}
+
+// Increment atomically increments a counter, setting the TTL when it is created
+func (s *MemoryStore) Increment(key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[key]
+	if !ok || item.expired(time.Now()) {
+		item = memoryItem{}
+		if ttl > 0 {
+			item.expiresAt = time.Now().Add(ttl)
+		}
+	}
+
+	value, _ := strconv.ParseInt(item.value, 10, 64)
+	value++
+	item.value = strconv.FormatInt(value, 10)
+	s.items[key] = item
+	return value, nil
+}
+
+// cleanup periodically removes expired items
+func (s *MemoryStore) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		s.mu.Lock()
+		for key, item := range s.items {
+			if item.expired(now) {
+				delete(s.items, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
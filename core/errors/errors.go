@@ -4,7 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"go-fiber-gorm/core/logger"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
@@ -12,10 +15,11 @@ import (
 
 // AppError represents an application error
 type AppError struct {
-	StatusCode int         `json:"-"`
-	Code       string      `json:"code"`
-	Message    string      `json:"message"`
-	Details    interface{} `json:"details,omitempty"`
+	StatusCode int           `json:"-"`
+	Code       string        `json:"code"`
+	Message    string        `json:"message"`
+	Details    interface{}   `json:"details,omitempty"`
+	RetryAfter time.Duration `json:"-"` // Sent as the Retry-After header when set
 }
 
 // Error returns the error message
@@ -44,6 +48,10 @@ func ErrorHandler(ctx *fiber.Ctx, err error) error {
 			details["error_details"] = appError.Details
 		}
 
+		if appError.RetryAfter > 0 {
+			ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(appError.RetryAfter.Seconds()))))
+		}
+
 		// Only log server errors
 		if statusCode >= 500 {
 			logger.Error(fmt.Sprintf("[%s] %s", code, message))
@@ -79,6 +87,19 @@ func ErrorHandler(ctx *fiber.Ctx, err error) error {
 	})
 }
 
+// StatusCode returns the status code ErrorHandler responds with for an error
+func StatusCode(err error) int {
+	var appError *AppError
+	if errors.As(err, &appError) {
+		return appError.StatusCode
+	}
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		return fiber.StatusBadRequest
+	}
+	return fiber.StatusInternalServerError
+}
+
 // New creates a new AppError
 func New(statusCode int, code string, message string) *AppError {
 	return &AppError{
@@ -94,6 +115,12 @@ func (e *AppError) WithDetails(details interface{}) *AppError {
 	return e
 }
 
+// WithRetryAfter tells the client when it may retry
+func (e *AppError) WithRetryAfter(d time.Duration) *AppError {
+	e.RetryAfter = d
+	return e
+}
+
 // Common error constructors
 func NewBadRequestError(message string) *AppError {
 	return New(http.StatusBadRequest, "BAD_REQUEST", message)
@@ -71,3 +71,9 @@ func WithField(key string, value interface{}) *logrus.Entry {
 func WithFields(fields logrus.Fields) *logrus.Entry {
 	return Logger.WithFields(fields)
 }
+
+// SecurityEvent logs a security-relevant event as a warning. The event name
+// is added as the "security_event" field so these entries are easy to alert on.
+func SecurityEvent(event string, fields logrus.Fields) {
+	Logger.WithFields(fields).WithField("security_event", event).Warn("Security event: ", event)
+}
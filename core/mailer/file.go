@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// FileMailer writes each message to a .eml file in a directory.
+// It is useful for local development and end-to-end tests.
+type FileMailer struct {
+	dir   string
+	from  string
+	count atomic.Uint64
+}
+
+// NewFileMailer creates a new file mailer, creating the directory if needed
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+
+	return &FileMailer{
+		dir:  dir,
+		from: from,
+	}, nil
+}
+
+// Send writes the message to a new file
+func (m *FileMailer) Send(msg *Message) error {
+	name := fmt.Sprintf("%d-%d-%s.eml", time.Now().UnixNano(), m.count.Add(1), sanitizeFileName(msg.To))
+	if err := os.WriteFile(filepath.Join(m.dir, name), buildMIME(m.from, msg), 0600); err != nil {
+		return fmt.Errorf("failed to write mail file: %w", err)
+	}
+	return nil
+}
+
+// sanitizeFileName replaces characters that are unsafe in file names
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
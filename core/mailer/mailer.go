@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"fmt"
+	"go-fiber-gorm/config"
+	"go-fiber-gorm/core/logger"
+)
+
+// Supported mail drivers
+const (
+	DriverLog    = "log"
+	DriverSMTP   = "smtp"
+	DriverFile   = "file"
+	DriverMemory = "memory"
+)
+
+// Message represents an outgoing email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is implemented by every email transport
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// LogMailer only logs that a message was sent. The body is never logged
+// because it usually carries single-use tokens.
+type LogMailer struct{}
+
+// NewLogMailer creates a new log mailer
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+// Send logs the recipient and subject of the message
+func (m *LogMailer) Send(msg *Message) error {
+	logger.Info("Mail sent to", msg.To, "-", msg.Subject)
+	return nil
+}
+
+// New creates a mailer for the configured driver
+func New(cfg *config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "", DriverLog:
+		return NewLogMailer(), nil
+	case DriverSMTP:
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From), nil
+	case DriverFile:
+		return NewFileMailer(cfg.FileDir, cfg.From)
+	case DriverMemory:
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver: %s", cfg.Driver)
+	}
+}
@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"errors"
+	"go-fiber-gorm/core/logger"
+)
+
+// ErrQueueFull is returned when a queued mailer cannot take more messages
+var ErrQueueFull = errors.New("mail queue is full")
+
+// QueueMailer hands messages to a background sender so that callers do not
+// wait for the transport. Delivery errors are only logged.
+type QueueMailer struct {
+	next  Mailer
+	queue chan *Message
+}
+
+// NewQueueMailer creates a queue of the given size in front of a mailer and
+// starts its sender
+func NewQueueMailer(next Mailer, size int) *QueueMailer {
+	if size <= 0 {
+		size = 100
+	}
+
+	m := &QueueMailer{
+		next:  next,
+		queue: make(chan *Message, size),
+	}
+	go m.run()
+	return m
+}
+
+// Send queues the message. Messages are dropped rather than blocking the
+// caller when the queue is full.
+func (m *QueueMailer) Send(msg *Message) error {
+	select {
+	case m.queue <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// run delivers queued messages one at a time
+func (m *QueueMailer) run() {
+	for msg := range m.queue {
+		if err := m.next.Send(msg); err != nil {
+			logger.Error("Failed to send queued mail:", err)
+		}
+	}
+}
@@ -21,7 +21,7 @@ func Logger() fiber.Handler {
 		// Log after the request is done
 		latency := time.Since(start)
 		statusCode := c.Response().StatusCode()
-		ip := c.IP()
+		ip := ClientIP(c)
 
 		// Color codes for terminal output
 		methodColor := "\033[36m" // Cyan for method
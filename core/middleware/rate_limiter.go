@@ -14,7 +14,7 @@ func RateLimiter() fiber.Handler {
 		Max:        100,             // Max number of requests within duration
 		Expiration: 1 * time.Minute, // Duration for max requests
 		KeyGenerator: func(c *fiber.Ctx) string {
-			return c.IP() // Use IP as the rate limit key
+			return ClientIP(c) // Use IP as the rate limit key
 		},
 		LimitReached: func(c *fiber.Ctx) error {
 			return errors.NewTooManyRequestsError("Rate limit exceeded. Please try again later.")
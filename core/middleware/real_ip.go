@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"go-fiber-gorm/core/logger"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RealIP returns a middleware that resolves the client IP behind trusted proxies.
+//
+// X-Forwarded-For is only honoured when the direct peer is a trusted proxy.
+// The header is then walked from right to left and the first address that is
+// not a trusted proxy is used, so clients cannot spoof their IP by sending
+// their own X-Forwarded-For header. Entries may be IPs or CIDR ranges.
+func RealIP(trustedProxies []string) fiber.Handler {
+	var trusted []*net.IPNet
+	for _, entry := range trustedProxies {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			if strings.Contains(entry, ":") {
+				entry += "/128"
+			} else {
+				entry += "/32"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			logger.Warn("Ignoring invalid trusted proxy:", entry)
+			continue
+		}
+		trusted = append(trusted, ipNet)
+	}
+
+	isTrusted := func(ip net.IP) bool {
+		for _, ipNet := range trusted {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(c *fiber.Ctx) error {
+		remoteIP := c.Context().RemoteIP()
+		clientIP := remoteIP.String()
+
+		if len(trusted) > 0 && isTrusted(remoteIP) {
+			hops := strings.Split(c.Get(fiber.HeaderXForwardedFor), ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				ip := net.ParseIP(strings.TrimSpace(hops[i]))
+				if ip == nil {
+					break
+				}
+				clientIP = ip.String()
+				if !isTrusted(ip) {
+					break
+				}
+			}
+		}
+
+		c.Locals("clientIP", clientIP)
+		return c.Next()
+	}
+}
+
+// ClientIP returns the client IP resolved by RealIP, falling back to the peer address
+func ClientIP(c *fiber.Ctx) string {
+	if ip, ok := c.Locals("clientIP").(string); ok && ip != "" {
+		return ip
+	}
+	return c.IP()
+}
@@ -2,7 +2,11 @@ package migrations
 
 import (
 	"go-fiber-gorm/core/logger"
+	"go-fiber-gorm/modules/apikeys"
 	"go-fiber-gorm/modules/auth"
+	"go-fiber-gorm/modules/invitations"
+	"go-fiber-gorm/modules/oauthclients"
+	"go-fiber-gorm/modules/rbac"
 	"go-fiber-gorm/modules/user"
 
 	"gorm.io/gorm"
@@ -35,6 +39,231 @@ var Migrations = []Migration{
 			return db.Migrator().DropTable(&auth.Session{})
 		},
 	},
+	{
+		Name: "create_password_reset_tokens_table",
+		Migrate: func(db *gorm.DB) error {
+			return db.AutoMigrate(&auth.PasswordResetToken{})
+		},
+		Rollback: func(db *gorm.DB) error {
+			return db.Migrator().DropTable(&auth.PasswordResetToken{})
+		},
+	},
+	{
+		Name: "add_users_email_verified_at",
+		Migrate: func(db *gorm.DB) error {
+			return addColumns(db, &user.User{}, "EmailVerifiedAt")
+		},
+		Rollback: func(db *gorm.DB) error {
+			return db.Migrator().DropColumn(&user.User{}, "EmailVerifiedAt")
+		},
+	},
+	{
+		Name: "create_mfa_tables",
+		Migrate: func(db *gorm.DB) error {
+			return db.AutoMigrate(&auth.TOTPFactor{}, &auth.RecoveryCode{})
+		},
+		Rollback: func(db *gorm.DB) error {
+			return db.Migrator().DropTable(&auth.TOTPFactor{}, &auth.RecoveryCode{})
+		},
+	},
+	{
+		Name: "add_sessions_device_name",
+		Migrate: func(db *gorm.DB) error {
+			return addColumns(db, &auth.Session{}, "DeviceName")
+		},
+		Rollback: func(db *gorm.DB) error {
+			return db.Migrator().DropColumn(&auth.Session{}, "DeviceName")
+		},
+	},
+	{
+		Name: "add_sessions_token_family",
+		Migrate: func(db *gorm.DB) error {
+			if err := addColumns(db, &auth.Session{}, "FamilyID", "ReplacedByID"); err != nil {
+				return err
+			}
+			if err := createIndexes(db, &auth.Session{}, "FamilyID"); err != nil {
+				return err
+			}
+			// Existing sessions each become a family of their own
+			return db.Model(&auth.Session{}).
+				Where("family_id IS NULL OR family_id = ''").
+				Update("family_id", gorm.Expr("'legacy-' || id")).Error
+		},
+		Rollback: func(db *gorm.DB) error {
+			if err := db.Migrator().DropColumn(&auth.Session{}, "ReplacedByID"); err != nil {
+				return err
+			}
+			return db.Migrator().DropColumn(&auth.Session{}, "FamilyID")
+		},
+	},
+	{
+		Name: "hash_sessions_refresh_token",
+		Migrate: func(db *gorm.DB) error {
+			// Fresh databases already get the hashed column from create_sessions_table
+			if db.Migrator().HasColumn(&auth.Session{}, "refresh_token") {
+				table, err := tableName(db, &auth.Session{})
+				if err != nil {
+					return err
+				}
+
+				// Replace every stored token by its hex-encoded SHA-256 digest,
+				// which matches what the application computes on lookup. The
+				// column is added as nullable and only made NOT NULL and unique
+				// once every row is filled.
+				if err := db.Exec("ALTER TABLE " + table + " ADD COLUMN IF NOT EXISTS refresh_token_hash varchar(64)").Error; err != nil {
+					return err
+				}
+				if err := db.Exec("UPDATE " + table + " SET refresh_token_hash = encode(sha256(convert_to(refresh_token, 'UTF8')), 'hex')").Error; err != nil {
+					return err
+				}
+				if err := db.Migrator().DropColumn(&auth.Session{}, "refresh_token"); err != nil {
+					return err
+				}
+				if err := db.Exec("ALTER TABLE " + table + " ALTER COLUMN refresh_token_hash SET NOT NULL").Error; err != nil {
+					return err
+				}
+			}
+			return createIndexes(db, &auth.Session{}, "RefreshTokenHash")
+		},
+		Rollback: func(db *gorm.DB) error {
+			// Plaintext tokens cannot be recovered, so existing sessions are
+			// blocked and their users have to log in again
+			if err := db.Model(&auth.Session{}).Where("is_blocked = ?", false).Update("is_blocked", true).Error; err != nil {
+				return err
+			}
+			return db.Migrator().RenameColumn(&auth.Session{}, "refresh_token_hash", "refresh_token")
+		},
+	},
+	{
+		Name: "create_api_keys_table",
+		Migrate: func(db *gorm.DB) error {
+			return db.AutoMigrate(&apikeys.APIKey{})
+		},
+		Rollback: func(db *gorm.DB) error {
+			return db.Migrator().DropTable(&apikeys.APIKey{})
+		},
+	},
+	{
+		Name: "create_rbac_tables",
+		Migrate: func(db *gorm.DB) error {
+			if err := db.AutoMigrate(&rbac.Permission{}, &rbac.Role{}, &rbac.UserRole{}); err != nil {
+				return err
+			}
+			return rbac.Seed(db)
+		},
+		Rollback: func(db *gorm.DB) error {
+			return db.Migrator().DropTable(&rbac.UserRole{}, "role_permissions", &rbac.Role{}, &rbac.Permission{})
+		},
+	},
+	{
+		Name: "create_oauth_identities_table",
+		Migrate: func(db *gorm.DB) error {
+			return db.AutoMigrate(&auth.OAuthIdentity{})
+		},
+		Rollback: func(db *gorm.DB) error {
+			return db.Migrator().DropTable(&auth.OAuthIdentity{})
+		},
+	},
+	{
+		Name: "create_webauthn_credentials_table",
+		Migrate: func(db *gorm.DB) error {
+			return db.AutoMigrate(&auth.WebAuthnCredential{})
+		},
+		Rollback: func(db *gorm.DB) error {
+			return db.Migrator().DropTable(&auth.WebAuthnCredential{})
+		},
+	},
+	{
+		Name: "widen_users_password",
+		Migrate: func(db *gorm.DB) error {
+			// argon2id hashes with custom parameters can exceed 100 characters
+			return db.Migrator().AlterColumn(&user.User{}, "Password")
+		},
+		Rollback: func(db *gorm.DB) error {
+			return nil // Shrinking the column could truncate hashes
+		},
+	},
+	{
+		Name: "create_audit_logs_table",
+		Migrate: func(db *gorm.DB) error {
+			if err := db.AutoMigrate(&auth.AuditLog{}); err != nil {
+				return err
+			}
+			// Adds the users:impersonate permission and grants it to admins
+			return rbac.Seed(db)
+		},
+		Rollback: func(db *gorm.DB) error {
+			return db.Migrator().DropTable(&auth.AuditLog{})
+		},
+	},
+	{
+		Name: "create_oauth_clients_table",
+		Migrate: func(db *gorm.DB) error {
+			if err := db.AutoMigrate(&oauthclients.Client{}); err != nil {
+				return err
+			}
+			// Adds the clients:manage permission and grants it to admins
+			return rbac.Seed(db)
+		},
+		Rollback: func(db *gorm.DB) error {
+			return db.Migrator().DropTable(&oauthclients.Client{})
+		},
+	},
+	{
+		Name: "create_invitations_table",
+		Migrate: func(db *gorm.DB) error {
+			if err := db.AutoMigrate(&invitations.Invitation{}); err != nil {
+				return err
+			}
+			// Adds the users:invite permission and grants it to admins
+			return rbac.Seed(db)
+		},
+		Rollback: func(db *gorm.DB) error {
+			return db.Migrator().DropTable(&invitations.Invitation{})
+		},
+	},
+	{
+		Name: "add_sessions_authenticated_at",
+		Migrate: func(db *gorm.DB) error {
+			// Left empty for existing sessions: their login time is unknown,
+			// so sensitive operations ask those users to re-authenticate
+			return addColumns(db, &auth.Session{}, "AuthenticatedAt")
+		},
+		Rollback: func(db *gorm.DB) error {
+			return db.Migrator().DropColumn(&auth.Session{}, "AuthenticatedAt")
+		},
+	},
+	{
+		Name: "create_login_events_table",
+		Migrate: func(db *gorm.DB) error {
+			return db.AutoMigrate(&auth.LoginEvent{})
+		},
+		Rollback: func(db *gorm.DB) error {
+			return db.Migrator().DropTable(&auth.LoginEvent{})
+		},
+	},
+	{
+		Name: "hash_plaintext_user_passwords",
+		Migrate: func(db *gorm.DB) error {
+			// Users created before passwords were hashed have them stored in
+			// plaintext, which neither logs in nor saves anymore. Hashes use
+			// the default parameters and are upgraded on the next login.
+			return hashPlaintextPasswords(db, user.NewPasswordHasher(user.Argon2Params{}))
+		},
+		Rollback: func(db *gorm.DB) error {
+			return nil // Hashed passwords cannot be turned back into plaintext
+		},
+	},
+	{
+		Name: "widen_users_role",
+		Migrate: func(db *gorm.DB) error {
+			// Invitations store RBAC role names, which can be 50 characters long
+			return db.Migrator().AlterColumn(&user.User{}, "Role")
+		},
+		Rollback: func(db *gorm.DB) error {
+			return nil // Shrinking the column could truncate role names
+		},
+	},
 	// Add more migrations as needed
 }
 
@@ -142,6 +371,77 @@ func RollbackLastMigration(db *gorm.DB) error {
 	return nil
 }
 
+// addColumns adds the columns of the given fields that do not exist yet.
+// Unlike AutoMigrate it leaves the rest of the table alone, so a migration
+// does not pick up columns and constraints that later migrations add.
+func addColumns(db *gorm.DB, model interface{}, fields ...string) error {
+	for _, field := range fields {
+		if db.Migrator().HasColumn(model, field) {
+			continue
+		}
+		if err := db.Migrator().AddColumn(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createIndexes creates the indexes declared on the given fields that do not
+// exist yet
+func createIndexes(db *gorm.DB, model interface{}, fields ...string) error {
+	for _, field := range fields {
+		if db.Migrator().HasIndex(model, field) {
+			continue
+		}
+		if err := db.Migrator().CreateIndex(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashPlaintextPasswords replaces every stored password that is not a hash,
+// including those of deleted users, by its hash
+func hashPlaintextPasswords(db *gorm.DB, hasher *user.PasswordHasher) error {
+	hashed := 0
+	var users []user.User
+	err := db.Unscoped().Select("id", "password").FindInBatches(&users, 100, func(tx *gorm.DB, batch int) error {
+		for _, u := range users {
+			if user.IsPasswordHash(u.Password) {
+				continue
+			}
+
+			hashedPassword, err := hasher.Hash(u.Password)
+			if err != nil {
+				return err
+			}
+			// UpdateColumn skips the BeforeSave hook
+			if err := db.Unscoped().Model(&user.User{}).Where("id = ?", u.ID).UpdateColumn("password", hashedPassword).Error; err != nil {
+				return err
+			}
+			hashed++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	if hashed > 0 {
+		logger.Info("Hashed plaintext passwords:", hashed)
+	}
+	return nil
+}
+
+// tableName returns the quoted table name of a model, including the configured prefix
+func tableName(db *gorm.DB, model interface{}) (string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return "", err
+	}
+	return stmt.Quote(stmt.Schema.Table), nil
+}
+
 // MigrationRecord represents a migration record in the database
 type MigrationRecord struct {
 	ID   uint   `gorm:"primaryKey"`
@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"testing"
+
+	"go-fiber-gorm/core/logger"
+	"go-fiber-gorm/modules/user"
+	"go-fiber-gorm/test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashPlaintextPasswords(t *testing.T) {
+	logger.Setup("testing")
+
+	db := test.NewTestDB(t, &user.User{})
+	hasher := user.NewPasswordHasher(user.Argon2Params{Memory: 64, Iterations: 1})
+
+	hashed, err := hasher.Hash("already-hashed")
+	require.NoError(t, err)
+
+	// Rows written before passwords were hashed bypass the BeforeSave check
+	require.NoError(t, db.Exec(
+		"INSERT INTO users (name, email, password, role) VALUES (?, ?, ?, ?), (?, ?, ?, ?)",
+		"Jane", "jane@example.com", "plaintext-password", "user",
+		"John", "john@example.com", hashed, "user",
+	).Error)
+	require.NoError(t, db.Exec("UPDATE users SET deleted_at = CURRENT_TIMESTAMP WHERE email = ?", "jane@example.com").Error)
+
+	require.NoError(t, hashPlaintextPasswords(db, hasher))
+
+	var users []user.User
+	require.NoError(t, db.Unscoped().Order("id").Find(&users).Error)
+	require.Len(t, users, 2)
+
+	ok, _, err := hasher.Verify("plaintext-password", users[0].Password)
+	require.NoError(t, err)
+	assert.True(t, ok, "plaintext passwords are hashed, also for deleted users")
+
+	assert.Equal(t, hashed, users[1].Password, "hashes are left alone")
+}
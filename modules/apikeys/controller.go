@@ -0,0 +1,129 @@
+package apikeys
+
+import (
+	"go-fiber-gorm/core/errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Controller handles HTTP requests related to API keys
+type Controller struct {
+	service *Service
+}
+
+// NewController creates a new API key controller
+func NewController(service *Service) *Controller {
+	return &Controller{
+		service: service,
+	}
+}
+
+// RegisterRoutes registers the routes for the API key module. The given
+// middleware must authenticate the user; API keys themselves should not be
+// able to mint new keys.
+func (c *Controller) RegisterRoutes(router fiber.Router, middleware ...fiber.Handler) {
+	apiKeys := router.Group("/api-keys", middleware...)
+
+	apiKeys.Post("/", c.Create)
+	apiKeys.Get("/", c.List)
+	apiKeys.Delete("/:id", c.Revoke)
+}
+
+// Create handles API key creation
+// @Summary Create API key
+// @Description Create a personal access token. The key is only shown in this response.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param api-key body CreateAPIKeyRequest true "API key details"
+// @Security BearerAuth
+// @Success 201 {object} CreatedAPIKeyResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api-keys [post]
+func (c *Controller) Create(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userID").(uint)
+	if !ok {
+		return errors.NewUnauthorizedError("User not authenticated")
+	}
+
+	req := new(CreateAPIKeyRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	result, err := c.service.Create(userID, req)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// List handles listing the current user's API keys
+// @Summary List API keys
+// @Description List the current user's active API keys
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} APIKeyResponse
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api-keys [get]
+func (c *Controller) List(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userID").(uint)
+	if !ok {
+		return errors.NewUnauthorizedError("User not authenticated")
+	}
+
+	keys, err := c.service.List(userID)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    keys,
+	})
+}
+
+// Revoke handles revoking one of the current user's API keys
+// @Summary Revoke API key
+// @Description Revoke one of the current user's API keys
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param id path int true "API key ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api-keys/{id} [delete]
+func (c *Controller) Revoke(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userID").(uint)
+	if !ok {
+		return errors.NewUnauthorizedError("User not authenticated")
+	}
+
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return errors.NewBadRequestError("Invalid API key ID")
+	}
+
+	if err := c.service.Revoke(userID, uint(id)); err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"message": "API key revoked successfully",
+	})
+}
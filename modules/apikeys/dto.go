@@ -0,0 +1,29 @@
+package apikeys
+
+import "time"
+
+// CreateAPIKeyRequest represents the request for creating an API key
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,oneof=read write"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"omitempty,min=1,max=365"` // Defaults to 90 days
+}
+
+// APIKeyResponse represents an API key in listings. The key itself is never returned.
+type APIKeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+}
+
+// CreatedAPIKeyResponse is returned once when a key is created. It is the
+// only time the plaintext key is available.
+type CreatedAPIKeyResponse struct {
+	*APIKeyResponse
+	Key string `json:"key"`
+}
@@ -0,0 +1,66 @@
+package apikeys
+
+import (
+	"go-fiber-gorm/core/errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Repository handles database operations for API keys
+type Repository struct {
+	DB *gorm.DB
+}
+
+// NewRepository creates a new API key repository
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{
+		DB: db,
+	}
+}
+
+// Create creates a new API key
+func (r *Repository) Create(key *APIKey) error {
+	return r.DB.Create(key).Error
+}
+
+// FindByHash finds an API key by the hash of the key
+func (r *Repository) FindByHash(keyHash string) (*APIKey, error) {
+	var key APIKey
+	err := r.DB.Where("key_hash = ?", keyHash).First(&key).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError("API key")
+		}
+		return nil, errors.NewInternalServerError(err.Error())
+	}
+	return &key, nil
+}
+
+// FindActiveByUser returns the keys of a user that are neither revoked nor expired
+func (r *Repository) FindActiveByUser(userID uint) ([]APIKey, error) {
+	var keys []APIKey
+	err := r.DB.Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now()).
+		Order("created_at desc").
+		Find(&keys).Error
+	return keys, err
+}
+
+// Revoke revokes a key of a user. It returns false if no active key matched.
+func (r *Repository) Revoke(userID, keyID uint) (bool, error) {
+	result := r.DB.Model(&APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// TouchLastUsed records when and from where a key was last used
+func (r *Repository) TouchLastUsed(keyID uint, usedAt time.Time, clientIP string) error {
+	return r.DB.Model(&APIKey{}).Where("id = ?", keyID).Updates(map[string]interface{}{
+		"last_used_at": usedAt,
+		"last_used_ip": clientIP,
+	}).Error
+}
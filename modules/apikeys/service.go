@@ -0,0 +1,149 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/core/logger"
+	"go-fiber-gorm/modules/auth"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	defaultExpiry = 90 * 24 * time.Hour
+	// lastUsedInterval limits how often last-used tracking writes to the database
+	lastUsedInterval = time.Minute
+	// displayPrefixLength is the number of leading key characters stored in clear
+	displayPrefixLength = 12
+)
+
+// Service handles API key business logic
+type Service struct {
+	repo      *Repository
+	validator *validator.Validate
+}
+
+// NewService creates a new API key service
+func NewService(repo *Repository) *Service {
+	return &Service{
+		repo:      repo,
+		validator: validator.New(),
+	}
+}
+
+// Create creates a new API key for the user. The returned key is shown once
+// and only its hash is stored.
+func (s *Service) Create(userID uint, req *CreateAPIKeyRequest) (*CreatedAPIKeyResponse, error) {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return nil, errors.NewValidationError(err)
+	}
+
+	expiry := defaultExpiry
+	if req.ExpiresInDays > 0 {
+		expiry = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+	expiresAt := time.Now().Add(expiry)
+
+	rawKey := generateKey()
+	key := &APIKey{
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    rawKey[:displayPrefixLength],
+		KeyHash:   hashKey(rawKey),
+		Scopes:    strings.Join(uniqueScopes(req.Scopes), " "),
+		ExpiresAt: &expiresAt,
+	}
+
+	if err := s.repo.Create(key); err != nil {
+		return nil, errors.NewInternalServerError("Failed to create API key")
+	}
+
+	return &CreatedAPIKeyResponse{
+		APIKeyResponse: key.ToResponse(),
+		Key:            rawKey,
+	}, nil
+}
+
+// List returns the active API keys of the user
+func (s *Service) List(userID uint) ([]APIKeyResponse, error) {
+	keys, err := s.repo.FindActiveByUser(userID)
+	if err != nil {
+		return nil, errors.NewInternalServerError("Failed to list API keys")
+	}
+
+	responses := make([]APIKeyResponse, len(keys))
+	for i := range keys {
+		responses[i] = *keys[i].ToResponse()
+	}
+	return responses, nil
+}
+
+// Revoke revokes one of the user's API keys
+func (s *Service) Revoke(userID, keyID uint) error {
+	revoked, err := s.repo.Revoke(userID, keyID)
+	if err != nil {
+		return errors.NewInternalServerError("Failed to revoke API key")
+	}
+	if !revoked {
+		return errors.NewNotFoundError("API key")
+	}
+	return nil
+}
+
+// AuthenticateKey resolves an API key to its owner and scopes. It implements
+// auth.APIKeyAuthenticator.
+func (s *Service) AuthenticateKey(rawKey, clientIP string) (*auth.APIKeyPrincipal, error) {
+	key, err := s.repo.FindByHash(hashKey(rawKey))
+	if err != nil {
+		return nil, errors.NewUnauthorizedError("Invalid API key")
+	}
+
+	now := time.Now()
+	if !key.IsActive(now) {
+		return nil, errors.NewUnauthorizedError("API key has expired or been revoked")
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedInterval || key.LastUsedIP != clientIP {
+		if err := s.repo.TouchLastUsed(key.ID, now, clientIP); err != nil {
+			logger.Error("Failed to record API key usage:", err)
+		}
+	}
+
+	return &auth.APIKeyPrincipal{
+		KeyID:  key.ID,
+		UserID: key.UserID,
+		Scopes: key.ScopeList(),
+	}, nil
+}
+
+// generateKey generates a new API key with the recognisable prefix
+func generateKey() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return auth.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+}
+
+// hashKey hashes an API key for storage and lookup
+func hashKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// uniqueScopes removes duplicate scopes while keeping their order
+func uniqueScopes(scopes []string) []string {
+	seen := make(map[string]bool, len(scopes))
+	var unique []string
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			unique = append(unique, scope)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// commonPasswords is a bundled list of the most common leaked passwords,
+// used when no breached-password file is configured
+//
+//go:embed data/common_passwords.txt
+var commonPasswords string
+
+// breachedFalsePositiveRate is the target false positive rate of the filter
+const breachedFalsePositiveRate = 0.001
+
+// BreachedPasswords is a bloom filter of known breached passwords. It can
+// report a password as breached that is not (about 0.1% of the time), but
+// never misses a listed one.
+type BreachedPasswords struct {
+	bits   []uint64
+	m      uint64 // Number of bits
+	k      uint64 // Number of hash functions
+	hashed bool   // Whether entries are SHA-1 hashes (Have I Been Pwned format)
+}
+
+// LoadBreachedPasswords builds the filter from a file with one password per
+// line. Files in the Have I Been Pwned format ("<SHA-1>:<count>" per line)
+// are detected and stored as hashes. Without a path the bundled list is used.
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	if path == "" {
+		return newBreachedPasswords(strings.NewReader(commonPasswords))
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return newBreachedPasswords(file)
+}
+
+// newBreachedPasswords reads the list twice: once to size the filter and
+// once to fill it
+func newBreachedPasswords(r io.ReadSeeker) (*BreachedPasswords, error) {
+	var count int
+	hashed := true
+	if err := scanEntries(r, func(entry string) {
+		if count == 0 {
+			hashed = isSHA1Hex(entry)
+		}
+		count++
+	}); err != nil {
+		return nil, err
+	}
+
+	// m = -n ln(p) / ln(2)^2 and k = m/n ln(2)
+	n := math.Max(float64(count), 1)
+	m := uint64(math.Ceil(-n * math.Log(breachedFalsePositiveRate) / (math.Ln2 * math.Ln2)))
+	filter := &BreachedPasswords{
+		bits:   make([]uint64, (m+63)/64),
+		m:      m,
+		k:      uint64(math.Max(1, math.Round(float64(m)/n*math.Ln2))),
+		hashed: hashed && count > 0,
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := scanEntries(r, func(entry string) {
+		if filter.hashed {
+			entry = strings.ToUpper(entry)
+		}
+		filter.add(entry)
+	}); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+// Contains reports whether a password is (probably) in the list
+func (b *BreachedPasswords) Contains(password string) bool {
+	if b.hashed {
+		sum := sha1.Sum([]byte(password))
+		return b.test(strings.ToUpper(hex.EncodeToString(sum[:])))
+	}
+	return b.test(password)
+}
+
+func (b *BreachedPasswords) add(entry string) {
+	h1, h2 := bloomHashes(entry)
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (b *BreachedPasswords) test(entry string) bool {
+	h1, h2 := bloomHashes(entry)
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHashes derives the two base hashes for double hashing
+func bloomHashes(entry string) (uint64, uint64) {
+	sum := sha256.Sum256([]byte(entry))
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:16]) | 1
+}
+
+// scanEntries calls fn for every non-empty line, dropping HIBP counts
+func scanEntries(r io.Reader, fn func(entry string)) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		entry := strings.TrimRight(scanner.Text(), "\r")
+		if i := strings.IndexByte(entry, ':'); i == 40 && isSHA1Hex(entry[:40]) {
+			entry = entry[:40]
+		}
+		if entry != "" {
+			fn(entry)
+		}
+	}
+	return scanner.Err()
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
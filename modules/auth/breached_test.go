@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreachedPasswordsPlainList(t *testing.T) {
+	breached, err := newBreachedPasswords(strings.NewReader("hunter2\r\n\nsunshine\n"))
+	require.NoError(t, err)
+
+	assert.True(t, breached.Contains("hunter2"))
+	assert.True(t, breached.Contains("sunshine"))
+	assert.False(t, breached.Contains("Hunter2"), "entries are matched exactly")
+	assert.False(t, breached.Contains(testPassword))
+}
+
+func TestBreachedPasswordsHaveIBeenPwnedFile(t *testing.T) {
+	var lines []string
+	for i, password := range []string{"hunter2", "sunshine"} {
+		sum := sha1.Sum([]byte(password))
+		// HIBP lists uppercase hashes with a count; lowercase works too
+		hash := hex.EncodeToString(sum[:])
+		if i == 0 {
+			hash = strings.ToUpper(hash)
+		}
+		lines = append(lines, fmt.Sprintf("%s:%d", hash, 100+i))
+	}
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600))
+
+	breached, err := LoadBreachedPasswords(path)
+	require.NoError(t, err)
+	assert.True(t, breached.hashed)
+
+	assert.True(t, breached.Contains("hunter2"))
+	assert.True(t, breached.Contains("sunshine"))
+	assert.False(t, breached.Contains(testPassword))
+}
+
+func TestBreachedPasswordsBundledList(t *testing.T) {
+	breached, err := LoadBreachedPasswords("")
+	require.NoError(t, err)
+
+	for _, password := range strings.Fields(commonPasswords) {
+		assert.True(t, breached.Contains(password), password)
+	}
+}
+
+func TestBreachedPasswordsFalsePositiveRate(t *testing.T) {
+	var list strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&list, "listed-%d\n", i)
+	}
+	breached, err := newBreachedPasswords(strings.NewReader(list.String()))
+	require.NoError(t, err)
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if breached.Contains(fmt.Sprintf("unlisted-%d", i)) {
+			falsePositives++
+		}
+	}
+	// The filter targets 0.1%; allow for variance
+	assert.Less(t, falsePositives, 50)
+}
+
+func TestLoadBreachedPasswordsMissingFile(t *testing.T) {
+	_, err := LoadBreachedPasswords(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"go-fiber-gorm/core/logger"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// GrantTypeClientCredentials is the only grant the token endpoint supports
+const GrantTypeClientCredentials = "client_credentials"
+
+// OAuthError is an error response of the token endpoint (RFC 6749 section
+// 5.2). OAuth clients expect this format rather than the API's error envelope.
+type OAuthError struct {
+	Status      int    `json:"-"`
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// Error returns the error description
+func (e *OAuthError) Error() string {
+	return e.Description
+}
+
+func newOAuthError(status int, code, description string) *OAuthError {
+	return &OAuthError{Status: status, Code: code, Description: description}
+}
+
+// IssueClientToken implements the client credentials grant: it verifies the
+// client and issues an access token for the requested scopes, or for all of
+// the client's scopes when none are requested. The token identifies the
+// client, not a user.
+func (s *Service) IssueClientToken(req *ClientTokenRequest, meta RequestMeta) (*ClientTokenResponse, error) {
+	if req.GrantType != GrantTypeClientCredentials {
+		return nil, newOAuthError(http.StatusBadRequest, "unsupported_grant_type", "Only the client_credentials grant is supported")
+	}
+
+	client, err := s.authenticateClient(req.ClientID, req.ClientSecret, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := client.Scopes
+	if requested := strings.Fields(req.Scope); len(requested) > 0 {
+		for _, scope := range requested {
+			if !hasScope(client.Scopes, scope) {
+				return nil, newOAuthError(http.StatusBadRequest, "invalid_scope", "The client is not allowed the scope "+scope)
+			}
+		}
+		scopes = requested
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":       client.ClientID,
+		"client_id": client.ClientID,
+		"scope":     strings.Join(scopes, " "),
+		"uuid":      generateUUID(),
+		"exp":       now.Add(s.clientTokenExpiry).Unix(),
+		"iat":       now.Unix(),
+	}
+	if audience := s.clientAudience(client); audience != "" {
+		claims["aud"] = audience
+	}
+
+	accessToken, err := s.keys.Sign(claims)
+	if err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "Failed to generate token")
+	}
+
+	return &ClientTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.clientTokenExpiry.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// authenticateClient verifies the credentials of a client calling one of the
+// OAuth endpoints. Failures are logged as security events.
+func (s *Service) authenticateClient(clientID, clientSecret string, meta RequestMeta) (*ClientPrincipal, error) {
+	if s.clients == nil {
+		return nil, newOAuthError(http.StatusBadRequest, "unauthorized_client", "Client credentials are not enabled")
+	}
+	if clientID == "" || clientSecret == "" {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+	}
+
+	client, err := s.clients.AuthenticateClient(clientID, clientSecret)
+	if err != nil {
+		logger.SecurityEvent("client_authentication_failed", logrus.Fields{
+			"client_id": clientID,
+			"ip":        meta.IP,
+		})
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+	}
+
+	return client, nil
+}
+
+// clientAudience returns the audience of a client's tokens: the client's
+// own audience, or this API's
+func (s *Service) clientAudience(client *ClientPrincipal) string {
+	if client.Audience != "" {
+		return client.Audience
+	}
+	return s.audience
+}
+
+// parseClientClaims extracts the claims of a client token. The token's
+// audience must be this API's: when no audience is configured, only tokens
+// without one are accepted.
+func (s *Service) parseClientClaims(claims jwt.MapClaims) (*Claims, bool) {
+	clientID, _ := claims["client_id"].(string)
+	scope, _ := claims["scope"].(string)
+	tokenID, _ := claims["uuid"].(string)
+	issuedAt, _ := claims["iat"].(float64)
+	exp, _ := claims["exp"].(float64)
+
+	// Tokens are issued with a single audience string; anything else is foreign
+	audience, ok := claims["aud"].(string)
+	if _, present := claims["aud"]; present && (!ok || audience == "") {
+		return nil, false
+	}
+
+	if clientID == "" || audience != s.audience {
+		return nil, false
+	}
+
+	return &Claims{
+		ClientID:  clientID,
+		Scopes:    strings.Fields(scope),
+		Audience:  audience,
+		TokenID:   tokenID,
+		IssuedAt:  int64(issuedAt),
+		ExpiresAt: int64(exp),
+	}, true
+}
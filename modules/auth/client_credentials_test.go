@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubClients authenticates a single client with any secret
+type stubClients struct {
+	client *ClientPrincipal
+}
+
+func (c *stubClients) AuthenticateClient(clientID, clientSecret string) (*ClientPrincipal, error) {
+	return c.client, nil
+}
+
+func TestClientTokenAudience(t *testing.T) {
+	tests := []struct {
+		name           string
+		apiAudience    string
+		clientAudience string
+		wantValid      bool
+	}{
+		{name: "no audience", wantValid: true},
+		{name: "this API's audience", apiAudience: "https://api.example.com", wantValid: true},
+		{name: "client audience matches", apiAudience: "https://api.example.com", clientAudience: "https://api.example.com", wantValid: true},
+		{name: "other audience", apiAudience: "https://api.example.com", clientAudience: "https://other.example.com"},
+		{name: "audience while none is configured", clientAudience: "https://other.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, _ := newTestService(t, ServiceConfig{
+				Audience:          tt.apiAudience,
+				ClientTokenExpiry: 15 * time.Minute,
+				Clients: &stubClients{client: &ClientPrincipal{
+					ClientID: "reports",
+					Scopes:   []string{"users:read"},
+					Audience: tt.clientAudience,
+				}},
+			})
+
+			token, err := service.IssueClientToken(&ClientTokenRequest{
+				GrantType:    GrantTypeClientCredentials,
+				ClientID:     "reports",
+				ClientSecret: "secret",
+			}, RequestMeta{})
+			require.NoError(t, err)
+
+			claims, err := service.ValidateToken(token.AccessToken)
+			if tt.wantValid {
+				require.NoError(t, err)
+				assert.Equal(t, "reports", claims.ClientID)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
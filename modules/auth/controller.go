@@ -1,7 +1,11 @@
 package auth
 
 import (
+	"encoding/base64"
 	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/core/middleware"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
@@ -25,24 +29,59 @@ func (c *Controller) RegisterRoutes(router fiber.Router) {
 
 	// Public routes
 	auth.Post("/register", c.Register)
+	auth.Post("/invitations/accept", c.AcceptInvitation)
 	auth.Post("/login", c.Login)
 	auth.Post("/refresh-token", c.RefreshToken)
+	auth.Post("/forgot-password", c.ForgotPassword)
+	auth.Post("/reset-password", c.ResetPassword)
+	auth.Post("/verify-email", c.VerifyEmail)
+	auth.Post("/verify-email/resend", c.ResendVerificationEmail)
+	auth.Post("/magic-link", c.SendMagicLink)
+	auth.Post("/magic-link/verify", c.VerifyMagicLink)
+	auth.Post("/mfa/verify", c.VerifyMFA)
+	auth.Post("/passkeys/login/begin", c.BeginPasskeyLogin)
+	auth.Post("/passkeys/login/finish", c.FinishPasskeyLogin)
+	auth.Get("/oauth/providers", c.ListOAuthProviders)
+	auth.Get("/oauth/:provider/authorize", c.StartOAuth)
+	auth.Post("/oauth/:provider/callback", c.CompleteOAuth)
+
+	// OAuth2 token endpoint for service clients
+	router.Post("/oauth/token", c.Token)
+
+	// Token introspection for resource servers, authenticated as an OAuth client
+	auth.Post("/introspect", c.Introspect)
 
 	// Protected routes
+	auth.Get("/me", c.AuthMiddleware(), c.Me)
 	auth.Post("/logout", c.AuthMiddleware(), c.Logout)
-	auth.Post("/logout-all", c.AuthMiddleware(), c.LogoutAll)
-	auth.Post("/change-password", c.AuthMiddleware(), c.ChangePassword)
+	auth.Get("/passkeys", c.AuthMiddleware(), c.ListPasskeys)
+	auth.Get("/sessions", c.AuthMiddleware(), c.ListSessions)
+	auth.Get("/login-history", c.AuthMiddleware(), c.LoginHistory)
+
+	// Account owner routes, not available while impersonating
+	auth.Post("/logout-all", c.OwnerMiddleware(), c.LogoutAll)
+	auth.Post("/reauth", c.OwnerMiddleware(), c.Reauthenticate)
+	auth.Post("/change-password", c.OwnerMiddleware(), c.RecentAuthMiddleware(), c.ChangePassword)
+	auth.Post("/mfa/totp/enroll", c.OwnerMiddleware(), c.EnrollTOTP)
+	auth.Post("/mfa/totp/confirm", c.OwnerMiddleware(), c.ConfirmTOTP)
+	auth.Post("/mfa/totp/disable", c.OwnerMiddleware(), c.DisableTOTP)
+	auth.Post("/mfa/recovery-codes", c.OwnerMiddleware(), c.RegenerateRecoveryCodes)
+	auth.Post("/passkeys/register/begin", c.OwnerMiddleware(), c.BeginPasskeyRegistration)
+	auth.Post("/passkeys/register/finish", c.OwnerMiddleware(), c.FinishPasskeyRegistration)
+	auth.Delete("/passkeys/:id", c.OwnerMiddleware(), c.DeletePasskey)
+	auth.Delete("/sessions/:id", c.OwnerMiddleware(), c.RevokeSession)
 }
 
 // Register handles user registration
 // @Summary Register a new user
-// @Description Register a new user with email and password
+// @Description Register a new user with email and password. Returns 403 when registration is invite-only or disabled.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param user body RegisterRequest true "User registration data"
 // @Success 201 {object} AuthResponse
 // @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
 // @Router /auth/register [post]
 func (c *Controller) Register(ctx *fiber.Ctx) error {
@@ -51,11 +90,44 @@ func (c *Controller) Register(ctx *fiber.Ctx) error {
 		return errors.NewBadRequestError("Invalid request body")
 	}
 
-	result, err := c.service.Register(req)
+	result, err := c.service.Register(req, requestMeta(ctx))
+	if err != nil {
+		return err
+	}
+
+	c.deliverTokens(ctx, result.Token)
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// AcceptInvitation handles creating an account from an invitation
+// @Summary Accept invitation
+// @Description Create the invited account with a password and sign in. The email and role come from the invitation.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param invitation body AcceptInvitationRequest true "Invitation token and account details"
+// @Success 201 {object} AuthResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/invitations/accept [post]
+func (c *Controller) AcceptInvitation(ctx *fiber.Ctx) error {
+	req := new(AcceptInvitationRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	result, err := c.service.AcceptInvitation(req, requestMeta(ctx))
 	if err != nil {
 		return err
 	}
 
+	c.deliverTokens(ctx, result.Token)
+
 	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
 		"data":    result,
@@ -64,12 +136,13 @@ func (c *Controller) Register(ctx *fiber.Ctx) error {
 
 // Login handles user login
 // @Summary Login user
-// @Description Login with email and password
+// @Description Login with email and password. Send X-Auth-Transport: cookie to receive the tokens as HttpOnly cookies.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param user body LoginRequest true "Login credentials"
-// @Success 200 {object} AuthResponse
+// @Param X-Auth-Transport header string false "Token transport: header or cookie"
+// @Success 200 {object} LoginResponse
 // @Failure 400 {object} map[string]interface{}
 // @Failure 401 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
@@ -80,20 +153,34 @@ func (c *Controller) Login(ctx *fiber.Ctx) error {
 		return errors.NewBadRequestError("Invalid request body")
 	}
 
-	result, err := c.service.Login(req)
+	result, err := c.service.Login(req, requestMeta(ctx))
 	if err != nil {
 		return err
 	}
 
+	c.deliverTokens(ctx, loginToken(result))
+
 	return ctx.JSON(fiber.Map{
 		"success": true,
 		"data":    result,
 	})
 }
 
+// JWKS publishes the public keys access tokens are signed with
+// @Summary JSON Web Key Set
+// @Description Public keys for verifying access tokens offline, selected by the token's "kid" header
+// @Tags auth
+// @Produce json
+// @Success 200 {object} JSONWebKeySet
+// @Router /.well-known/jwks.json [get]
+func (c *Controller) JWKS(ctx *fiber.Ctx) error {
+	ctx.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return ctx.JSON(c.service.JWKS())
+}
+
 // RefreshToken handles token refresh
 // @Summary Refresh token
-// @Description Get a new access token using refresh token
+// @Description Get a new access token using the refresh token from the body, or from the refresh token cookie together with the X-CSRF-Token header
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -104,16 +191,18 @@ func (c *Controller) Login(ctx *fiber.Ctx) error {
 // @Failure 500 {object} map[string]interface{}
 // @Router /auth/refresh-token [post]
 func (c *Controller) RefreshToken(ctx *fiber.Ctx) error {
-	req := new(RefreshTokenRequest)
-	if err := ctx.BodyParser(req); err != nil {
-		return errors.NewBadRequestError("Invalid request body")
+	req, err := c.refreshTokenRequest(ctx)
+	if err != nil {
+		return err
 	}
 
-	result, err := c.service.RefreshToken(req)
+	result, err := c.service.RefreshToken(req, requestMeta(ctx))
 	if err != nil {
 		return err
 	}
 
+	c.deliverTokens(ctx, result)
+
 	return ctx.JSON(fiber.Map{
 		"success": true,
 		"data":    result,
@@ -122,7 +211,7 @@ func (c *Controller) RefreshToken(ctx *fiber.Ctx) error {
 
 // Logout handles user logout
 // @Summary Logout user
-// @Description Invalidate the current session
+// @Description Invalidate the session and revoke the access token used for the request
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -133,16 +222,28 @@ func (c *Controller) RefreshToken(ctx *fiber.Ctx) error {
 // @Failure 500 {object} map[string]interface{}
 // @Router /auth/logout [post]
 func (c *Controller) Logout(ctx *fiber.Ctx) error {
-	// Get refresh token from request
-	req := new(RefreshTokenRequest)
-	if err := ctx.BodyParser(req); err != nil || req.RefreshToken == "" {
+	// Get refresh token from the request body or cookie
+	req, err := c.refreshTokenRequest(ctx)
+	if err != nil {
+		return err
+	}
+	if req.RefreshToken == "" {
 		return errors.NewBadRequestError("Refresh token is required")
 	}
 
-	if err := c.service.Logout(req.RefreshToken); err != nil {
+	claims, err := GetAuthUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := c.service.Logout(req.RefreshToken, claims); err != nil {
 		return err
 	}
 
+	if c.usesCookies(ctx) {
+		c.clearSessionCookies(ctx)
+	}
+
 	return ctx.JSON(fiber.Map{
 		"success": true,
 		"message": "Logged out successfully",
@@ -171,6 +272,10 @@ func (c *Controller) LogoutAll(ctx *fiber.Ctx) error {
 		return err
 	}
 
+	if c.usesCookies(ctx) {
+		c.clearSessionCookies(ctx)
+	}
+
 	return ctx.JSON(fiber.Map{
 		"success": true,
 		"message": "Logged out from all devices successfully",
@@ -179,7 +284,7 @@ func (c *Controller) LogoutAll(ctx *fiber.Ctx) error {
 
 // ChangePassword handles password change
 // @Summary Change password
-// @Description Change the user's password
+// @Description Change the user's password. Requires a recent login; otherwise returns 401 REAUTHENTICATION_REQUIRED, see /auth/reauth.
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -213,33 +318,1015 @@ func (c *Controller) ChangePassword(ctx *fiber.Ctx) error {
 	})
 }
 
-// AuthMiddleware returns a middleware that checks authentication
-func (c *Controller) AuthMiddleware() fiber.Handler {
-	return func(ctx *fiber.Ctx) error {
-		// Get the Authorization header
-		authHeader := ctx.Get("Authorization")
-		if authHeader == "" {
-			return errors.NewUnauthorizedError("Authorization header is missing")
-		}
-
-		// Check the format
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			return errors.NewUnauthorizedError("Authorization header format must be 'Bearer {token}'")
-		}
-
-		// Validate the token
-		tokenString := parts[1]
-		claims, err := c.service.ValidateToken(tokenString)
-		if err != nil {
-			return err
-		}
-
-		// Store user info in context
-		ctx.Locals("userID", claims.UserID)
-		ctx.Locals("userEmail", claims.Email)
-		ctx.Locals("userRole", claims.Role)
-
-		return ctx.Next()
+// Reauthenticate handles step-up re-authentication
+// @Summary Re-authenticate
+// @Description Confirm your identity with your password or a TOTP or recovery code before a sensitive operation. Returns a new access token for the current session with a fresh auth_time; the refresh token is unchanged.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body ReauthRequest true "Password or verification code"
+// @Security BearerAuth
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 423 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/reauth [post]
+func (c *Controller) Reauthenticate(ctx *fiber.Ctx) error {
+	claims, err := GetAuthUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	req := new(ReauthRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	result, err := c.service.Reauthenticate(claims, req, requestMeta(ctx))
+	if err != nil {
+		return err
+	}
+
+	c.deliverTokens(ctx, result)
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// ForgotPassword handles password reset requests
+// @Summary Request a password reset
+// @Description Send a password reset link to the given email if it belongs to an account
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param user body ResetPasswordRequest true "Account email"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /auth/forgot-password [post]
+func (c *Controller) ForgotPassword(ctx *fiber.Ctx) error {
+	req := new(ResetPasswordRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	if err := c.service.ForgotPassword(req); err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"message": "If the email belongs to an account, a password reset link has been sent",
+	})
+}
+
+// ResetPassword handles setting a new password with a reset token
+// @Summary Reset password
+// @Description Set a new password using a password reset token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param user body ResetPasswordConfirmRequest true "Reset token and new password"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/reset-password [post]
+func (c *Controller) ResetPassword(ctx *fiber.Ctx) error {
+	req := new(ResetPasswordConfirmRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	if err := c.service.ResetPassword(req); err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"message": "Password reset successfully",
+	})
+}
+
+// VerifyEmail handles email verification
+// @Summary Verify email
+// @Description Verify the user's email address, or confirm an email change, using the token from the emailed link
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body VerifyEmailRequest true "Verification token"
+// @Success 200 {object} UserInfo
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/verify-email [post]
+func (c *Controller) VerifyEmail(ctx *fiber.Ctx) error {
+	req := new(VerifyEmailRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	result, err := c.service.VerifyEmail(req)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// ResendVerificationEmail handles resending the verification email
+// @Summary Resend verification email
+// @Description Send a new verification link if the email belongs to an unverified account
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param user body ResendVerificationRequest true "Account email"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /auth/verify-email/resend [post]
+func (c *Controller) ResendVerificationEmail(ctx *fiber.Ctx) error {
+	req := new(ResendVerificationRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	if err := c.service.ResendVerificationEmail(req); err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"message": "If the email belongs to an unverified account, a verification link has been sent",
+	})
+}
+
+// SendMagicLink handles passwordless sign-in requests
+// @Summary Request a sign-in link
+// @Description Send a single-use sign-in link to the given email if it belongs to an account
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param user body MagicLinkRequest true "Account email"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /auth/magic-link [post]
+func (c *Controller) SendMagicLink(ctx *fiber.Ctx) error {
+	req := new(MagicLinkRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	if err := c.service.SendMagicLink(req); err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"message": "If the email belongs to an account, a sign-in link has been sent",
+	})
+}
+
+// VerifyMagicLink handles signing in with a magic link
+// @Summary Sign in with a magic link
+// @Description Exchange the token from a sign-in link for tokens
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body MagicLinkVerifyRequest true "Sign-in token"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/magic-link/verify [post]
+func (c *Controller) VerifyMagicLink(ctx *fiber.Ctx) error {
+	req := new(MagicLinkVerifyRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	result, err := c.service.VerifyMagicLink(req, requestMeta(ctx))
+	if err != nil {
+		return err
+	}
+
+	c.deliverTokens(ctx, loginToken(result))
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// VerifyMFA handles the second login step
+// @Summary Verify second factor
+// @Description Exchange the MFA token from login and a TOTP or recovery code for tokens
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param mfa body MFAVerifyRequest true "MFA token and code"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/mfa/verify [post]
+func (c *Controller) VerifyMFA(ctx *fiber.Ctx) error {
+	req := new(MFAVerifyRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	result, err := c.service.VerifyMFA(req, requestMeta(ctx))
+	if err != nil {
+		return err
+	}
+
+	c.deliverTokens(ctx, result.Token)
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// ListOAuthProviders handles listing the configured identity providers
+// @Summary List OAuth providers
+// @Description Get the names of the identity providers available for social login
+// @Tags auth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /auth/oauth/providers [get]
+func (c *Controller) ListOAuthProviders(ctx *fiber.Ctx) error {
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    c.service.OAuthProviders(),
+	})
+}
+
+// StartOAuth handles starting a social login
+// @Summary Start OAuth login
+// @Description Get the provider authorization URL and state for an authorization-code flow with PKCE
+// @Tags auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} OAuthAuthorizeResponse
+// @Failure 404 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /auth/oauth/{provider}/authorize [get]
+func (c *Controller) StartOAuth(ctx *fiber.Ctx) error {
+	result, err := c.service.StartOAuth(ctx.Params("provider"))
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// CompleteOAuth handles the provider callback
+// @Summary Complete OAuth login
+// @Description Exchange the authorization code and state from the provider redirect for tokens
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param callback body OAuthCallbackRequest true "Authorization code and state"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /auth/oauth/{provider}/callback [post]
+func (c *Controller) CompleteOAuth(ctx *fiber.Ctx) error {
+	req := new(OAuthCallbackRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	result, err := c.service.CompleteOAuth(ctx.Params("provider"), req, requestMeta(ctx))
+	if err != nil {
+		return err
+	}
+
+	c.deliverTokens(ctx, loginToken(result))
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// Token handles the OAuth2 token endpoint
+// @Summary OAuth2 token
+// @Description Issue an access token with the client_credentials grant. Client credentials are sent with HTTP Basic authentication or as client_id and client_secret. Errors follow RFC 6749.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "Must be client_credentials"
+// @Param scope formData string false "Space-separated scopes; all allowed scopes when omitted"
+// @Param client_id formData string false "Client ID, unless sent with Basic authentication"
+// @Param client_secret formData string false "Client secret, unless sent with Basic authentication"
+// @Success 200 {object} ClientTokenResponse
+// @Failure 400 {object} OAuthError
+// @Failure 401 {object} OAuthError
+// @Router /oauth/token [post]
+func (c *Controller) Token(ctx *fiber.Ctx) error {
+	// Token responses must not be cached (RFC 6749 section 5.1)
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	ctx.Set(fiber.HeaderPragma, "no-cache")
+
+	req := new(ClientTokenRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(newOAuthError(fiber.StatusBadRequest, "invalid_request", "Invalid request body"))
+	}
+
+	basic := false
+	if clientID, clientSecret, ok := basicAuth(ctx); ok {
+		req.ClientID, req.ClientSecret, basic = clientID, clientSecret, true
+	}
+
+	result, err := c.service.IssueClientToken(req, requestMeta(ctx))
+	if err != nil {
+		return oauthErrorResponse(ctx, err, basic)
+	}
+
+	return ctx.JSON(result)
+}
+
+// Introspect handles the OAuth2 token introspection endpoint
+// @Summary Introspect token
+// @Description Report whether an access token is active, including revocation, and return its claims (RFC 7662). The caller authenticates as an OAuth client with the tokens:introspect scope, like at the token endpoint.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "The access token"
+// @Param token_type_hint formData string false "Ignored; only access tokens can be introspected"
+// @Param client_id formData string false "Client ID, unless sent with Basic authentication"
+// @Param client_secret formData string false "Client secret, unless sent with Basic authentication"
+// @Success 200 {object} IntrospectionResponse
+// @Failure 400 {object} OAuthError
+// @Failure 401 {object} OAuthError
+// @Failure 403 {object} OAuthError
+// @Router /auth/introspect [post]
+func (c *Controller) Introspect(ctx *fiber.Ctx) error {
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	ctx.Set(fiber.HeaderPragma, "no-cache")
+
+	req := new(IntrospectionRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(newOAuthError(fiber.StatusBadRequest, "invalid_request", "Invalid request body"))
+	}
+
+	basic := false
+	if clientID, clientSecret, ok := basicAuth(ctx); ok {
+		req.ClientID, req.ClientSecret, basic = clientID, clientSecret, true
+	}
+
+	result, err := c.service.Introspect(req, requestMeta(ctx))
+	if err != nil {
+		return oauthErrorResponse(ctx, err, basic)
+	}
+
+	return ctx.JSON(result)
+}
+
+// Me handles getting the current user
+// @Summary Get current user
+// @Description Get the authenticated user and the session the request was made with
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} MeResponse
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/me [get]
+func (c *Controller) Me(ctx *fiber.Ctx) error {
+	claims, err := GetAuthUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	result, err := c.service.Me(claims)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// BeginPasskeyLogin handles starting a passkey sign-in
+// @Summary Start passkey login
+// @Description Get the options for navigator.credentials.get() to sign in with a passkey
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} PasskeyRequestOptions
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/passkeys/login/begin [post]
+func (c *Controller) BeginPasskeyLogin(ctx *fiber.Ctx) error {
+	result, err := c.service.BeginPasskeyLogin()
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// FinishPasskeyLogin handles completing a passkey sign-in
+// @Summary Complete passkey login
+// @Description Exchange the assertion returned by navigator.credentials.get() for tokens
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credential body PasskeyLoginRequest true "Passkey assertion"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/passkeys/login/finish [post]
+func (c *Controller) FinishPasskeyLogin(ctx *fiber.Ctx) error {
+	req := new(PasskeyLoginRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	result, err := c.service.FinishPasskeyLogin(req, requestMeta(ctx))
+	if err != nil {
+		return err
+	}
+
+	c.deliverTokens(ctx, result.Token)
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// EnrollTOTP handles starting TOTP enrollment
+// @Summary Enroll TOTP
+// @Description Generate a new TOTP secret and otpauth URI for the current user
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} MFAEnrollResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/mfa/totp/enroll [post]
+func (c *Controller) EnrollTOTP(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userID").(uint)
+	if !ok {
+		return errors.NewUnauthorizedError("User not authenticated")
+	}
+
+	result, err := c.service.EnrollTOTP(userID)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// ConfirmTOTP handles confirming TOTP enrollment
+// @Summary Confirm TOTP
+// @Description Enable two-factor authentication with a code from the authenticator app
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param code body MFACodeRequest true "TOTP code"
+// @Security BearerAuth
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/mfa/totp/confirm [post]
+func (c *Controller) ConfirmTOTP(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userID").(uint)
+	if !ok {
+		return errors.NewUnauthorizedError("User not authenticated")
+	}
+
+	req := new(MFACodeRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	result, err := c.service.ConfirmTOTP(userID, req)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// DisableTOTP handles disabling two-factor authentication
+// @Summary Disable TOTP
+// @Description Disable two-factor authentication with the password and a code
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body MFADisableRequest true "Password and TOTP or recovery code"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 423 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/mfa/totp/disable [post]
+func (c *Controller) DisableTOTP(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userID").(uint)
+	if !ok {
+		return errors.NewUnauthorizedError("User not authenticated")
+	}
+
+	req := new(MFADisableRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	if err := c.service.DisableTOTP(userID, req, requestMeta(ctx)); err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes handles replacing the recovery codes
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes with the password and a code; the old ones stop working
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body RecoveryCodesRequest true "Password and TOTP or recovery code"
+// @Security BearerAuth
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 423 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/mfa/recovery-codes [post]
+func (c *Controller) RegenerateRecoveryCodes(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userID").(uint)
+	if !ok {
+		return errors.NewUnauthorizedError("User not authenticated")
+	}
+
+	req := new(RecoveryCodesRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	result, err := c.service.RegenerateRecoveryCodes(userID, req, requestMeta(ctx))
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// BeginPasskeyRegistration handles starting passkey registration
+// @Summary Start passkey registration
+// @Description Get the options for navigator.credentials.create() to register a passkey for the current user
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} PasskeyCreationOptions
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/passkeys/register/begin [post]
+func (c *Controller) BeginPasskeyRegistration(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userID").(uint)
+	if !ok {
+		return errors.NewUnauthorizedError("User not authenticated")
+	}
+
+	result, err := c.service.BeginPasskeyRegistration(userID)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// FinishPasskeyRegistration handles completing passkey registration
+// @Summary Complete passkey registration
+// @Description Verify and store the credential returned by navigator.credentials.create()
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credential body PasskeyRegistrationRequest true "New credential and passkey name"
+// @Security BearerAuth
+// @Success 201 {object} PasskeyResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/passkeys/register/finish [post]
+func (c *Controller) FinishPasskeyRegistration(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userID").(uint)
+	if !ok {
+		return errors.NewUnauthorizedError("User not authenticated")
+	}
+
+	req := new(PasskeyRegistrationRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	result, err := c.service.FinishPasskeyRegistration(userID, req)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// ListPasskeys handles listing the current user's passkeys
+// @Summary List passkeys
+// @Description List the passkeys registered by the current user
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} PasskeyResponse
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/passkeys [get]
+func (c *Controller) ListPasskeys(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userID").(uint)
+	if !ok {
+		return errors.NewUnauthorizedError("User not authenticated")
+	}
+
+	passkeys, err := c.service.ListPasskeys(userID)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    passkeys,
+	})
+}
+
+// DeletePasskey handles removing one of the current user's passkeys
+// @Summary Delete passkey
+// @Description Remove one of the current user's passkeys
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param id path int true "Passkey ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/passkeys/{id} [delete]
+func (c *Controller) DeletePasskey(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userID").(uint)
+	if !ok {
+		return errors.NewUnauthorizedError("User not authenticated")
+	}
+
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return errors.NewBadRequestError("Invalid passkey ID")
+	}
+
+	if err := c.service.DeletePasskey(userID, uint(id)); err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"message": "Passkey deleted successfully",
+	})
+}
+
+// ListSessions handles listing the current user's sessions
+// @Summary List sessions
+// @Description List the active sessions of the current user; the calling session is marked as current
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} SessionResponse
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/sessions [get]
+func (c *Controller) ListSessions(ctx *fiber.Ctx) error {
+	claims, err := GetAuthUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := c.service.ListSessions(claims.UserID, claims.SessionID)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    sessions,
+	})
+}
+
+// LoginHistory handles listing the current user's login attempts
+// @Summary Login history
+// @Description List the successful and failed logins of the current user, newest first
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Page size" default(10)
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/login-history [get]
+func (c *Controller) LoginHistory(ctx *fiber.Ctx) error {
+	claims, err := GetAuthUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Parse query parameters for pagination
+	page, _ := strconv.Atoi(ctx.Query("page", "1"))
+	limit, _ := strconv.Atoi(ctx.Query("limit", "10"))
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 10
+	}
+
+	events, count, err := c.service.LoginHistory(claims.UserID, page, limit)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"events": events,
+			"meta": fiber.Map{
+				"total": count,
+				"page":  page,
+				"limit": limit,
+				"pages": (count + int64(limit) - 1) / int64(limit),
+			},
+		},
+	})
+}
+
+// RevokeSession handles revoking one of the current user's sessions
+// @Summary Revoke session
+// @Description Revoke one of the current user's sessions, e.g. a lost device
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param id path int true "Session ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /auth/sessions/{id} [delete]
+func (c *Controller) RevokeSession(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userID").(uint)
+	if !ok {
+		return errors.NewUnauthorizedError("User not authenticated")
+	}
+
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return errors.NewBadRequestError("Invalid session ID")
+	}
+
+	if err := c.service.RevokeSession(userID, uint(id)); err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"message": "Session revoked successfully",
+	})
+}
+
+// ListUserSessions handles listing the sessions of any user (admin only)
+// @Summary List user sessions
+// @Description List the active sessions of a user
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Security BearerAuth
+// @Success 200 {array} SessionResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /users/{id}/sessions [get]
+func (c *Controller) ListUserSessions(ctx *fiber.Ctx) error {
+	claims, err := GetAuthUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return errors.NewBadRequestError("Invalid user ID")
+	}
+
+	sessions, err := c.service.ListSessions(uint(id), claims.SessionID)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    sessions,
+	})
+}
+
+// UnlockUser handles lifting a login lockout of a user (admin only)
+// @Summary Unlock user
+// @Description Clear the failed login attempts and lockout of a user's account
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /users/{id}/unlock [post]
+func (c *Controller) UnlockUser(ctx *fiber.Ctx) error {
+	claims, err := GetAuthUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return errors.NewBadRequestError("Invalid user ID")
+	}
+
+	if err := c.service.UnlockAccount(claims.UserID, uint(id)); err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"message": "User unlocked successfully",
+	})
+}
+
+// Impersonate handles an admin starting to act as a user (admin only)
+// @Summary Impersonate user
+// @Description Get a short-lived access token that acts as the user, for reproducing issues. Every request made with it is audited.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param userID path int true "User ID"
+// @Param impersonation body ImpersonateRequest true "Reason for the impersonation"
+// @Security BearerAuth
+// @Success 200 {object} ImpersonationResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/impersonate/{userID} [post]
+func (c *Controller) Impersonate(ctx *fiber.Ctx) error {
+	claims, err := GetAuthUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.ParseUint(ctx.Params("userID"), 10, 32)
+	if err != nil {
+		return errors.NewBadRequestError("Invalid user ID")
+	}
+
+	req := new(ImpersonateRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	result, err := c.service.Impersonate(claims, uint(id), req, requestMeta(ctx))
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// AuthMiddleware returns a middleware that checks authentication. Account
+// endpoints require a session, so API keys are not accepted.
+func (c *Controller) AuthMiddleware() fiber.Handler {
+	return NewMiddleware(c.service).SessionRequired()
+}
+
+// OwnerMiddleware is AuthMiddleware for endpoints that also reject
+// impersonation tokens
+func (c *Controller) OwnerMiddleware() fiber.Handler {
+	return NewMiddleware(c.service).OwnerRequired()
+}
+
+// RecentAuthMiddleware is for sensitive operations that need a login within
+// the configured re-authentication window
+func (c *Controller) RecentAuthMiddleware() fiber.Handler {
+	return NewMiddleware(c.service).RequireRecentAuth(c.service.reauthMaxAge)
+}
+
+// basicAuth reads client credentials from an HTTP Basic Authorization
+// header. Both parts are form-encoded (RFC 6749 section 2.3.1).
+func basicAuth(ctx *fiber.Ctx) (string, string, bool) {
+	header := ctx.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(header, "Basic ") {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+	if err != nil {
+		return "", "", false
+	}
+	id, secret, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", false
+	}
+
+	id, err1 := url.QueryUnescape(id)
+	secret, err2 := url.QueryUnescape(secret)
+	if err1 != nil || err2 != nil {
+		return "", "", false
+	}
+	return id, secret, true
+}
+
+// oauthErrorResponse renders an error of the OAuth endpoints in the RFC 6749
+// format. Clients that failed Basic authentication are told the scheme.
+func oauthErrorResponse(ctx *fiber.Ctx, err error, basic bool) error {
+	oauthErr, ok := err.(*OAuthError)
+	if !ok {
+		return err
+	}
+	if oauthErr.Code == "invalid_client" && basic {
+		ctx.Set(fiber.HeaderWWWAuthenticate, `Basic realm="oauth"`)
+	}
+	return ctx.Status(oauthErr.Status).JSON(oauthErr)
+}
+
+// requestMeta extracts client information from the request.
+// The client IP is resolved by middleware.RealIP behind trusted proxies.
+func requestMeta(ctx *fiber.Ctx) RequestMeta {
+	return RequestMeta{
+		IP:         middleware.ClientIP(ctx),
+		UserAgent:  ctx.Get(fiber.HeaderUserAgent),
+		DeviceName: strings.TrimSpace(ctx.Get("X-Device-Name")),
 	}
 }
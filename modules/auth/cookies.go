@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"go-fiber-gorm/core/errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Token transports. With the header transport tokens are returned in the
+// response body and sent back as bearer tokens; with the cookie transport
+// they are kept in HttpOnly cookies the browser sends automatically.
+const (
+	TransportHeader = "header"
+	TransportCookie = "cookie"
+)
+
+// Cookie and header names used by the cookie transport
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFTokenCookie    = "csrf_token"
+	CSRFTokenHeader    = "X-CSRF-Token"
+	TransportHeaderKey = "X-Auth-Transport" // Lets a client choose the transport per request
+)
+
+// CookieConfig configures the cookie transport for browser clients
+type CookieConfig struct {
+	Transport   string // Transport used when the request does not choose one; header or cookie
+	Domain      string // Cookie domain; host-only cookies when empty
+	Secure      bool   // Only send the cookies over HTTPS
+	SameSite    string // Lax, Strict or None
+	RefreshPath string // Path the refresh token cookie is limited to, e.g. /api/v1/auth
+}
+
+// withDefaults returns the config with zero values replaced by defaults
+func (c CookieConfig) withDefaults() CookieConfig {
+	if c.Transport != TransportCookie {
+		c.Transport = TransportHeader
+	}
+	switch strings.ToLower(c.SameSite) {
+	case "strict":
+		c.SameSite = fiber.CookieSameSiteStrictMode
+	case "none":
+		c.SameSite = fiber.CookieSameSiteNoneMode
+	default:
+		c.SameSite = fiber.CookieSameSiteLaxMode
+	}
+	if c.RefreshPath == "" {
+		c.RefreshPath = "/"
+	}
+	return c
+}
+
+// usesCookies reports whether tokens should be delivered in cookies. An
+// X-Auth-Transport header wins; otherwise a request that already carries
+// session cookies stays in cookie mode, and the configured default applies.
+func (c *Controller) usesCookies(ctx *fiber.Ctx) bool {
+	switch strings.ToLower(ctx.Get(TransportHeaderKey)) {
+	case TransportCookie:
+		return true
+	case TransportHeader:
+		return false
+	}
+	if ctx.Cookies(AccessTokenCookie) != "" || ctx.Cookies(RefreshTokenCookie) != "" {
+		return true
+	}
+	return c.service.cookies.Transport == TransportCookie
+}
+
+// deliverTokens moves issued tokens into HttpOnly cookies when the request
+// uses the cookie transport. The response then only carries the lifetime
+// and the CSRF token the client must echo in the X-CSRF-Token header.
+func (c *Controller) deliverTokens(ctx *fiber.Ctx, token *TokenResponse) {
+	if token == nil || !c.usesCookies(ctx) {
+		return
+	}
+
+	ctx.Cookie(c.sessionCookie(AccessTokenCookie, token.AccessToken, "/", c.service.accessExpiry, true))
+	token.AccessToken = ""
+	token.TokenType = "Cookie"
+
+	// Re-authentication only replaces the access token; the refresh token
+	// and CSRF cookies stay as they are
+	if token.RefreshToken == "" {
+		return
+	}
+
+	cookies := c.service.cookies
+	csrfToken := generateRandomToken(32)
+
+	ctx.Cookie(c.sessionCookie(RefreshTokenCookie, token.RefreshToken, cookies.RefreshPath, c.service.refreshExpiry, true))
+	// Readable by scripts so the client can copy it into the header
+	ctx.Cookie(c.sessionCookie(CSRFTokenCookie, csrfToken, "/", c.service.refreshExpiry, false))
+
+	token.RefreshToken = ""
+	token.CSRFToken = csrfToken
+}
+
+// clearSessionCookies removes the session cookies from the browser
+func (c *Controller) clearSessionCookies(ctx *fiber.Ctx) {
+	cookies := c.service.cookies
+	ctx.Cookie(c.sessionCookie(AccessTokenCookie, "", "/", -time.Hour, true))
+	ctx.Cookie(c.sessionCookie(RefreshTokenCookie, "", cookies.RefreshPath, -time.Hour, true))
+	ctx.Cookie(c.sessionCookie(CSRFTokenCookie, "", "/", -time.Hour, false))
+}
+
+// sessionCookie builds a cookie with the configured attributes. A negative
+// lifetime expires the cookie.
+func (c *Controller) sessionCookie(name, value, path string, lifetime time.Duration, httpOnly bool) *fiber.Cookie {
+	cookies := c.service.cookies
+	return &fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   cookies.Domain,
+		Expires:  time.Now().Add(lifetime),
+		Secure:   cookies.Secure,
+		HTTPOnly: httpOnly,
+		SameSite: cookies.SameSite,
+	}
+}
+
+// refreshTokenRequest reads the refresh token from the body, or from the
+// refresh token cookie after checking the CSRF token
+func (c *Controller) refreshTokenRequest(ctx *fiber.Ctx) (*RefreshTokenRequest, error) {
+	req := new(RefreshTokenRequest)
+	if len(ctx.Body()) > 0 {
+		if err := ctx.BodyParser(req); err != nil {
+			return nil, errors.NewBadRequestError("Invalid request body")
+		}
+	}
+
+	if req.RefreshToken == "" {
+		if cookie := ctx.Cookies(RefreshTokenCookie); cookie != "" {
+			if err := verifyCSRF(ctx); err != nil {
+				return nil, err
+			}
+			req.RefreshToken = cookie
+		}
+	}
+
+	return req, nil
+}
+
+// verifyCSRF checks the double-submit CSRF token of a cookie-authenticated
+// request: the X-CSRF-Token header must match the csrf_token cookie. A
+// cross-site page can make the browser send the cookie but cannot read it.
+func verifyCSRF(ctx *fiber.Ctx) error {
+	if isSafeMethod(ctx.Method()) {
+		return nil
+	}
+
+	cookie := ctx.Cookies(CSRFTokenCookie)
+	header := ctx.Get(CSRFTokenHeader)
+	if cookie == "" || header == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
+		return errors.New(http.StatusForbidden, "CSRF_TOKEN_INVALID", "Missing or invalid CSRF token")
+	}
+	return nil
+}
+
+// loginToken returns the tokens of a login response; none are issued while
+// a second factor is pending
+func loginToken(result *LoginResponse) *TokenResponse {
+	if result.AuthResponse == nil {
+		return nil
+	}
+	return result.Token
+}
@@ -1,16 +1,25 @@
 package auth
 
+import "time"
+
 // LoginRequest represents the request for login
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6"`
+	Password string `json:"password" validate:"required"`
 }
 
 // RegisterRequest represents the request for registration
 type RegisterRequest struct {
 	Name     string `json:"name" validate:"required"`
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6"`
+	Password string `json:"password" validate:"required"`
+}
+
+// AcceptInvitationRequest represents the request for creating an account from an invitation
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Name     string `json:"name" validate:"required,max=100"`
+	Password string `json:"password" validate:"required"`
 }
 
 // RefreshTokenRequest represents the request for refreshing a token
@@ -23,30 +32,331 @@ type ResetPasswordRequest struct {
 	Email string `json:"email" validate:"required,email"`
 }
 
+// ResetPasswordConfirmRequest represents the request for setting a new password with a reset token
+type ResetPasswordConfirmRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+// VerifyEmailRequest represents the request for verifying an email address
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// ResendVerificationRequest represents the request for resending the verification email
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// MagicLinkRequest represents the request for a passwordless sign-in link
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// MagicLinkVerifyRequest represents the request for signing in with a magic link token
+type MagicLinkVerifyRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
 // ChangePasswordRequest represents the request for changing a password
 type ChangePasswordRequest struct {
 	OldPassword string `json:"old_password" validate:"required"`
-	NewPassword string `json:"new_password" validate:"required,min=6"`
+	NewPassword string `json:"new_password" validate:"required"`
 }
 
 // TokenResponse represents the response containing tokens
 type TokenResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
-	ExpiresIn    int64  `json:"expires_in"` // in seconds
-	TokenType    string `json:"token_type"` // typically "Bearer"
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in"`           // in seconds
+	TokenType    string `json:"token_type"`           // "Bearer", or "Cookie" when the tokens were set as cookies
+	CSRFToken    string `json:"csrf_token,omitempty"` // Cookie transport only; send it back in the X-CSRF-Token header
 }
 
-// AuthResponse represents the authenticated user response
+// AuthResponse represents the authenticated user response.
+// Token is omitted when the user still has to verify their email.
 type AuthResponse struct {
-	User  UserInfo      `json:"user"`
-	Token TokenResponse `json:"token"`
+	User  UserInfo       `json:"user"`
+	Token *TokenResponse `json:"token,omitempty"`
+}
+
+// LoginResponse represents the response of the first login step.
+// When MFARequired is set no tokens are issued; the client has to exchange
+// MFAToken and a second factor code at /auth/mfa/verify.
+type LoginResponse struct {
+	*AuthResponse
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+	ExpiresIn   int64  `json:"expires_in,omitempty"` // MFA token lifetime in seconds
+}
+
+// MFAVerifyRequest represents the second login step
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required"` // TOTP code or recovery code
+}
+
+// OAuthCallbackRequest carries the parameters the provider redirected back with
+type OAuthCallbackRequest struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+// MFACodeRequest represents a request confirmed with a TOTP code
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// ReauthRequest represents the request for confirming the identity of a
+// signed-in user. Exactly one of the fields must be set.
+type ReauthRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"` // TOTP code or recovery code
+}
+
+// MFADisableRequest represents the request for disabling two-factor authentication
+type MFADisableRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"` // TOTP code or recovery code
+}
+
+// RecoveryCodesRequest represents the request for replacing the recovery codes
+type RecoveryCodesRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"` // TOTP code or recovery code
+}
+
+// MFAEnrollResponse represents a new, unconfirmed TOTP factor
+type MFAEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// OAuthAuthorizeResponse contains the provider URL to send the browser to
+type OAuthAuthorizeResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
+}
+
+// RecoveryCodesResponse represents freshly generated recovery codes
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// SessionResponse represents an active session in session listings
+type SessionResponse struct {
+	ID         uint      `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UserAgent  string    `json:"user_agent"`
+	ClientIP   string    `json:"client_ip"`
+	DeviceName string    `json:"device_name,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// LoginEventResponse represents an entry of a user's login history
+type LoginEventResponse struct {
+	ID            uint      `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	Method        string    `json:"method"`
+	Success       bool      `json:"success"`
+	FailureReason string    `json:"failure_reason,omitempty"`
+	ClientIP      string    `json:"client_ip"`
+	UserAgent     string    `json:"user_agent"`
+	DeviceName    string    `json:"device_name,omitempty"`
+	NewDevice     bool      `json:"new_device"`
 }
 
 // UserInfo represents user information in auth responses
 type UserInfo struct {
-	ID    uint   `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
-	Role  string `json:"role"`
+	ID            uint   `json:"id"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	Role          string `json:"role"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// JSONWebKey is a public key in JWK format (RFC 7517)
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet is the response of the JWKS endpoint
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// PasskeyCreationOptions are passed to navigator.credentials.create() to register a passkey
+type PasskeyCreationOptions struct {
+	Challenge              string                       `json:"challenge"`
+	RP                     PasskeyRelyingParty          `json:"rp"`
+	User                   PasskeyUser                  `json:"user"`
+	PubKeyCredParams       []PasskeyCredentialParameter `json:"pubKeyCredParams"`
+	Timeout                int64                        `json:"timeout"` // Milliseconds
+	ExcludeCredentials     []PasskeyDescriptor          `json:"excludeCredentials"`
+	AuthenticatorSelection PasskeyAuthenticatorCriteria `json:"authenticatorSelection"`
+	Attestation            string                       `json:"attestation"`
+}
+
+// PasskeyRequestOptions are passed to navigator.credentials.get() to sign in with a passkey
+type PasskeyRequestOptions struct {
+	Challenge        string              `json:"challenge"`
+	RPID             string              `json:"rpId"`
+	Timeout          int64               `json:"timeout"` // Milliseconds
+	UserVerification string              `json:"userVerification"`
+	AllowCredentials []PasskeyDescriptor `json:"allowCredentials"`
+}
+
+// PasskeyRelyingParty identifies this service to the authenticator
+type PasskeyRelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// PasskeyUser identifies the account a passkey is created for
+type PasskeyUser struct {
+	ID          string `json:"id"` // Opaque user handle, base64url
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// PasskeyCredentialParameter is an accepted key algorithm
+type PasskeyCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// PasskeyDescriptor references an existing credential
+type PasskeyDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"` // base64url
+	Transports []string `json:"transports,omitempty"`
+}
+
+// PasskeyAuthenticatorCriteria restricts which authenticators may be used
+type PasskeyAuthenticatorCriteria struct {
+	ResidentKey      string `json:"residentKey"`
+	RequireResident  bool   `json:"requireResidentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// PasskeyRegistrationRequest is the credential returned by navigator.credentials.create()
+// in its JSON form, plus a name for the passkey. Binary fields are base64url.
+type PasskeyRegistrationRequest struct {
+	Name     string                     `json:"name" validate:"max=100"`
+	ID       string                     `json:"id" validate:"required"`
+	Type     string                     `json:"type" validate:"required,eq=public-key"`
+	Response PasskeyAttestationResponse `json:"response"`
+}
+
+// PasskeyAttestationResponse is the authenticator response of a registration
+type PasskeyAttestationResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON" validate:"required"`
+	AttestationObject string   `json:"attestationObject" validate:"required"`
+	Transports        []string `json:"transports"`
+}
+
+// PasskeyLoginRequest is the credential returned by navigator.credentials.get()
+// in its JSON form. Binary fields are base64url.
+type PasskeyLoginRequest struct {
+	ID       string                   `json:"id" validate:"required"`
+	Type     string                   `json:"type" validate:"required,eq=public-key"`
+	Response PasskeyAssertionResponse `json:"response"`
+}
+
+// PasskeyAssertionResponse is the authenticator response of a sign-in
+type PasskeyAssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON" validate:"required"`
+	AuthenticatorData string `json:"authenticatorData" validate:"required"`
+	Signature         string `json:"signature" validate:"required"`
+	UserHandle        string `json:"userHandle"`
+}
+
+// PasskeyResponse represents a registered passkey in listings
+type PasskeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	AAGUID     string     `json:"aaguid,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// ImpersonateRequest represents the request for impersonating a user
+type ImpersonateRequest struct {
+	Reason string `json:"reason" validate:"required,max=500"` // Recorded in the audit log, e.g. a support ticket
+}
+
+// ImpersonationResponse carries a short-lived access token that acts as
+// the user. It has no refresh token and cannot be renewed.
+type ImpersonationResponse struct {
+	AccessToken string   `json:"access_token"`
+	ExpiresIn   int64    `json:"expires_in"` // in seconds
+	TokenType   string   `json:"token_type"`
+	User        UserInfo `json:"user"`
+	Actor       Actor    `json:"actor"`
+}
+
+// ClientTokenRequest is a token request of the client credentials grant
+// (RFC 6749 section 4.4). The credentials may also be sent with HTTP Basic
+// authentication.
+type ClientTokenRequest struct {
+	GrantType    string `json:"grant_type" form:"grant_type"`
+	Scope        string `json:"scope" form:"scope"` // Space-separated; all allowed scopes when empty
+	ClientID     string `json:"client_id" form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+}
+
+// ClientTokenResponse is the token endpoint response (RFC 6749 section 5.1)
+type ClientTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"` // in seconds
+	Scope       string `json:"scope"`
+}
+
+// IntrospectionRequest is a token introspection request (RFC 7662). The
+// calling client authenticates like at the token endpoint.
+type IntrospectionRequest struct {
+	Token         string `json:"token" form:"token"`
+	TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"` // Ignored; only access tokens can be introspected
+	ClientID      string `json:"client_id" form:"client_id"`
+	ClientSecret  string `json:"client_secret" form:"client_secret"`
+}
+
+// IntrospectionResponse describes a token (RFC 7662 section 2.2). Inactive
+// tokens only carry "active": false.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	TokenID   string `json:"jti,omitempty"`
+
+	// Claims of user tokens
+	UserID    uint   `json:"user_id,omitempty"`
+	Role      string `json:"role,omitempty"`
+	SessionID uint   `json:"sid,omitempty"`
+	AuthTime  int64  `json:"auth_time,omitempty"`
+	Actor     *Actor `json:"act,omitempty"`
+}
+
+// MeResponse represents the current user and the session of the request
+type MeResponse struct {
+	User      UserInfo         `json:"user"`
+	Session   *SessionResponse `json:"session,omitempty"` // Absent for API keys and impersonation tokens
+	Actor     *Actor           `json:"actor,omitempty"`   // The admin, while impersonating
+	ExpiresAt *time.Time       `json:"expires_at,omitempty"`
 }
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/core/mailer"
+	"go-fiber-gorm/modules/user"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// linkPattern finds the link in a mail body
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+// tokenFromMail returns the token of the link in the last mail to the recipient
+func tokenFromMail(t *testing.T, mail *mailer.MemoryMailer, to string) string {
+	t.Helper()
+
+	msg, ok := mail.Last(to)
+	require.True(t, ok, "no mail sent to %s", to)
+
+	link, err := url.Parse(linkPattern.FindString(msg.Body))
+	require.NoError(t, err)
+	token := link.Query().Get("token")
+	require.NotEmpty(t, token)
+	return token
+}
+
+func TestEmailChangeAppliesOnlyAfterConfirmation(t *testing.T) {
+	mail := mailer.NewMemoryMailer()
+	service, _ := newTestService(t, ServiceConfig{
+		MailQueue:            mail,
+		EmailVerificationURL: "http://localhost:3000/verify-email",
+	})
+	users := user.NewService(service.userRepo, service.passwords, nil, service)
+	u := createTestUser(t, service, "jane@example.com")
+
+	result, err := users.Update(u.ID, &user.UpdateUserRequest{Email: "new@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "jane@example.com", result.Email, "the current address stays until confirmed")
+	assert.Equal(t, "new@example.com", result.PendingEmail)
+	assert.NotNil(t, result.EmailVerifiedAt)
+
+	// The current address is told about the change
+	_, ok := mail.Last("jane@example.com")
+	assert.True(t, ok)
+
+	info, err := service.VerifyEmail(&VerifyEmailRequest{Token: tokenFromMail(t, mail, "new@example.com")})
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", info.Email)
+
+	found, err := service.userRepo.FindByID(u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", found.Email)
+	assert.True(t, found.IsEmailVerified())
+}
+
+func TestEmailChangeLinkExpiresWithTheOldAddress(t *testing.T) {
+	mail := mailer.NewMemoryMailer()
+	service, _ := newTestService(t, ServiceConfig{
+		MailQueue:            mail,
+		EmailVerificationURL: "http://localhost:3000/verify-email",
+	})
+	users := user.NewService(service.userRepo, service.passwords, nil, service)
+	u := createTestUser(t, service, "jane@example.com")
+
+	_, err := users.Update(u.ID, &user.UpdateUserRequest{Email: "first@example.com"})
+	require.NoError(t, err)
+	first := tokenFromMail(t, mail, "first@example.com")
+
+	_, err = users.Update(u.ID, &user.UpdateUserRequest{Email: "second@example.com"})
+	require.NoError(t, err)
+	_, err = service.VerifyEmail(&VerifyEmailRequest{Token: tokenFromMail(t, mail, "second@example.com")})
+	require.NoError(t, err)
+
+	// The earlier link was requested for an address that is no longer current
+	_, err = service.VerifyEmail(&VerifyEmailRequest{Token: first})
+	assert.Equal(t, http.StatusBadRequest, errors.StatusCode(err))
+}
+
+func TestEmailChangeRejectsAddressTakenSinceRequest(t *testing.T) {
+	mail := mailer.NewMemoryMailer()
+	service, _ := newTestService(t, ServiceConfig{
+		MailQueue:            mail,
+		EmailVerificationURL: "http://localhost:3000/verify-email",
+	})
+	users := user.NewService(service.userRepo, service.passwords, nil, service)
+	u := createTestUser(t, service, "jane@example.com")
+
+	_, err := users.Update(u.ID, &user.UpdateUserRequest{Email: "new@example.com"})
+	require.NoError(t, err)
+	createTestUser(t, service, "new@example.com")
+
+	_, err = service.VerifyEmail(&VerifyEmailRequest{Token: tokenFromMail(t, mail, "new@example.com")})
+	assert.Equal(t, http.StatusBadRequest, errors.StatusCode(err))
+
+	found, err := service.userRepo.FindByID(u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "jane@example.com", found.Email)
+}
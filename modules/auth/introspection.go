@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ScopeIntrospect is the scope a client needs to introspect tokens
+const ScopeIntrospect = "tokens:introspect"
+
+// Introspect describes an access token for a resource server (RFC 7662).
+// The caller must authenticate as a client with the tokens:introspect scope.
+// Tokens that are malformed, expired, revoked or issued for another audience
+// are reported as inactive rather than as an error.
+func (s *Service) Introspect(req *IntrospectionRequest, meta RequestMeta) (*IntrospectionResponse, error) {
+	client, err := s.authenticateClient(req.ClientID, req.ClientSecret, meta)
+	if err != nil {
+		return nil, err
+	}
+	if !hasScope(client.Scopes, ScopeIntrospect) {
+		return nil, newOAuthError(http.StatusForbidden, "unauthorized_client", "The client is not allowed to introspect tokens")
+	}
+	if req.Token == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "The token parameter is required")
+	}
+
+	claims, err := s.ValidateToken(req.Token)
+	if err != nil {
+		return &IntrospectionResponse{Active: false}, nil
+	}
+
+	response := &IntrospectionResponse{
+		Active:    true,
+		TokenType: "Bearer",
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+		TokenID:   claims.TokenID,
+	}
+
+	if claims.IsClient() {
+		response.Scope = strings.Join(claims.Scopes, " ")
+		response.ClientID = claims.ClientID
+		response.Subject = claims.ClientID
+		response.Audience = claims.Audience
+		return response, nil
+	}
+
+	response.Subject = strconv.FormatUint(uint64(claims.UserID), 10)
+	response.Username = claims.Email
+	response.UserID = claims.UserID
+	response.Role = claims.Role
+	response.SessionID = claims.SessionID
+	response.AuthTime = claims.AuthTime
+	response.Actor = claims.Actor
+	return response, nil
+}
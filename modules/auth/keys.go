@@ -0,0 +1,349 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// verificationKey is a public key (or the HMAC secret) tokens can be verified with
+type verificationKey struct {
+	id     string
+	method jwt.SigningMethod
+	key    interface{}
+}
+
+// KeySet holds the key access tokens are signed with and every key they may
+// be verified with. Tokens carry the ID of their signing key in the "kid"
+// header, so keys can be rotated by publishing the new key next to the old
+// one until tokens signed with the old key have expired.
+type KeySet struct {
+	signingID     string
+	signingMethod jwt.SigningMethod
+	signingKey    interface{}
+	verification  map[string]*verificationKey
+}
+
+// NewHMACKeySet creates a key set that signs and verifies with a shared
+// HS256 secret. Such tokens carry no "kid" and nothing is published in the JWKS.
+func NewHMACKeySet(secret string) *KeySet {
+	key := &verificationKey{method: jwt.SigningMethodHS256, key: []byte(secret)}
+	return &KeySet{
+		signingMethod: key.method,
+		signingKey:    key.key,
+		verification:  map[string]*verificationKey{"": key},
+	}
+}
+
+// LoadKeySet loads an asymmetric key set from PEM files. The signing key is
+// a private RSA (RS256), ECDSA (ES256/ES384/ES512) or Ed25519 (EdDSA) key.
+// Verification key files may hold public or private keys, typically the
+// previous signing key during a rotation. Without a signing key file the
+// HMAC secret is used instead.
+func LoadKeySet(secret, signingKeyFile string, verificationKeyFiles []string) (*KeySet, error) {
+	if signingKeyFile == "" {
+		return NewHMACKeySet(secret), nil
+	}
+
+	block, err := readPEM(signingKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", signingKeyFile, err)
+	}
+
+	signing, err := newVerificationKey(privateKey.Public())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", signingKeyFile, err)
+	}
+
+	ks := &KeySet{
+		signingID:     signing.id,
+		signingMethod: signing.method,
+		signingKey:    privateKey,
+		verification:  map[string]*verificationKey{signing.id: signing},
+	}
+
+	for _, file := range verificationKeyFiles {
+		block, err := readPEM(file)
+		if err != nil {
+			return nil, err
+		}
+
+		publicKey, err := parsePublicKey(block)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		key, err := newVerificationKey(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		ks.verification[key.id] = key
+	}
+
+	return ks, nil
+}
+
+// Sign signs claims with the current signing key
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signingMethod, claims)
+	if ks.signingID != "" {
+		token.Header["kid"] = ks.signingID
+	}
+	return token.SignedString(ks.signingKey)
+}
+
+// Keyfunc resolves the verification key for a token from its "kid" header
+// and rejects tokens whose algorithm does not match that key
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.verification[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.key, nil
+}
+
+// JWKS returns the public verification keys as a JSON Web Key Set (RFC 7517).
+// The HMAC secret is never published.
+func (ks *KeySet) JWKS() *JSONWebKeySet {
+	set := &JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range ks.verification {
+		if key.id == "" {
+			continue
+		}
+		jwk, _ := publicJWK(key.key)
+		jwk.Kid = key.id
+		jwk.Use = "sig"
+		jwk.Alg = key.method.Alg()
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// newVerificationKey picks the algorithm for a public key and derives its ID
+func newVerificationKey(publicKey crypto.PublicKey) (*verificationKey, error) {
+	var method jwt.SigningMethod
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			method = jwt.SigningMethodES256
+		case elliptic.P384():
+			method = jwt.SigningMethodES384
+		case elliptic.P521():
+			method = jwt.SigningMethodES512
+		default:
+			return nil, fmt.Errorf("unsupported ECDSA curve %s", k.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", publicKey)
+	}
+
+	jwk, err := publicJWK(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &verificationKey{
+		id:     jwk.thumbprint(),
+		method: method,
+		key:    publicKey,
+	}, nil
+}
+
+// publicJWK encodes the key material of a public key as a JWK
+func publicJWK(publicKey interface{}) (JSONWebKey, error) {
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		return JSONWebKey{
+			Kty: "RSA",
+			N:   base64URL(k.N.Bytes()),
+			E:   base64URL(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return JSONWebKey{
+			Kty: "EC",
+			Crv: k.Curve.Params().Name,
+			X:   base64URL(k.X.FillBytes(make([]byte, size))),
+			Y:   base64URL(k.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case ed25519.PublicKey:
+		return JSONWebKey{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64URL(k),
+		}, nil
+	}
+	return JSONWebKey{}, fmt.Errorf("unsupported key type %T", publicKey)
+}
+
+// PublicKey decodes the key material of a JWK, e.g. from a provider's JWKS
+func (k JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key length")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint used as the key ID
+func (k JSONWebKey) thumbprint() string {
+	// Only the required members, in lexicographic order
+	var members interface{}
+	switch k.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.Kty, k.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Crv, k.Kty, k.X, k.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{k.Crv, k.Kty, k.X}
+	}
+
+	b, _ := json.Marshal(members)
+	sum := sha256.Sum256(b)
+	return base64URL(sum[:])
+}
+
+// readPEM reads the first PEM block of a file
+func readPEM(file string) (*pem.Block, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", file)
+	}
+	return block, nil
+}
+
+// parsePrivateKey parses a PKCS#8, PKCS#1 or SEC 1 private key
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return signer, nil
+}
+
+// parsePublicKey parses a PKIX public key, or takes the public part of a private key
+func parsePublicKey(block *pem.Block) (crypto.PublicKey, error) {
+	if block.Type == "PUBLIC KEY" {
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+
+	signer, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Public(), nil
+}
+
+// base64URL encodes bytes as unpadded base64url
+func base64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/core/logger"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LockoutPolicy configures brute-force protection for password logins
+type LockoutPolicy struct {
+	MaxAttempts   int           // Failed logins per email before the account is locked
+	IPMaxAttempts int           // Failed logins per IP before the IP is locked
+	Window        time.Duration // Period in which failures are counted
+	Duration      time.Duration // How long an account or IP stays locked
+	DelayAfter    int           // Failed logins per email before progressive delays start
+	MaxDelay      time.Duration // Upper bound of the progressive delay
+}
+
+// withDefaults fills in unset fields
+func (p LockoutPolicy) withDefaults() LockoutPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 10
+	}
+	if p.IPMaxAttempts <= 0 {
+		p.IPMaxAttempts = 50
+	}
+	if p.Duration <= 0 {
+		p.Duration = 15 * time.Minute
+	}
+	if p.Window <= 0 {
+		p.Window = p.Duration
+	}
+	if p.DelayAfter <= 0 {
+		p.DelayAfter = 3
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 30 * time.Second
+	}
+	return p
+}
+
+// delay returns the progressive delay after the given number of failures:
+// 1s, 2s, 4s, ... up to MaxDelay once DelayAfter failures are reached
+func (p LockoutPolicy) delay(failures int64) time.Duration {
+	if failures < int64(p.DelayAfter) {
+		return 0
+	}
+	shift := failures - int64(p.DelayAfter)
+	if shift > 30 {
+		return p.MaxDelay
+	}
+	if d := time.Second << shift; d < p.MaxDelay {
+		return d
+	}
+	return p.MaxDelay
+}
+
+// checkLoginAllowed rejects logins for locked accounts and IPs, and logins
+// arriving before the progressive delay has passed
+func (s *Service) checkLoginAllowed(email, ip string) error {
+	if remaining, locked := s.attempts.LockedFor(lockoutEmailKey(email)); locked {
+		return errors.New(http.StatusLocked, "ACCOUNT_LOCKED", "Too many failed login attempts, the account is temporarily locked").
+			WithRetryAfter(remaining)
+	}
+	if remaining, locked := s.attempts.LockedFor(lockoutIPKey(ip)); locked {
+		return errors.NewTooManyRequestsError("Too many failed login attempts, please try again later").
+			WithRetryAfter(remaining)
+	}
+	if remaining, throttled := s.attempts.LockedFor(lockoutDelayKey(email)); throttled {
+		return errors.NewTooManyRequestsError("Please wait before trying again").
+			WithRetryAfter(remaining)
+	}
+	return nil
+}
+
+// checkMFAAllowed is checkLoginAllowed for the second factor, which is also
+// rejected while the second factor itself is locked
+func (s *Service) checkMFAAllowed(email, ip string) error {
+	if err := s.checkLoginAllowed(email, ip); err != nil {
+		return err
+	}
+	if remaining, locked := s.attempts.LockedFor(lockoutMFAKey(email)); locked {
+		return errors.New(http.StatusLocked, "ACCOUNT_LOCKED", "Too many failed verification attempts, the account is temporarily locked").
+			WithRetryAfter(remaining)
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed login for the email and IP, and applies
+// delays or locks once the thresholds are reached. Failures are counted for
+// unknown emails too, so responses do not reveal which accounts exist.
+func (s *Service) recordLoginFailure(email string, meta RequestMeta) {
+	policy := s.lockout
+
+	failures, err := s.attempts.RecordFailure(lockoutEmailKey(email), policy.Window)
+	if err != nil {
+		logger.Error("Failed to record login failure:", err)
+		return
+	}
+
+	if failures >= int64(policy.MaxAttempts) {
+		if err := s.attempts.Lock(lockoutEmailKey(email), policy.Duration); err != nil {
+			logger.Error("Failed to lock account:", err)
+		}
+		logger.SecurityEvent("account_locked", logrus.Fields{
+			"email":      email,
+			"failures":   failures,
+			"client_ip":  meta.IP,
+			"user_agent": meta.UserAgent,
+			"duration":   policy.Duration.String(),
+		})
+	} else if delay := policy.delay(failures); delay > 0 {
+		if err := s.attempts.Lock(lockoutDelayKey(email), delay); err != nil {
+			logger.Error("Failed to throttle login:", err)
+		}
+	}
+
+	if meta.IP == "" {
+		return
+	}
+
+	ipFailures, err := s.attempts.RecordFailure(lockoutIPKey(meta.IP), policy.Window)
+	if err != nil {
+		logger.Error("Failed to record login failure:", err)
+		return
+	}
+	if ipFailures >= int64(policy.IPMaxAttempts) {
+		if err := s.attempts.Lock(lockoutIPKey(meta.IP), policy.Duration); err != nil {
+			logger.Error("Failed to lock IP:", err)
+		}
+		logger.SecurityEvent("ip_locked", logrus.Fields{
+			"failures":  ipFailures,
+			"client_ip": meta.IP,
+			"duration":  policy.Duration.String(),
+		})
+	}
+}
+
+// recordMFAFailure counts a wrong second-factor code as a failed login, and
+// also under its own key. A correct password resets the login count but not
+// that one, so logging in again does not buy more guesses at the code.
+func (s *Service) recordMFAFailure(email string, meta RequestMeta) {
+	s.recordLoginFailure(email, meta)
+
+	policy := s.lockout
+	failures, err := s.attempts.RecordFailure(lockoutMFAKey(email), policy.Window)
+	if err != nil {
+		logger.Error("Failed to record MFA failure:", err)
+		return
+	}
+	if failures >= int64(policy.MaxAttempts) {
+		if err := s.attempts.Lock(lockoutMFAKey(email), policy.Duration); err != nil {
+			logger.Error("Failed to lock second factor:", err)
+		}
+		logger.SecurityEvent("mfa_locked", logrus.Fields{
+			"email":      email,
+			"failures":   failures,
+			"client_ip":  meta.IP,
+			"user_agent": meta.UserAgent,
+			"duration":   policy.Duration.String(),
+		})
+	}
+}
+
+// resetLoginFailures clears the failure count of an email after a successful
+// login. The IP count is kept so a valid account cannot be used to reset it.
+func (s *Service) resetLoginFailures(email string) {
+	if err := s.attempts.Reset(lockoutEmailKey(email)); err != nil {
+		logger.Error("Failed to reset login failures:", err)
+	}
+	if err := s.attempts.Reset(lockoutDelayKey(email)); err != nil {
+		logger.Error("Failed to reset login failures:", err)
+	}
+}
+
+// resetMFAFailures clears the second-factor failure count of an email after
+// a correct code
+func (s *Service) resetMFAFailures(email string) {
+	if err := s.attempts.Reset(lockoutMFAKey(email)); err != nil {
+		logger.Error("Failed to reset MFA failures:", err)
+	}
+}
+
+// UnlockAccount lifts a lockout of a user's account (admin only)
+func (s *Service) UnlockAccount(adminID, userID uint) error {
+	foundUser, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+
+	s.resetLoginFailures(normalizeEmail(foundUser.Email))
+	s.resetMFAFailures(normalizeEmail(foundUser.Email))
+
+	logger.SecurityEvent("account_unlocked", logrus.Fields{
+		"user_id":  foundUser.ID,
+		"admin_id": adminID,
+	})
+	return nil
+}
+
+// normalizeEmail makes lockout keys case-insensitive
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func lockoutEmailKey(email string) string {
+	return "login:email:" + email
+}
+
+func lockoutDelayKey(email string) string {
+	return "login:delay:" + email
+}
+
+func lockoutIPKey(ip string) string {
+	return "login:ip:" + ip
+}
+
+func lockoutMFAKey(email string) string {
+	return "login:mfa:" + email
+}
+
+func mfaTokenKey(jti string) string {
+	return "mfa:token:" + jti
+}
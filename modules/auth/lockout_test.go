@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-fiber-gorm/core/errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockoutPolicyDelay(t *testing.T) {
+	policy := LockoutPolicy{DelayAfter: 3, MaxDelay: 30 * time.Second}
+
+	tests := []struct {
+		failures int64
+		delay    time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{7, 16 * time.Second},
+		{8, 30 * time.Second},
+		{100, 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.delay, policy.delay(tt.failures), "%d failures", tt.failures)
+	}
+}
+
+func TestLockoutPolicyDefaults(t *testing.T) {
+	policy := LockoutPolicy{}.withDefaults()
+
+	assert.Equal(t, 10, policy.MaxAttempts)
+	assert.Equal(t, 50, policy.IPMaxAttempts)
+	assert.Equal(t, 15*time.Minute, policy.Duration)
+	assert.Equal(t, policy.Duration, policy.Window)
+	assert.Equal(t, 3, policy.DelayAfter)
+	assert.Equal(t, 30*time.Second, policy.MaxDelay)
+}
+
+// login attempts a password login from the given IP
+func login(service *Service, email, password, ip string) error {
+	_, err := service.Login(&LoginRequest{Email: email, Password: password}, RequestMeta{IP: ip})
+	return err
+}
+
+func TestLoginLocksAccountAfterMaxAttempts(t *testing.T) {
+	service, _ := newTestService(t, ServiceConfig{
+		AccessExpiry: 15 * time.Minute,
+		Lockout:      LockoutPolicy{MaxAttempts: 3, DelayAfter: 100, Duration: 10 * time.Minute},
+	})
+	createTestUser(t, service, "jane@example.com")
+	createTestUser(t, service, "john@example.com")
+
+	for i := 0; i < 3; i++ {
+		err := login(service, "jane@example.com", "wrong password", "203.0.113.7")
+		assert.Equal(t, http.StatusUnauthorized, errors.StatusCode(err), "attempt %d", i+1)
+	}
+
+	// The correct password is rejected too, whatever the case of the email
+	err := login(service, "JANE@example.com", testPassword, "198.51.100.1")
+	require.Equal(t, http.StatusLocked, errors.StatusCode(err))
+	appErr := err.(*errors.AppError)
+	assert.Equal(t, "ACCOUNT_LOCKED", appErr.Code)
+	assert.InDelta(t, (10 * time.Minute).Seconds(), appErr.RetryAfter.Seconds(), 5)
+
+	// Other accounts on the same IP are not affected
+	assert.NoError(t, login(service, "john@example.com", testPassword, "203.0.113.7"))
+}
+
+func TestLoginResetsFailuresAfterSuccess(t *testing.T) {
+	service, _ := newTestService(t, ServiceConfig{
+		AccessExpiry: 15 * time.Minute,
+		Lockout:      LockoutPolicy{MaxAttempts: 3, DelayAfter: 100},
+	})
+	createTestUser(t, service, "jane@example.com")
+
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 2; i++ {
+			err := login(service, "jane@example.com", "wrong password", "203.0.113.7")
+			assert.Equal(t, http.StatusUnauthorized, errors.StatusCode(err))
+		}
+		assert.NoError(t, login(service, "jane@example.com", testPassword, "203.0.113.7"), "round %d", round+1)
+	}
+}
+
+func TestLoginLocksIPAfterMaxAttempts(t *testing.T) {
+	service, _ := newTestService(t, ServiceConfig{
+		AccessExpiry: 15 * time.Minute,
+		Lockout:      LockoutPolicy{MaxAttempts: 100, IPMaxAttempts: 3, DelayAfter: 100},
+	})
+	createTestUser(t, service, "jane@example.com")
+
+	// Failures for different emails, including unknown ones, add up per IP
+	for _, email := range []string{"a@example.com", "b@example.com", "jane@example.com"} {
+		err := login(service, email, "wrong password", "203.0.113.7")
+		assert.Equal(t, http.StatusUnauthorized, errors.StatusCode(err), email)
+	}
+
+	err := login(service, "jane@example.com", testPassword, "203.0.113.7")
+	require.Equal(t, http.StatusTooManyRequests, errors.StatusCode(err))
+	assert.Positive(t, err.(*errors.AppError).RetryAfter)
+
+	// The account itself is not locked
+	assert.NoError(t, login(service, "jane@example.com", testPassword, "198.51.100.1"))
+}
+
+func TestLoginAppliesProgressiveDelay(t *testing.T) {
+	service, _ := newTestService(t, ServiceConfig{
+		AccessExpiry: 15 * time.Minute,
+		Lockout:      LockoutPolicy{MaxAttempts: 100, DelayAfter: 2, MaxDelay: 5 * time.Second},
+	})
+	createTestUser(t, service, "jane@example.com")
+
+	require.Error(t, login(service, "jane@example.com", "wrong password", ""))
+	require.Error(t, login(service, "jane@example.com", "wrong password", ""))
+
+	// The second failure starts a one second delay
+	err := login(service, "jane@example.com", testPassword, "")
+	require.Equal(t, http.StatusTooManyRequests, errors.StatusCode(err))
+	retryAfter := err.(*errors.AppError).RetryAfter
+	assert.Positive(t, retryAfter)
+	assert.LessOrEqual(t, retryAfter, time.Second)
+
+	time.Sleep(retryAfter + 10*time.Millisecond)
+	assert.NoError(t, login(service, "jane@example.com", testPassword, ""))
+}
+
+func TestUnlockAccountLiftsLockout(t *testing.T) {
+	service, _ := newTestService(t, ServiceConfig{
+		AccessExpiry: 15 * time.Minute,
+		Lockout:      LockoutPolicy{MaxAttempts: 2, DelayAfter: 100},
+	})
+	u := createTestUser(t, service, "Jane@Example.com")
+
+	// The lock is keyed by the normalized email the admin unlock uses
+	for i := 0; i < 2; i++ {
+		require.Error(t, login(service, "jane@example.com", "wrong password", ""))
+	}
+	require.Equal(t, http.StatusLocked, errors.StatusCode(login(service, "Jane@Example.com", testPassword, "")))
+
+	require.NoError(t, service.UnlockAccount(1, u.ID))
+	assert.NoError(t, login(service, "Jane@Example.com", testPassword, ""))
+}
+
+func TestLockedLoginRespondsWithRetryAfter(t *testing.T) {
+	service, _ := newTestService(t, ServiceConfig{
+		AccessExpiry: 15 * time.Minute,
+		Lockout:      LockoutPolicy{MaxAttempts: 1, DelayAfter: 100, Duration: 90 * time.Second},
+	})
+	createTestUser(t, service, "jane@example.com")
+
+	app := fiber.New(fiber.Config{ErrorHandler: errors.ErrorHandler})
+	app.Post("/login", NewController(service).Login)
+
+	post := func(password string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, "/login",
+			strings.NewReader(`{"email":"jane@example.com","password":"`+password+`"}`))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, post("wrong password").StatusCode)
+
+	resp := post(testPassword)
+	require.Equal(t, http.StatusLocked, resp.StatusCode)
+	retryAfter, err := strconv.Atoi(resp.Header.Get(fiber.HeaderRetryAfter))
+	require.NoError(t, err)
+	assert.InDelta(t, 90, retryAfter, 1)
+}
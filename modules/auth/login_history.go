@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go-fiber-gorm/core/logger"
+	"go-fiber-gorm/core/mailer"
+	"go-fiber-gorm/modules/user"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Login methods recorded in the login history
+const (
+	LoginMethodPassword   = "password"
+	LoginMethodMFA        = "mfa"
+	LoginMethodMagicLink  = "magic_link"
+	LoginMethodPasskey    = "passkey"
+	LoginMethodRefresh    = "refresh"
+	LoginMethodRegister   = "register"
+	LoginMethodInvitation = "invitation"
+)
+
+// Reasons recorded for failed login attempts
+const (
+	LoginFailureInvalidCredentials = "invalid_credentials"
+	LoginFailureLocked             = "locked"
+	LoginFailureEmailNotVerified   = "email_not_verified"
+	LoginFailureInvalidCode        = "invalid_code"
+	LoginFailureRejected           = "rejected"
+	LoginFailureTokenReuse         = "token_reuse"
+	LoginFailureSessionRevoked     = "session_revoked"
+	LoginFailureSessionExpired     = "session_expired"
+)
+
+// loginEventPruneInterval is how often expired login events are deleted
+const loginEventPruneInterval = time.Hour
+
+// oauthLoginMethod returns the login method of an identity provider
+func oauthLoginMethod(provider string) string {
+	return "oauth:" + provider
+}
+
+// loginSucceeded records a successful login. Interactive logins from a
+// device the user has not logged in from before trigger a notification.
+// Refreshing a session never counts as a new device.
+func (s *Service) loginSucceeded(u *user.User, method string, meta RequestMeta) {
+	event := newLoginEvent(&u.ID, u.Email, method, meta)
+	event.Success = true
+
+	if method != LoginMethodRefresh {
+		event.NewDevice = s.isNewDevice(u.ID, event.DeviceFingerprint)
+	}
+
+	s.storeLoginEvent(event)
+
+	if event.NewDevice {
+		logger.SecurityEvent("login_new_device", logrus.Fields{
+			"user_id":    u.ID,
+			"method":     method,
+			"client_ip":  meta.IP,
+			"user_agent": meta.UserAgent,
+		})
+		if s.notifyNewDevices {
+			s.sendNewDeviceEmail(u, event)
+		}
+	}
+}
+
+// loginFailed records a failed login attempt. u is nil when the attempt
+// could not be tied to an account, in which case only the email is kept.
+func (s *Service) loginFailed(u *user.User, email, method, reason string, meta RequestMeta) {
+	var userID *uint
+	if u != nil {
+		userID = &u.ID
+		email = u.Email
+	}
+
+	event := newLoginEvent(userID, email, method, meta)
+	event.FailureReason = reason
+	s.storeLoginEvent(event)
+}
+
+// refreshFailed records a rejected refresh token of a known session
+func (s *Service) refreshFailed(session *Session, reason string, meta RequestMeta) {
+	event := newLoginEvent(&session.UserID, "", LoginMethodRefresh, meta)
+	event.FailureReason = reason
+	s.storeLoginEvent(event)
+}
+
+// isNewDevice reports whether a user who has logged in before has never done
+// so from the device. The first login of a user establishes their first
+// device, and devices only seen before the retention period count as new.
+func (s *Service) isNewDevice(userID uint, fingerprint string) bool {
+	seen, err := s.repo.HasSuccessfulLogin(userID, fingerprint)
+	if err != nil {
+		logger.Error("Failed to check login device:", err)
+		return false
+	}
+	if seen {
+		return false
+	}
+
+	known, err := s.repo.HasSuccessfulLogin(userID, "")
+	if err != nil {
+		logger.Error("Failed to check login history:", err)
+		return false
+	}
+	return known
+}
+
+// storeLoginEvent saves a login event. The history is best effort and never
+// fails the login itself.
+func (s *Service) storeLoginEvent(event *LoginEvent) {
+	if err := s.repo.CreateLoginEvent(event); err != nil {
+		logger.Error("Failed to record login event:", err)
+	}
+}
+
+// sendNewDeviceEmail queues a notification about a login from a new device
+func (s *Service) sendNewDeviceEmail(u *user.User, event *LoginEvent) {
+	device := event.UserAgent
+	if event.DeviceName != "" {
+		device = event.DeviceName + " (" + event.UserAgent + ")"
+	}
+
+	msg := &mailer.Message{
+		To:      u.Email,
+		Subject: "New sign-in to your account",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nYour account was just signed in to from a device we have not seen before.\n\nTime: %s\nDevice: %s\nIP address: %s\nMethod: %s\n\nIf this was you, you can ignore this email. If not, change your password and sign out of all sessions right away.\n",
+			u.Name, event.CreatedAt.UTC().Format(time.RFC1123), device, event.ClientIP, event.Method,
+		),
+	}
+
+	if err := s.mailQueue.Send(msg); err != nil {
+		logger.Error("Failed to send new device notification:", err)
+	}
+}
+
+// LoginHistory returns the login events of a user, newest first, with pagination
+func (s *Service) LoginHistory(userID uint, page, limit int) ([]LoginEventResponse, int64, error) {
+	events, count, err := s.repo.FindUserLoginEvents(userID, page, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	responses := make([]LoginEventResponse, 0, len(events))
+	for _, event := range events {
+		responses = append(responses, LoginEventResponse{
+			ID:            event.ID,
+			CreatedAt:     event.CreatedAt,
+			Method:        event.Method,
+			Success:       event.Success,
+			FailureReason: event.FailureReason,
+			ClientIP:      event.ClientIP,
+			UserAgent:     event.UserAgent,
+			DeviceName:    event.DeviceName,
+			NewDevice:     event.NewDevice,
+		})
+	}
+
+	return responses, count, nil
+}
+
+// PruneLoginEvents deletes login events older than the retention period
+func (s *Service) PruneLoginEvents() error {
+	deleted, err := s.repo.DeleteLoginEventsBefore(time.Now().Add(-s.loginHistoryRetention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logger.Info("Pruned", deleted, "login events")
+	}
+	return nil
+}
+
+// StartLoginEventPruning prunes expired login events in the background until
+// the process exits
+func (s *Service) StartLoginEventPruning() {
+	go func() {
+		ticker := time.NewTicker(loginEventPruneInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.PruneLoginEvents(); err != nil {
+				logger.Error("Failed to prune login events:", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// newLoginEvent builds a login event with the client details of a request
+func newLoginEvent(userID *uint, email, method string, meta RequestMeta) *LoginEvent {
+	return &LoginEvent{
+		CreatedAt:         time.Now(),
+		UserID:            userID,
+		Email:             truncate(normalizeEmail(email), 255),
+		Method:            truncate(method, 50),
+		ClientIP:          truncate(valueOr(meta.IP, "Not provided"), 100),
+		UserAgent:         truncate(valueOr(meta.UserAgent, "Not provided"), 255),
+		DeviceName:        truncate(meta.DeviceName, 100),
+		DeviceFingerprint: deviceFingerprint(meta),
+	}
+}
+
+// deviceFingerprint identifies the device a request comes from by its user
+// agent and the name the client gave it. The IP address is left out so that
+// moving between networks does not look like a new device.
+func deviceFingerprint(meta RequestMeta) string {
+	sum := sha256.Sum256([]byte(meta.UserAgent + "\n" + meta.DeviceName))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"fmt"
+	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/core/logger"
+	"go-fiber-gorm/core/mailer"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// magicLinkMaxSends limits how many links are mailed to one address per window
+	magicLinkMaxSends = 5
+	// magicLinkSendWindow is the period in which sent links are counted
+	magicLinkSendWindow = 15 * time.Minute
+)
+
+// SendMagicLink emails a single-use sign-in link. Unknown emails are
+// ignored so the response does not reveal which accounts exist.
+func (s *Service) SendMagicLink(req *MagicLinkRequest) error {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return errors.NewValidationError(err)
+	}
+
+	foundUser, err := s.userRepo.FindByEmail(req.Email)
+	if err != nil {
+		return nil
+	}
+
+	// Stop the endpoint from being used to flood an inbox
+	sent, err := s.store.Increment(magicLinkSendKey(normalizeEmail(foundUser.Email)), magicLinkSendWindow)
+	if err != nil {
+		logger.Error("Failed to count magic links:", err)
+	} else if sent > magicLinkMaxSends {
+		return nil
+	}
+
+	token, err := s.signPurposeToken(purposeMagicLink, jwt.MapClaims{
+		"user_id": foundUser.ID,
+		"email":   foundUser.Email,
+		"jti":     generateUUID(),
+	}, s.magicLinkExpiry)
+	if err != nil {
+		logger.Error("Failed to generate sign-in link:", err)
+		return nil
+	}
+
+	msg := &mailer.Message{
+		To:      foundUser.Email,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse the link below to sign in. It expires in %s and can only be used once.\n\n%s\n\nIf you did not request this link, you can ignore this email.\n",
+			foundUser.Name, s.magicLinkExpiry, s.buildLink(s.magicLinkURL, token),
+		),
+	}
+
+	// Delivery errors are only logged; failing here would reveal the account
+	if err := s.mailQueue.Send(msg); err != nil {
+		logger.Error("Failed to send magic link email:", err)
+	}
+
+	return nil
+}
+
+// VerifyMagicLink signs a user in with a magic link token. Opening the link
+// proves control of the mailbox, so the email is marked as verified.
+func (s *Service) VerifyMagicLink(req *MagicLinkVerifyRequest, meta RequestMeta) (*LoginResponse, error) {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return nil, errors.NewValidationError(err)
+	}
+
+	claims, err := s.parsePurposeToken(purposeMagicLink, req.Token)
+	if err != nil {
+		return nil, errors.NewUnauthorizedError("Invalid or expired sign-in link")
+	}
+
+	userID, _ := claims["user_id"].(float64)
+	email, _ := claims["email"].(string)
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+	if jti == "" {
+		return nil, errors.NewUnauthorizedError("Invalid or expired sign-in link")
+	}
+
+	// The first use marks the link as spent until it would have expired anyway
+	uses, err := s.store.Increment(magicLinkUsedKey(jti), time.Until(time.Unix(int64(exp), 0)))
+	if err != nil {
+		return nil, errors.NewInternalServerError("Failed to verify sign-in link")
+	}
+	if uses > 1 {
+		logger.SecurityEvent("magic_link_reused", logrus.Fields{
+			"user_id":    uint(userID),
+			"client_ip":  meta.IP,
+			"user_agent": meta.UserAgent,
+		})
+		return nil, errors.NewUnauthorizedError("Invalid or expired sign-in link")
+	}
+
+	// Links are bound to the address they were sent to
+	foundUser, err := s.userRepo.FindByID(uint(userID))
+	if err != nil || foundUser.Email != email {
+		return nil, errors.NewUnauthorizedError("Invalid or expired sign-in link")
+	}
+
+	if !foundUser.IsEmailVerified() {
+		now := time.Now()
+		foundUser.EmailVerifiedAt = &now
+		if err := s.userRepo.Update(foundUser); err != nil {
+			return nil, errors.NewInternalServerError("Failed to update user")
+		}
+	}
+
+	return s.completeLogin(foundUser, LoginMethodMagicLink, meta)
+}
+
+func magicLinkSendKey(email string) string {
+	return "magiclink:sent:" + email
+}
+
+func magicLinkUsedKey(jti string) string {
+	return "magiclink:used:" + jti
+}
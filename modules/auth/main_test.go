@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"go-fiber-gorm/core/logger"
+	"go-fiber-gorm/modules/user"
+	"go-fiber-gorm/test"
+
+	"gorm.io/gorm"
+)
+
+// testPassword is the password of users created by createTestUser
+const testPassword = "correct horse battery staple"
+
+func TestMain(m *testing.M) {
+	logger.Setup("testing")
+	os.Exit(m.Run())
+}
+
+// newTestService creates a service backed by an in-memory database. Unset
+// secrets and the password hasher are filled in with test values.
+func newTestService(t *testing.T, config ServiceConfig) (*Service, *gorm.DB) {
+	t.Helper()
+
+	db := test.NewTestDB(t,
+		&user.User{},
+		&Session{},
+		&TOTPFactor{},
+		&RecoveryCode{},
+		&OAuthIdentity{},
+		&WebAuthnCredential{},
+		&LoginEvent{},
+	)
+
+	if config.JWTSecret == "" {
+		config.JWTSecret = "test-secret"
+	}
+	if config.PasswordHasher == nil {
+		// Cheap parameters keep the tests fast
+		config.PasswordHasher = user.NewPasswordHasher(user.Argon2Params{Memory: 64, Iterations: 1})
+	}
+
+	return NewService(NewRepository(db), user.NewRepository(db), config), db
+}
+
+// createTestUser stores a user with a verified email
+func createTestUser(t *testing.T, service *Service, email string) *user.User {
+	t.Helper()
+
+	hashedPassword, err := service.passwords.Hash(testPassword)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	now := time.Now()
+	u := &user.User{Name: "Test User", Email: email, Password: hashedPassword, Role: "user", EmailVerifiedAt: &now}
+	if err := service.userRepo.Create(u); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	return u
+}
@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"crypto/rand"
+	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/core/logger"
+	"go-fiber-gorm/modules/user"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	mfaTokenExpiry      = 5 * time.Minute
+	mfaTokenMaxFailures = 5 // Wrong codes after which an MFA token stops working
+	recoveryCodeCount   = 10
+)
+
+// EnrollTOTP creates a new unconfirmed TOTP factor for the user
+func (s *Service) EnrollTOTP(userID uint) (*MFAEnrollResponse, error) {
+	foundUser, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	factor, err := s.repo.FindTOTPFactor(userID)
+	if err == nil && factor.IsConfirmed() {
+		return nil, errors.NewBadRequestError("Two-factor authentication is already enabled")
+	}
+	if err != nil {
+		// No factor yet
+		factor = &TOTPFactor{UserID: userID}
+	}
+
+	// Start over with a fresh secret on every enrollment attempt
+	factor.Secret = generateTOTPSecret()
+	factor.LastUsedStep = 0
+	if err := s.repo.SaveTOTPFactor(factor); err != nil {
+		return nil, errors.NewInternalServerError("Failed to save TOTP factor")
+	}
+
+	return &MFAEnrollResponse{
+		Secret:     factor.Secret,
+		OTPAuthURI: totpURI(s.mfaIssuer, foundUser.Email, factor.Secret),
+	}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proves their
+// authenticator app produces valid codes. It returns the recovery codes.
+func (s *Service) ConfirmTOTP(userID uint, req *MFACodeRequest) (*RecoveryCodesResponse, error) {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return nil, errors.NewValidationError(err)
+	}
+
+	factor, err := s.repo.FindTOTPFactor(userID)
+	if err != nil {
+		return nil, errors.NewBadRequestError("Two-factor authentication enrollment has not been started")
+	}
+	if factor.IsConfirmed() {
+		return nil, errors.NewBadRequestError("Two-factor authentication is already enabled")
+	}
+
+	step, ok := validateTOTP(factor.Secret, req.Code, time.Now())
+	if !ok {
+		return nil, errors.NewBadRequestError("Invalid verification code")
+	}
+
+	now := time.Now()
+	factor.ConfirmedAt = &now
+	factor.LastUsedStep = step
+	if err := s.repo.SaveTOTPFactor(factor); err != nil {
+		return nil, errors.NewInternalServerError("Failed to confirm TOTP factor")
+	}
+
+	return s.generateRecoveryCodes(userID)
+}
+
+// DisableTOTP disables two-factor authentication for the user
+func (s *Service) DisableTOTP(userID uint, req *MFADisableRequest, meta RequestMeta) error {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return errors.NewValidationError(err)
+	}
+
+	foundUser, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.confirmPasswordAndCode(foundUser, req.Password, req.Code, meta); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteTOTPFactor(userID); err != nil {
+		return errors.NewInternalServerError("Failed to disable two-factor authentication")
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes with new ones
+func (s *Service) RegenerateRecoveryCodes(userID uint, req *RecoveryCodesRequest, meta RequestMeta) (*RecoveryCodesResponse, error) {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return nil, errors.NewValidationError(err)
+	}
+
+	foundUser, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.confirmPasswordAndCode(foundUser, req.Password, req.Code, meta); err != nil {
+		return nil, err
+	}
+
+	return s.generateRecoveryCodes(userID)
+}
+
+// confirmPasswordAndCode verifies the password and second factor of a
+// signed-in user before their second factor is changed. Failures count
+// towards the same lockouts as a login, so a stolen access token cannot be
+// used to guess codes.
+func (s *Service) confirmPasswordAndCode(u *user.User, password, code string, meta RequestMeta) error {
+	email := normalizeEmail(u.Email)
+	if err := s.checkLoginAllowed(email, meta.IP); err != nil {
+		return err
+	}
+
+	if valid, _ := s.verifyPassword(u, password); !valid {
+		s.recordLoginFailure(email, meta)
+		return errors.NewBadRequestError("Current password is incorrect")
+	}
+
+	if err := s.confirmSecondFactor(u, code, meta); err != nil {
+		return err
+	}
+	s.resetLoginFailures(email)
+	return nil
+}
+
+// confirmSecondFactor verifies a code of a signed-in user. Wrong codes count
+// towards the login lockout and the lockout of the second factor.
+func (s *Service) confirmSecondFactor(u *user.User, code string, meta RequestMeta) error {
+	email := normalizeEmail(u.Email)
+	if err := s.checkMFAAllowed(email, meta.IP); err != nil {
+		return err
+	}
+
+	if err := s.verifySecondFactor(u.ID, code); err != nil {
+		if errors.StatusCode(err) == http.StatusUnauthorized {
+			s.recordMFAFailure(email, meta)
+		}
+		return err
+	}
+	s.resetMFAFailures(email)
+	return nil
+}
+
+// VerifyMFA completes a login that is waiting for a second factor. Wrong
+// codes count towards the login lockout and a lockout of the second factor
+// that a correct password does not lift, and an MFA token stops working
+// after a few wrong codes.
+func (s *Service) VerifyMFA(req *MFAVerifyRequest, meta RequestMeta) (*AuthResponse, error) {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return nil, errors.NewValidationError(err)
+	}
+
+	claims, err := s.parsePurposeToken(purposeMFAPending, req.MFAToken)
+	if err != nil {
+		return nil, errors.NewUnauthorizedError("Invalid or expired MFA token")
+	}
+
+	userID, _ := claims["user_id"].(float64)
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+	if jti == "" {
+		return nil, errors.NewUnauthorizedError("Invalid or expired MFA token")
+	}
+	if _, spent := s.attempts.LockedFor(mfaTokenKey(jti)); spent {
+		return nil, errors.NewUnauthorizedError("Invalid or expired MFA token")
+	}
+
+	foundUser, err := s.userRepo.FindByID(uint(userID))
+	if err != nil {
+		return nil, errors.NewUnauthorizedError("Invalid or expired MFA token")
+	}
+
+	email := normalizeEmail(foundUser.Email)
+	if err := s.checkMFAAllowed(email, meta.IP); err != nil {
+		return nil, err
+	}
+
+	// The login is recorded under the method of the first factor
+	method, _ := claims["method"].(string)
+	if method == "" {
+		method = LoginMethodMFA
+	}
+
+	if err := s.verifySecondFactor(foundUser.ID, req.Code); err != nil {
+		if errors.StatusCode(err) == http.StatusUnauthorized {
+			s.recordMFAFailure(email, meta)
+			s.recordMFATokenFailure(jti, time.Until(time.Unix(int64(exp), 0)))
+			s.loginFailed(foundUser, "", method, LoginFailureInvalidCode, meta)
+		}
+		return nil, err
+	}
+	s.resetLoginFailures(email)
+	s.resetMFAFailures(email)
+
+	return s.startSession(foundUser, method, meta)
+}
+
+// recordMFATokenFailure counts a wrong code entered with an MFA token and
+// invalidates the token once mfaTokenMaxFailures is reached
+func (s *Service) recordMFATokenFailure(jti string, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	failures, err := s.attempts.RecordFailure(mfaTokenKey(jti), ttl)
+	if err != nil {
+		logger.Error("Failed to record MFA failure:", err)
+		return
+	}
+	if failures >= mfaTokenMaxFailures {
+		if err := s.attempts.Lock(mfaTokenKey(jti), ttl); err != nil {
+			logger.Error("Failed to invalidate MFA token:", err)
+		}
+	}
+}
+
+// startMFAChallenge issues the short-lived token for the second login step.
+// method is the login method that verified the first factor.
+func (s *Service) startMFAChallenge(u *user.User, method string) (*LoginResponse, error) {
+	token, err := s.signPurposeToken(purposeMFAPending, jwt.MapClaims{
+		"user_id": u.ID,
+		"method":  method,
+		"jti":     generateUUID(),
+	}, mfaTokenExpiry)
+	if err != nil {
+		return nil, errors.NewInternalServerError("Failed to generate MFA token")
+	}
+
+	return &LoginResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   int64(mfaTokenExpiry.Seconds()),
+	}, nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code
+func (s *Service) verifySecondFactor(userID uint, code string) error {
+	factor, err := s.repo.FindTOTPFactor(userID)
+	if err != nil || !factor.IsConfirmed() {
+		return errors.NewBadRequestError("Two-factor authentication is not enabled")
+	}
+
+	if step, ok := validateTOTP(factor.Secret, code, time.Now()); ok {
+		advanced, err := s.repo.AdvanceTOTPStep(factor.ID, step)
+		if err != nil {
+			return errors.NewInternalServerError("Failed to verify code")
+		}
+		if !advanced {
+			return errors.NewUnauthorizedError("Verification code has already been used")
+		}
+		return nil
+	}
+
+	consumed, err := s.repo.ConsumeRecoveryCode(userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return errors.NewInternalServerError("Failed to verify code")
+	}
+	if !consumed {
+		return errors.NewUnauthorizedError("Invalid verification code")
+	}
+
+	return nil
+}
+
+// generateRecoveryCodes creates and stores a new set of recovery codes
+func (s *Service) generateRecoveryCodes(userID uint) (*RecoveryCodesResponse, error) {
+	codes := make([]string, recoveryCodeCount)
+	records := make([]RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		codes[i] = generateRecoveryCode()
+		records[i] = RecoveryCode{
+			UserID:   userID,
+			CodeHash: hashToken(normalizeRecoveryCode(codes[i])),
+		}
+	}
+
+	if err := s.repo.ReplaceRecoveryCodes(userID, records); err != nil {
+		return nil, errors.NewInternalServerError("Failed to save recovery codes")
+	}
+
+	return &RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// generateRecoveryCode generates a code in the form "xxxxx-xxxxx"
+func generateRecoveryCode() string {
+	b := make([]byte, 7)
+	_, _ = rand.Read(b)
+	code := strings.ToLower(totpEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:]
+}
+
+// normalizeRecoveryCode makes recovery codes case and separator insensitive
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
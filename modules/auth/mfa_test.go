@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/modules/user"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTPCodeMatchesRFC6238Vectors(t *testing.T) {
+	// The SHA-1 seed of RFC 6238 appendix B; the expected values are the
+	// last six digits of the eight-digit codes listed there
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := totpCode(secret, tt.unix/totpPeriod)
+		require.NoError(t, err)
+		assert.Equal(t, tt.code, code, "T=%d", tt.unix)
+
+		step, ok := validateTOTP(secret, tt.code, time.Unix(tt.unix, 0))
+		assert.True(t, ok, "T=%d", tt.unix)
+		assert.Equal(t, tt.unix/totpPeriod, step)
+	}
+}
+
+func TestValidateTOTPAcceptsOneStepOfSkew(t *testing.T) {
+	secret := generateTOTPSecret()
+	now := time.Unix(1700000000, 0)
+	current := now.Unix() / totpPeriod
+
+	for offset, want := range map[int64]bool{-2: false, -1: true, 0: true, 1: true, 2: false} {
+		code, err := totpCode(secret, current+offset)
+		require.NoError(t, err)
+
+		_, ok := validateTOTP(secret, code, now)
+		assert.Equal(t, want, ok, "offset %d", offset)
+	}
+
+	_, ok := validateTOTP(secret, "12345", now)
+	assert.False(t, ok, "codes must have six digits")
+}
+
+// newMFATestService creates a service with the given lockout policy and a
+// user with TOTP enabled. It returns the user's recovery codes.
+func newMFATestService(t *testing.T, lockout LockoutPolicy) (*Service, *user.User, []string) {
+	t.Helper()
+
+	service, _ := newTestService(t, ServiceConfig{AccessExpiry: 15 * time.Minute, Lockout: lockout})
+	u := createTestUser(t, service, "jane@example.com")
+
+	enrollment, err := service.EnrollTOTP(u.ID)
+	require.NoError(t, err)
+	code, err := totpCode(enrollment.Secret, time.Now().Unix()/totpPeriod)
+	require.NoError(t, err)
+
+	recovery, err := service.ConfirmTOTP(u.ID, &MFACodeRequest{Code: code})
+	require.NoError(t, err)
+	return service, u, recovery.RecoveryCodes
+}
+
+func TestDisableTOTPLocksAfterWrongCodes(t *testing.T) {
+	service, u, recoveryCodes := newMFATestService(t, LockoutPolicy{MaxAttempts: 3, DelayAfter: 100})
+	meta := RequestMeta{IP: "203.0.113.7"}
+
+	for i := 0; i < 3; i++ {
+		err := service.DisableTOTP(u.ID, &MFADisableRequest{Password: testPassword, Code: "000000"}, meta)
+		assert.Equal(t, http.StatusUnauthorized, errors.StatusCode(err), "attempt %d", i+1)
+	}
+
+	// A valid code no longer helps while the account is locked
+	err := service.DisableTOTP(u.ID, &MFADisableRequest{Password: testPassword, Code: recoveryCodes[0]}, meta)
+	require.Equal(t, http.StatusLocked, errors.StatusCode(err))
+	assert.Positive(t, err.(*errors.AppError).RetryAfter)
+
+	_, err = service.repo.FindTOTPFactor(u.ID)
+	assert.NoError(t, err, "two-factor authentication must stay enabled")
+}
+
+func TestDisableTOTPCountsWrongPasswords(t *testing.T) {
+	service, u, recoveryCodes := newMFATestService(t, LockoutPolicy{MaxAttempts: 2, DelayAfter: 100})
+
+	for i := 0; i < 2; i++ {
+		err := service.DisableTOTP(u.ID, &MFADisableRequest{Password: "wrong password", Code: recoveryCodes[0]}, RequestMeta{})
+		assert.Equal(t, http.StatusBadRequest, errors.StatusCode(err), "attempt %d", i+1)
+	}
+
+	err := service.DisableTOTP(u.ID, &MFADisableRequest{Password: testPassword, Code: recoveryCodes[0]}, RequestMeta{})
+	assert.Equal(t, http.StatusLocked, errors.StatusCode(err))
+}
+
+func TestRegenerateRecoveryCodesRequiresPasswordAndCode(t *testing.T) {
+	service, u, recoveryCodes := newMFATestService(t, LockoutPolicy{MaxAttempts: 3, DelayAfter: 100})
+
+	_, err := service.RegenerateRecoveryCodes(u.ID, &RecoveryCodesRequest{Code: recoveryCodes[0]}, RequestMeta{})
+	assert.Equal(t, http.StatusBadRequest, errors.StatusCode(err), "the password is required")
+
+	_, err = service.RegenerateRecoveryCodes(u.ID, &RecoveryCodesRequest{Password: "wrong password", Code: recoveryCodes[0]}, RequestMeta{})
+	assert.Equal(t, http.StatusBadRequest, errors.StatusCode(err))
+
+	result, err := service.RegenerateRecoveryCodes(u.ID, &RecoveryCodesRequest{Password: testPassword, Code: recoveryCodes[0]}, RequestMeta{})
+	require.NoError(t, err)
+	assert.Len(t, result.RecoveryCodes, recoveryCodeCount)
+
+	// The old codes stopped working
+	_, err = service.RegenerateRecoveryCodes(u.ID, &RecoveryCodesRequest{Password: testPassword, Code: recoveryCodes[1]}, RequestMeta{})
+	assert.Equal(t, http.StatusUnauthorized, errors.StatusCode(err))
+}
+
+func TestRegenerateRecoveryCodesLocksAfterWrongCodes(t *testing.T) {
+	service, u, recoveryCodes := newMFATestService(t, LockoutPolicy{MaxAttempts: 3, DelayAfter: 100})
+
+	for i := 0; i < 3; i++ {
+		_, err := service.RegenerateRecoveryCodes(u.ID, &RecoveryCodesRequest{Password: testPassword, Code: "000000"}, RequestMeta{})
+		assert.Equal(t, http.StatusUnauthorized, errors.StatusCode(err), "attempt %d", i+1)
+	}
+
+	_, err := service.RegenerateRecoveryCodes(u.ID, &RecoveryCodesRequest{Password: testPassword, Code: recoveryCodes[0]}, RequestMeta{})
+	assert.Equal(t, http.StatusLocked, errors.StatusCode(err))
+}
+
+func TestVerifyMFAInvalidatesTokenAfterWrongCodes(t *testing.T) {
+	service, u, recoveryCodes := newMFATestService(t, LockoutPolicy{MaxAttempts: 20, DelayAfter: 100})
+
+	login, err := service.Login(&LoginRequest{Email: u.Email, Password: testPassword}, RequestMeta{})
+	require.NoError(t, err)
+	require.True(t, login.MFARequired)
+
+	for i := 0; i < mfaTokenMaxFailures; i++ {
+		_, err := service.VerifyMFA(&MFAVerifyRequest{MFAToken: login.MFAToken, Code: "000000"}, RequestMeta{})
+		assert.Equal(t, http.StatusUnauthorized, errors.StatusCode(err), "attempt %d", i+1)
+	}
+
+	_, err = service.VerifyMFA(&MFAVerifyRequest{MFAToken: login.MFAToken, Code: recoveryCodes[0]}, RequestMeta{})
+	assert.Equal(t, http.StatusUnauthorized, errors.StatusCode(err), "the token is spent")
+
+	// A new login gets a fresh token
+	login, err = service.Login(&LoginRequest{Email: u.Email, Password: testPassword}, RequestMeta{})
+	require.NoError(t, err)
+	result, err := service.VerifyMFA(&MFAVerifyRequest{MFAToken: login.MFAToken, Code: recoveryCodes[0]}, RequestMeta{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, result.Token.AccessToken)
+}
+
+func TestVerifyMFAFailuresSurviveCorrectPassword(t *testing.T) {
+	service, u, recoveryCodes := newMFATestService(t, LockoutPolicy{MaxAttempts: 3, DelayAfter: 100})
+
+	// Logging in again resets the password count but not the code count
+	for i := 0; i < 3; i++ {
+		login, err := service.Login(&LoginRequest{Email: u.Email, Password: testPassword}, RequestMeta{})
+		require.NoError(t, err, "attempt %d", i+1)
+
+		_, err = service.VerifyMFA(&MFAVerifyRequest{MFAToken: login.MFAToken, Code: "000000"}, RequestMeta{})
+		assert.Equal(t, http.StatusUnauthorized, errors.StatusCode(err), "attempt %d", i+1)
+	}
+
+	// The password still works, but the second factor is locked
+	login, err := service.Login(&LoginRequest{Email: u.Email, Password: testPassword}, RequestMeta{})
+	require.NoError(t, err)
+
+	_, err = service.VerifyMFA(&MFAVerifyRequest{MFAToken: login.MFAToken, Code: recoveryCodes[0]}, RequestMeta{})
+	assert.Equal(t, http.StatusLocked, errors.StatusCode(err))
+
+	// An admin unlock lifts it
+	require.NoError(t, service.UnlockAccount(1, u.ID))
+	_, err = service.VerifyMFA(&MFAVerifyRequest{MFAToken: login.MFAToken, Code: recoveryCodes[0]}, RequestMeta{})
+	assert.NoError(t, err)
+}
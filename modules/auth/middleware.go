@@ -2,7 +2,10 @@ package auth
 
 import (
 	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/core/middleware"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -22,54 +25,317 @@ func NewMiddleware(service *Service) *Middleware {
 // Protected ensures the request is authenticated
 func (m *Middleware) Protected() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		// Get the Authorization header
-		authHeader := ctx.Get("Authorization")
-		if authHeader == "" {
-			return errors.NewUnauthorizedError("Authorization header is missing")
+		if err := m.authenticate(ctx); err != nil {
+			return err
+		}
+
+		return ctx.Next()
+	}
+}
+
+// SessionRequired ensures the request is authenticated with a user's access
+// token. API keys are rejected, so they cannot manage the account or mint
+// further keys.
+func (m *Middleware) SessionRequired() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if err := m.requireSession(ctx); err != nil {
+			return err
+		}
+
+		return ctx.Next()
+	}
+}
+
+// OwnerRequired is SessionRequired for actions only the account owner may
+// take, such as changing the password: impersonation tokens are rejected too.
+func (m *Middleware) OwnerRequired() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if err := m.requireSession(ctx); err != nil {
+			return err
 		}
 
-		// Check the format
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			return errors.NewUnauthorizedError("Authorization header format must be 'Bearer {token}'")
+		if _, ok := ctx.Locals("actor").(*Actor); ok {
+			return errImpersonationForbidden
 		}
 
-		// Validate the token
-		tokenString := parts[1]
-		claims, err := m.service.ValidateToken(tokenString)
+		return ctx.Next()
+	}
+}
+
+// NoImpersonation rejects impersonation tokens on routes that change
+// credentials or email addresses, where acting as the user would allow an
+// account takeover. Unlike OwnerRequired it accepts API keys.
+func (m *Middleware) NoImpersonation() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if err := m.authenticate(ctx); err != nil {
+			return err
+		}
+
+		if _, ok := ctx.Locals("actor").(*Actor); ok {
+			return errImpersonationForbidden
+		}
+
+		return ctx.Next()
+	}
+}
+
+// AuditImpersonation writes every request made with an impersonation token
+// to the audit log, including the response status. Register it before the
+// routes it should cover.
+func (m *Middleware) AuditImpersonation() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		err := ctx.Next()
+
+		if _, ok := ctx.Locals("actor").(*Actor); !ok {
+			return err
+		}
+		claims, claimsErr := GetAuthUser(ctx)
+		if claimsErr != nil {
+			return err
+		}
+
+		status := ctx.Response().StatusCode()
 		if err != nil {
+			status = errors.StatusCode(err)
+		}
+
+		path := ctx.Path()
+		if len(path) > 255 {
+			path = path[:255]
+		}
+
+		m.service.RecordImpersonatedRequest(claims, ctx.Method(), path, status, requestMeta(ctx))
+		return err
+	}
+}
+
+// RequireRecentAuth ensures the user proved their identity within maxAge, by
+// logging in or through POST /auth/reauth, before a sensitive operation.
+// Otherwise it returns 401 REAUTHENTICATION_REQUIRED so the client knows to
+// prompt. API keys and client tokens are rejected, as they cannot
+// re-authenticate.
+func (m *Middleware) RequireRecentAuth(maxAge time.Duration) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if err := m.requireSession(ctx); err != nil {
 			return err
 		}
 
-		// Store user info in context
-		ctx.Locals("userID", claims.UserID)
-		ctx.Locals("userEmail", claims.Email)
-		ctx.Locals("userRole", claims.Role)
+		authTime, _ := ctx.Locals("authTime").(int64)
+		if authTime == 0 || time.Since(time.Unix(authTime, 0)) > maxAge {
+			ctx.Set(fiber.HeaderWWWAuthenticate, reauthChallenge(maxAge))
+			return errReauthenticationRequired(maxAge)
+		}
 
 		return ctx.Next()
 	}
 }
 
-// RoleRequired ensures the authenticated user has the required role
-func (m *Middleware) RoleRequired(role string) fiber.Handler {
+// RoleRequired ensures the authenticated user has at least one of the roles
+func (m *Middleware) RoleRequired(roles ...string) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		// First check if user is authenticated
-		if err := m.Protected()(ctx); err != nil {
+		if err := m.authenticate(ctx); err != nil {
 			return err
 		}
 
-		// Check if user has the required role
-		userRole, ok := ctx.Locals("userRole").(string)
-		if !ok || userRole != role {
-			return errors.NewForbiddenError("You don't have permission to access this resource")
+		grants, err := m.grants(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Check if user has one of the required roles
+		for _, role := range roles {
+			if grants.HasRole(role) {
+				return ctx.Next()
+			}
+		}
+
+		return errors.NewForbiddenError("You don't have permission to access this resource")
+	}
+}
+
+// RequirePermission ensures the authenticated user has all of the permissions
+func (m *Middleware) RequirePermission(permissions ...string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if err := m.authenticate(ctx); err != nil {
+			return err
+		}
+
+		grants, err := m.grants(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, permission := range permissions {
+			if !grants.HasPermission(permission) {
+				return errors.NewForbiddenError("You don't have permission to access this resource")
+			}
 		}
 
 		return ctx.Next()
 	}
 }
 
-// GetAuthUser extracts the authenticated user from the context
+// requireSession authenticates the request and rejects API keys
+func (m *Middleware) requireSession(ctx *fiber.Ctx) error {
+	if err := m.authenticate(ctx); err != nil {
+		return err
+	}
+
+	if _, ok := ctx.Locals("apiKeyID").(uint); ok {
+		return errors.NewForbiddenError("This endpoint cannot be used with an API key")
+	}
+	if _, ok := ctx.Locals("clientID").(string); ok {
+		return errors.NewForbiddenError("This endpoint cannot be used with a client token")
+	}
+
+	return nil
+}
+
+// RequireScope ensures the request is authenticated with a token that holds
+// all of the scopes. Users have no scopes, so this is for endpoints meant for
+// OAuth clients; combine HasScope with other rules in Authorize for
+// endpoints both may use.
+func (m *Middleware) RequireScope(scopes ...string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if err := m.authenticate(ctx); err != nil {
+			return err
+		}
+
+		granted, _ := ctx.Locals("scopes").([]string)
+		for _, scope := range scopes {
+			if !hasScope(granted, scope) {
+				ctx.Set(fiber.HeaderWWWAuthenticate, `Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+				return errors.New(http.StatusForbidden, "INSUFFICIENT_SCOPE", "The token does not have the required scope")
+			}
+		}
+
+		return ctx.Next()
+	}
+}
+
+// grants resolves the roles and permissions of the authenticated user once per request
+func (m *Middleware) grants(ctx *fiber.Ctx) (*Grants, error) {
+	if grants, ok := ctx.Locals("grants").(*Grants); ok {
+		return grants, nil
+	}
+
+	claims, err := GetAuthUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	grants, err := m.service.ResolveGrants(claims.UserID, claims.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.Locals("grants", grants)
+	return grants, nil
+}
+
+// authenticate validates the bearer token or API key and stores the user
+// info in the context. Unlike Protected it does not call the next handler,
+// so other middleware can run their own checks first.
+func (m *Middleware) authenticate(ctx *fiber.Ctx) error {
+	// API keys may be sent in their own header
+	if apiKey := ctx.Get("X-API-Key"); apiKey != "" {
+		return m.authenticateAPIKey(ctx, apiKey)
+	}
+
+	// Get the Authorization header. Browser clients using the cookie
+	// transport send the access token in a cookie instead.
+	authHeader := ctx.Get("Authorization")
+	if authHeader == "" {
+		tokenString := ctx.Cookies(AccessTokenCookie)
+		if tokenString == "" {
+			return errors.NewUnauthorizedError("Authorization header is missing")
+		}
+
+		// Cookies are sent by the browser on cross-site requests too
+		if err := verifyCSRF(ctx); err != nil {
+			return err
+		}
+
+		return m.authenticateToken(ctx, tokenString)
+	}
+
+	// Check the format
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return errors.NewUnauthorizedError("Authorization header format must be 'Bearer {token}'")
+	}
+
+	// Personal access tokens may also be sent as bearer tokens
+	tokenString := parts[1]
+	if strings.HasPrefix(tokenString, APIKeyPrefix) {
+		return m.authenticateAPIKey(ctx, tokenString)
+	}
+
+	return m.authenticateToken(ctx, tokenString)
+}
+
+// authenticateToken validates an access token and stores the user info in the context
+func (m *Middleware) authenticateToken(ctx *fiber.Ctx, tokenString string) error {
+	claims, err := m.service.ValidateToken(tokenString)
+	if err != nil {
+		return err
+	}
+
+	// Client tokens carry no user
+	if claims.IsClient() {
+		ctx.Locals("clientID", claims.ClientID)
+		ctx.Locals("scopes", claims.Scopes)
+		ctx.Locals("tokenID", claims.TokenID)
+		ctx.Locals("tokenIssuedAt", claims.IssuedAt)
+		ctx.Locals("tokenExpiresAt", claims.ExpiresAt)
+		return nil
+	}
+
+	// Store user info in context
+	ctx.Locals("userID", claims.UserID)
+	ctx.Locals("userEmail", claims.Email)
+	ctx.Locals("userRole", claims.Role)
+	ctx.Locals("sessionID", claims.SessionID)
+	ctx.Locals("tokenID", claims.TokenID)
+	ctx.Locals("tokenIssuedAt", claims.IssuedAt)
+	ctx.Locals("tokenExpiresAt", claims.ExpiresAt)
+	ctx.Locals("authTime", claims.AuthTime)
+	if claims.Actor != nil {
+		ctx.Locals("actor", claims.Actor)
+	}
+
+	return nil
+}
+
+// authenticateAPIKey validates an API key and stores its owner in the context.
+// Keys without the write scope are limited to safe methods.
+func (m *Middleware) authenticateAPIKey(ctx *fiber.Ctx, apiKey string) error {
+	claims, err := m.service.AuthenticateAPIKey(apiKey, middleware.ClientIP(ctx))
+	if err != nil {
+		return err
+	}
+
+	if !hasScope(claims.Scopes, APIKeyScopeWrite) && !isSafeMethod(ctx.Method()) {
+		return errors.NewForbiddenError("API key does not have the write scope")
+	}
+
+	ctx.Locals("userID", claims.UserID)
+	ctx.Locals("userEmail", claims.Email)
+	ctx.Locals("userRole", claims.Role)
+	ctx.Locals("apiKeyID", claims.APIKeyID)
+	ctx.Locals("scopes", claims.Scopes)
+
+	return nil
+}
+
+// GetAuthUser extracts the authenticated user from the context. OAuth
+// client tokens are rejected, see GetAuthClient.
 func GetAuthUser(ctx *fiber.Ctx) (*Claims, error) {
+	if _, ok := ctx.Locals("clientID").(string); ok {
+		return nil, errors.NewForbiddenError("This endpoint requires a user")
+	}
+
 	userID, ok1 := ctx.Locals("userID").(uint)
 	email, ok2 := ctx.Locals("userEmail").(string)
 	role, ok3 := ctx.Locals("userRole").(string)
@@ -78,9 +344,75 @@ func GetAuthUser(ctx *fiber.Ctx) (*Claims, error) {
 		return nil, errors.NewUnauthorizedError("User not authenticated")
 	}
 
+	// Tokens issued before sessions were tracked carry no session ID
+	sessionID, _ := ctx.Locals("sessionID").(uint)
+	tokenID, _ := ctx.Locals("tokenID").(string)
+	issuedAt, _ := ctx.Locals("tokenIssuedAt").(int64)
+	expiresAt, _ := ctx.Locals("tokenExpiresAt").(int64)
+	authTime, _ := ctx.Locals("authTime").(int64)
+	apiKeyID, _ := ctx.Locals("apiKeyID").(uint)
+	scopes, _ := ctx.Locals("scopes").([]string)
+	actor, _ := ctx.Locals("actor").(*Actor)
+
 	return &Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		SessionID: sessionID,
+		TokenID:   tokenID,
+		IssuedAt:  issuedAt,
+		ExpiresAt: expiresAt,
+		AuthTime:  authTime,
+		Actor:     actor,
+		APIKeyID:  apiKeyID,
+		Scopes:    scopes,
 	}, nil
 }
+
+// GetAuthClient extracts the authenticated OAuth client from the context
+func GetAuthClient(ctx *fiber.Ctx) (*Claims, error) {
+	clientID, ok := ctx.Locals("clientID").(string)
+	if !ok {
+		return nil, errors.NewUnauthorizedError("Client not authenticated")
+	}
+
+	scopes, _ := ctx.Locals("scopes").([]string)
+	tokenID, _ := ctx.Locals("tokenID").(string)
+	issuedAt, _ := ctx.Locals("tokenIssuedAt").(int64)
+	expiresAt, _ := ctx.Locals("tokenExpiresAt").(int64)
+
+	return &Claims{
+		ClientID:  clientID,
+		Scopes:    scopes,
+		TokenID:   tokenID,
+		IssuedAt:  issuedAt,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// GetPrincipal extracts the authenticated user or OAuth client from the context
+func GetPrincipal(ctx *fiber.Ctx) (*Claims, error) {
+	if _, ok := ctx.Locals("clientID").(string); ok {
+		return GetAuthClient(ctx)
+	}
+	return GetAuthUser(ctx)
+}
+
+// hasScope reports whether value is among values
+func hasScope(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isSafeMethod reports whether an HTTP method only reads data
+func isSafeMethod(method string) bool {
+	switch method {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return true
+	}
+	return false
+}
@@ -4,32 +4,275 @@ import (
 	"time"
 
 	"go-fiber-gorm/modules/user"
+
+	"gorm.io/gorm"
 )
 
 // Claims represents the JWT claims
 type Claims struct {
+	UserID     uint   `json:"user_id"`
+	Email      string `json:"email"`
+	Role       string `json:"role"`
+	SessionID  uint   `json:"sid"`
+	TokenID    string `json:"uuid"`
+	IssuedAt   int64  `json:"iat"`
+	IssuedAtMs int64  `json:"iat_ms,omitempty"` // IssuedAt in milliseconds, compared against revocations
+	ExpiresAt  int64  `json:"exp"`
+	AuthTime   int64  `json:"auth_time,omitempty"` // When the user last proved their identity; zero if unknown
+
+	// Set when an admin is impersonating the user; the token then acts on
+	// behalf of UserID but was issued to Actor
+	Actor *Actor `json:"act,omitempty"`
+
+	// Set when the request was authenticated with an API key instead of a token
+	APIKeyID uint     `json:"-"`
+	Scopes   []string `json:"-"`
+
+	// Set instead of the user fields for OAuth client tokens; the scopes of
+	// the token are in Scopes
+	ClientID string `json:"client_id,omitempty"`
+	Audience string `json:"aud,omitempty"`
+}
+
+// issuedAtMilli returns when the token was issued in milliseconds. Tokens
+// without "iat_ms" count from the start of their "iat" second.
+func (c *Claims) issuedAtMilli() int64 {
+	if c.IssuedAtMs != 0 {
+		return c.IssuedAtMs
+	}
+	return c.IssuedAt * 1000
+}
+
+// IsClient reports whether the principal is an OAuth client rather than a user
+func (c *Claims) IsClient() bool {
+	return c.ClientID != ""
+}
+
+// Actor identifies the admin behind an impersonation token
+type Actor struct {
 	UserID uint   `json:"user_id"`
 	Email  string `json:"email"`
-	Role   string `json:"role"`
+}
+
+// Grants are the effective roles and permissions of a user
+type Grants struct {
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+// HasRole reports whether the grants include the role
+func (g *Grants) HasRole(role string) bool {
+	return hasScope(g.Roles, role)
+}
+
+// HasPermission reports whether the grants include the permission
+func (g *Grants) HasPermission(permission string) bool {
+	return hasScope(g.Permissions, permission)
+}
+
+// PermissionResolver resolves the grants of a user, see the rbac module
+type PermissionResolver interface {
+	ResolveGrants(userID uint, primaryRole string) (*Grants, error)
+}
+
+// APIKeyPrefix marks personal access tokens so they can be told apart from JWTs
+const APIKeyPrefix = "pat_"
+
+// Scopes an API key can be granted
+const (
+	APIKeyScopeRead  = "read"  // Safe methods only (GET, HEAD, OPTIONS)
+	APIKeyScopeWrite = "write" // All methods
+)
+
+// APIKeyPrincipal is the owner and scopes an API key resolves to
+type APIKeyPrincipal struct {
+	KeyID  uint
+	UserID uint
+	Scopes []string
+}
+
+// APIKeyAuthenticator resolves API keys, see the apikeys module
+type APIKeyAuthenticator interface {
+	AuthenticateKey(rawKey, clientIP string) (*APIKeyPrincipal, error)
+}
+
+// ClientPrincipal is an OAuth client authenticated with its credentials
+type ClientPrincipal struct {
+	ClientID string
+	Scopes   []string // Scopes the client may request
+	Audience string   // Optional audience its tokens are issued for
+}
+
+// ClientAuthenticator verifies OAuth client credentials, see the oauthclients module
+type ClientAuthenticator interface {
+	AuthenticateClient(clientID, clientSecret string) (*ClientPrincipal, error)
+}
+
+// InvitationPrincipal is a pending invitation to create an account
+type InvitationPrincipal struct {
+	ID    uint
+	Email string
+	Role  string // Role the new user is created with
+}
+
+// InvitationRedeemer looks up and uses invitations, see the invitations module
+type InvitationRedeemer interface {
+	// FindInvitation returns the pending invitation for a token without using it up
+	FindInvitation(token string) (*InvitationPrincipal, error)
+	// RedeemInvitation marks the invitation as accepted and calls createUser in
+	// the same transaction, so a failed sign-up leaves the invitation pending.
+	// It fails if the invitation was used in the meantime.
+	RedeemInvitation(id uint, createUser func(tx *gorm.DB) error) error
 }
 
 // Session represents a user session
 type Session struct {
-	ID           uint      `gorm:"primarykey" json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	UserID       uint      `gorm:"not null;index" json:"user_id"`
-	RefreshToken string    `gorm:"size:255;not null;uniqueIndex" json:"-"`
-	UserAgent    string    `gorm:"size:255;not null" json:"user_agent"`
-	ClientIP     string    `gorm:"size:100;not null" json:"client_ip"`
-	ExpiresAt    time.Time `gorm:"not null" json:"expires_at"`
-	IsBlocked    bool      `gorm:"default:false;not null" json:"is_blocked"`
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	// Only a SHA-256 digest of the refresh token is stored, so a leaked
+	// table does not hand out working tokens
+	RefreshTokenHash string    `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	UserAgent        string    `gorm:"size:255;not null" json:"user_agent"`
+	ClientIP         string    `gorm:"size:100;not null" json:"client_ip"`
+	DeviceName       string    `gorm:"size:100" json:"device_name"`
+	ExpiresAt        time.Time `gorm:"not null" json:"expires_at"`
+	IsBlocked        bool      `gorm:"default:false;not null" json:"is_blocked"`
+
+	// Refresh token rotation: every session created by refreshing belongs to
+	// the family of the login it descends from, and a rotated-out session
+	// points at the session that replaced it.
+	FamilyID     string `gorm:"size:64;index" json:"-"`
+	ReplacedByID *uint  `json:"-"`
+
+	// When the user last proved their identity in this session, by logging
+	// in or re-authenticating. Refreshing the session keeps it.
+	AuthenticatedAt *time.Time `json:"-"`
+}
+
+// IsRotated reports whether the session's refresh token was exchanged for a new one
+func (s *Session) IsRotated() bool {
+	return s.ReplacedByID != nil
+}
+
+// RequestMeta carries information about the client making an auth request
+type RequestMeta struct {
+	IP         string
+	UserAgent  string
+	DeviceName string // Optional, supplied by the client
+}
+
+// PasswordResetToken represents a single-use password reset token.
+// Only the SHA-256 digest of the token is stored.
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	TokenHash string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// TOTPFactor represents a user's TOTP second factor.
+// The factor only protects logins once it has been confirmed.
+type TOTPFactor struct {
+	ID           uint       `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	UserID       uint       `gorm:"not null;uniqueIndex" json:"user_id"`
+	Secret       string     `gorm:"size:64;not null" json:"-"`
+	LastUsedStep int64      `gorm:"not null;default:0" json:"-"` // Prevents replaying a code within its window
+	ConfirmedAt  *time.Time `json:"confirmed_at"`
+}
+
+// IsConfirmed reports whether the factor has been confirmed
+func (f *TOTPFactor) IsConfirmed() bool {
+	return f.ConfirmedAt != nil
+}
+
+// RecoveryCode represents a one-time MFA recovery code.
+// Only the SHA-256 digest of the code is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null;index" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// OAuthIdentity links a user to an account at an external identity provider
+type OAuthIdentity struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Provider  string    `gorm:"size:50;not null;uniqueIndex:idx_oauth_identity_subject" json:"provider"`
+	Subject   string    `gorm:"size:255;not null;uniqueIndex:idx_oauth_identity_subject" json:"-"`
+	Email     string    `gorm:"size:100" json:"email"`
+}
+
+// WebAuthnCredential is a passkey registered by a user. The public key is
+// stored in COSE format as sent by the authenticator.
+type WebAuthnCredential struct {
+	ID           uint       `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	UserID       uint       `gorm:"not null;index" json:"user_id"`
+	CredentialID string     `gorm:"size:1400;not null;uniqueIndex" json:"-"` // base64url, at most 1023 bytes raw
+	PublicKey    []byte     `gorm:"not null" json:"-"`
+	SignCount    uint32     `gorm:"not null;default:0" json:"-"`
+	AAGUID       string     `gorm:"size:36" json:"aaguid"`
+	Transports   string     `gorm:"size:100" json:"-"` // Comma-separated hints such as "internal,hybrid"
+	Name         string     `gorm:"size:100" json:"name"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+}
+
+// Audit log actions
+const (
+	AuditImpersonationStarted = "impersonation.started"
+	AuditImpersonatedRequest  = "impersonation.request"
+)
+
+// AuditLog records an action an admin took on behalf of a user, such as
+// starting an impersonation or a request made with an impersonation token
+type AuditLog struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ActorID   uint      `gorm:"not null;index" json:"actor_id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Action    string    `gorm:"size:50;not null" json:"action"`
+	Method    string    `gorm:"size:10" json:"method"`
+	Path      string    `gorm:"size:255" json:"path"`
+	Status    int       `json:"status"`
+	ClientIP  string    `gorm:"size:100" json:"client_ip"`
+	UserAgent string    `gorm:"size:255" json:"user_agent"`
+	TokenID   string    `gorm:"size:64;index" json:"-"`
+	Reason    string    `gorm:"size:500" json:"reason,omitempty"`
+}
+
+// LoginEvent records a login attempt, successful or not. Failed attempts
+// for unknown accounts only carry the email that was tried.
+type LoginEvent struct {
+	ID                uint      `gorm:"primarykey" json:"id"`
+	CreatedAt         time.Time `gorm:"index" json:"created_at"`
+	UserID            *uint     `gorm:"index" json:"-"`
+	Email             string    `gorm:"size:255" json:"-"`
+	Method            string    `gorm:"size:50;not null" json:"method"`
+	Success           bool      `gorm:"not null" json:"success"`
+	FailureReason     string    `gorm:"size:50" json:"failure_reason,omitempty"`
+	ClientIP          string    `gorm:"size:100" json:"client_ip"`
+	UserAgent         string    `gorm:"size:255" json:"user_agent"`
+	DeviceName        string    `gorm:"size:100" json:"device_name,omitempty"`
+	DeviceFingerprint string    `gorm:"size:64;index" json:"-"`
+	NewDevice         bool      `json:"new_device"`
 }
 
 // TokenDetails contains both access and refresh tokens
 type TokenDetails struct {
 	AccessToken  string    `json:"access_token"`
 	RefreshToken string    `json:"refresh_token"`
+	SessionID    uint      `json:"-"`
 	AccessUUID   string    `json:"-"`
 	RefreshUUID  string    `json:"-"`
 	AtExpires    int64     `json:"-"`
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/core/logger"
+	"go-fiber-gorm/modules/user"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// oauthStateExpiry is how long a user has to complete the provider login
+const oauthStateExpiry = 10 * time.Minute
+
+// oauthState is kept server-side between the authorize and callback steps
+type oauthState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+// OAuthProviders returns the names of the configured identity providers
+func (s *Service) OAuthProviders() []string {
+	names := make([]string, 0, len(s.oauthProviders))
+	for name := range s.oauthProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartOAuth starts an authorization-code flow with PKCE and returns the
+// provider URL to send the browser to
+func (s *Service) StartOAuth(providerName string) (*OAuthAuthorizeResponse, error) {
+	provider, ok := s.oauthProviders[providerName]
+	if !ok {
+		return nil, errors.NewNotFoundError("OAuth provider")
+	}
+
+	state := generateRandomToken(32)
+	flow := oauthState{
+		Provider:     providerName,
+		Nonce:        generateRandomToken(32),
+		CodeVerifier: generateRandomToken(32),
+	}
+
+	authorizationURL, err := provider.authorizationURL(state, flow.Nonce, pkceChallenge(flow.CodeVerifier))
+	if err != nil {
+		logger.Error("Failed to build OAuth authorization URL:", err)
+		return nil, errors.NewServiceUnavailableError("Identity provider is unavailable")
+	}
+
+	data, _ := json.Marshal(flow)
+	if err := s.store.Set(oauthStateKey(state), string(data), oauthStateExpiry); err != nil {
+		return nil, errors.NewInternalServerError("Failed to start OAuth login")
+	}
+
+	return &OAuthAuthorizeResponse{
+		AuthorizationURL: authorizationURL,
+		State:            state,
+	}, nil
+}
+
+// CompleteOAuth finishes an authorization-code flow. The provider account is
+// linked to an existing user by verified email, or a new user is provisioned.
+func (s *Service) CompleteOAuth(providerName string, req *OAuthCallbackRequest, meta RequestMeta) (*LoginResponse, error) {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return nil, errors.NewValidationError(err)
+	}
+
+	provider, ok := s.oauthProviders[providerName]
+	if !ok {
+		return nil, errors.NewNotFoundError("OAuth provider")
+	}
+
+	// The state is single-use and must belong to this provider
+	data, ok := s.store.Get(oauthStateKey(req.State))
+	if !ok {
+		return nil, errors.NewUnauthorizedError("Invalid or expired OAuth state")
+	}
+	if err := s.store.Delete(oauthStateKey(req.State)); err != nil {
+		logger.Error("Failed to delete OAuth state:", err)
+	}
+
+	var flow oauthState
+	if err := json.Unmarshal([]byte(data), &flow); err != nil || flow.Provider != providerName {
+		return nil, errors.NewUnauthorizedError("Invalid or expired OAuth state")
+	}
+
+	identity, err := provider.exchange(req.Code, flow.CodeVerifier, flow.Nonce)
+	if err != nil {
+		logger.Warn("OAuth login failed:", err)
+		return nil, errors.NewUnauthorizedError("OAuth login failed")
+	}
+
+	foundUser, err := s.resolveOAuthUser(providerName, identity)
+	if err != nil {
+		if errors.StatusCode(err) == http.StatusForbidden {
+			s.loginFailed(nil, identity.Email, oauthLoginMethod(providerName), LoginFailureRejected, meta)
+		}
+		return nil, err
+	}
+
+	return s.completeLogin(foundUser, oauthLoginMethod(providerName), meta)
+}
+
+// resolveOAuthUser finds the user linked to a provider account, linking or
+// provisioning one by verified email on first login
+func (s *Service) resolveOAuthUser(providerName string, identity *oidcIdentity) (*user.User, error) {
+	linked, err := s.repo.FindOAuthIdentity(providerName, identity.Subject)
+	if err == nil {
+		return s.userRepo.FindByID(linked.UserID)
+	}
+
+	// Only a verified email proves the provider account owns the address
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, errors.New(http.StatusForbidden, "EMAIL_NOT_VERIFIED", "The identity provider did not confirm your email address")
+	}
+
+	foundUser, err := s.userRepo.FindByEmail(identity.Email)
+	if err != nil {
+		foundUser, err = s.provisionOAuthUser(identity)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Whoever registered an unverified address may not own it; linking
+		// would leave them with password access to the provider user's account
+		if !foundUser.IsEmailVerified() {
+			logger.SecurityEvent("oauth_link_rejected", logrus.Fields{
+				"user_id":  foundUser.ID,
+				"provider": providerName,
+				"reason":   "email_not_verified",
+			})
+			return nil, errors.New(http.StatusConflict, "ACCOUNT_NOT_VERIFIED", "An account with this email exists but has not verified it. Verify the email first or sign in with a password.")
+		}
+
+		logger.SecurityEvent("oauth_account_linked", logrus.Fields{
+			"user_id":  foundUser.ID,
+			"provider": providerName,
+		})
+	}
+
+	if err := s.repo.CreateOAuthIdentity(&OAuthIdentity{
+		UserID:   foundUser.ID,
+		Provider: providerName,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}); err != nil {
+		return nil, errors.NewInternalServerError("Failed to link account")
+	}
+
+	return foundUser, nil
+}
+
+// provisionOAuthUser creates a user for a provider account. The user gets
+// an unusable random password and can set one through password reset.
+// Existing users can still link a provider when registration is closed.
+func (s *Service) provisionOAuthUser(identity *oidcIdentity) (*user.User, error) {
+	// Social login only signs up new users when registration is open
+	if s.registrationMode != RegistrationOpen {
+		return nil, s.errRegistrationClosed()
+	}
+
+	hashedPassword, err := s.passwords.Hash(generateRandomToken(32))
+	if err != nil {
+		return nil, errors.NewInternalServerError("Failed to hash password")
+	}
+
+	name := identity.Name
+	if name == "" {
+		name = identity.Email
+	}
+
+	now := time.Now()
+	newUser := &user.User{
+		Name:            truncate(name, 100),
+		Email:           identity.Email,
+		Password:        hashedPassword,
+		Role:            "user", // Default role
+		EmailVerifiedAt: &now,
+	}
+
+	if err := s.userRepo.Create(newUser); err != nil {
+		return nil, errors.NewInternalServerError("Failed to create user")
+	}
+
+	return newUser, nil
+}
+
+// pkceChallenge derives the S256 code challenge from a code verifier (RFC 7636)
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func oauthStateKey(state string) string {
+	return "oauth:state:" + state
+}
@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testOAuthClientID     = "test-client"
+	testOAuthClientSecret = "test-secret"
+)
+
+// newOAuthTestService creates a service with two providers, "mock" and
+// "other", that both use the same mock OIDC provider
+func newOAuthTestService(t *testing.T) (*Service, *test.MockOIDCProvider) {
+	t.Helper()
+
+	provider, err := test.NewMockOIDCProvider(testOAuthClientID, testOAuthClientSecret)
+	require.NoError(t, err)
+	t.Cleanup(provider.Close)
+
+	providerConfig := func(name string) OAuthProviderConfig {
+		return OAuthProviderConfig{
+			Name:         name,
+			Issuer:       provider.Issuer(),
+			ClientID:     testOAuthClientID,
+			ClientSecret: testOAuthClientSecret,
+			RedirectURL:  "http://localhost:3000/oauth/callback",
+		}
+	}
+
+	service, _ := newTestService(t, ServiceConfig{
+		OAuthProviders: []OAuthProviderConfig{providerConfig("mock"), providerConfig("other")},
+	})
+	return service, provider
+}
+
+// authorizeOAuth starts a login with the "mock" provider and approves it
+// with the given ID token claims. rewrite may alter the authorization URL
+// before the provider sees it.
+func authorizeOAuth(t *testing.T, service *Service, provider *test.MockOIDCProvider, claims map[string]interface{}, rewrite func(url.Values)) *OAuthCallbackRequest {
+	t.Helper()
+
+	started, err := service.StartOAuth("mock")
+	require.NoError(t, err)
+
+	authorizationURL := started.AuthorizationURL
+	if rewrite != nil {
+		parsed, err := url.Parse(authorizationURL)
+		require.NoError(t, err)
+		query := parsed.Query()
+		rewrite(query)
+		parsed.RawQuery = query.Encode()
+		authorizationURL = parsed.String()
+	}
+
+	code, state, err := provider.Authorize(authorizationURL, claims)
+	require.NoError(t, err)
+	assert.Equal(t, started.State, state)
+
+	return &OAuthCallbackRequest{Code: code, State: state}
+}
+
+// verifiedClaims are the claims of a provider account with a verified email
+func verifiedClaims(subject, email string) map[string]interface{} {
+	return map[string]interface{}{
+		"sub":            subject,
+		"email":          email,
+		"email_verified": true,
+		"name":           "Jane Doe",
+	}
+}
+
+func TestCompleteOAuthProvisionsAndLinksUser(t *testing.T) {
+	service, provider := newOAuthTestService(t)
+
+	req := authorizeOAuth(t, service, provider, verifiedClaims("subject-1", "jane@example.com"), nil)
+	result, err := service.CompleteOAuth("mock", req, RequestMeta{IP: "127.0.0.1"})
+	require.NoError(t, err)
+	require.NotNil(t, result.AuthResponse)
+	assert.Equal(t, "jane@example.com", result.User.Email)
+	assert.True(t, result.User.EmailVerified)
+	assert.NotEmpty(t, result.Token.AccessToken)
+
+	// The next login finds the linked account by subject
+	req = authorizeOAuth(t, service, provider, verifiedClaims("subject-1", "jane@example.com"), nil)
+	again, err := service.CompleteOAuth("mock", req, RequestMeta{IP: "127.0.0.1"})
+	require.NoError(t, err)
+	assert.Equal(t, result.User.ID, again.User.ID)
+}
+
+func TestCompleteOAuthLinksExistingUserByEmail(t *testing.T) {
+	service, provider := newOAuthTestService(t)
+	existing := createTestUser(t, service, "john@example.com")
+
+	req := authorizeOAuth(t, service, provider, verifiedClaims("subject-2", "john@example.com"), nil)
+	result, err := service.CompleteOAuth("mock", req, RequestMeta{})
+	require.NoError(t, err)
+	assert.Equal(t, existing.ID, result.User.ID)
+
+	identity, err := service.repo.FindOAuthIdentity("mock", "subject-2")
+	require.NoError(t, err)
+	assert.Equal(t, existing.ID, identity.UserID)
+}
+
+func TestCompleteOAuthRejectsReusedState(t *testing.T) {
+	service, provider := newOAuthTestService(t)
+
+	req := authorizeOAuth(t, service, provider, verifiedClaims("subject-1", "jane@example.com"), nil)
+	_, err := service.CompleteOAuth("mock", req, RequestMeta{})
+	require.NoError(t, err)
+
+	_, err = service.CompleteOAuth("mock", req, RequestMeta{})
+	assert.Equal(t, http.StatusUnauthorized, errors.StatusCode(err))
+}
+
+func TestCompleteOAuthRejectsStateOfOtherProvider(t *testing.T) {
+	service, provider := newOAuthTestService(t)
+
+	req := authorizeOAuth(t, service, provider, verifiedClaims("subject-1", "jane@example.com"), nil)
+	_, err := service.CompleteOAuth("other", req, RequestMeta{})
+	assert.Equal(t, http.StatusUnauthorized, errors.StatusCode(err))
+
+	// The state was used up by the failed attempt
+	_, err = service.CompleteOAuth("mock", req, RequestMeta{})
+	assert.Equal(t, http.StatusUnauthorized, errors.StatusCode(err))
+}
+
+func TestOAuthRejectsUnknownProvider(t *testing.T) {
+	service, provider := newOAuthTestService(t)
+
+	_, err := service.StartOAuth("unknown")
+	assert.Equal(t, http.StatusNotFound, errors.StatusCode(err))
+
+	req := authorizeOAuth(t, service, provider, verifiedClaims("subject-1", "jane@example.com"), nil)
+	_, err = service.CompleteOAuth("unknown", req, RequestMeta{})
+	assert.Equal(t, http.StatusNotFound, errors.StatusCode(err))
+}
+
+func TestCompleteOAuthRejectsInvalidIDTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		claims  map[string]interface{}
+		rewrite func(url.Values)
+	}{
+		{
+			name:    "nonce mismatch",
+			rewrite: func(query url.Values) { query.Set("nonce", "another-nonce") },
+		},
+		{
+			name:   "wrong audience",
+			claims: map[string]interface{}{"aud": "another-client"},
+		},
+		{
+			name:   "wrong issuer",
+			claims: map[string]interface{}{"iss": "https://issuer.example.com"},
+		},
+		{
+			name: "expired",
+			claims: map[string]interface{}{
+				"iat": time.Now().Add(-time.Hour).Unix(),
+				"exp": time.Now().Add(-10 * time.Minute).Unix(),
+			},
+		},
+		{
+			name:   "missing subject",
+			claims: map[string]interface{}{"sub": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, provider := newOAuthTestService(t)
+
+			claims := verifiedClaims("subject-1", "jane@example.com")
+			for name, value := range tt.claims {
+				claims[name] = value
+			}
+
+			req := authorizeOAuth(t, service, provider, claims, tt.rewrite)
+			_, err := service.CompleteOAuth("mock", req, RequestMeta{})
+			assert.Equal(t, http.StatusUnauthorized, errors.StatusCode(err))
+
+			_, err = service.userRepo.FindByEmail("jane@example.com")
+			assert.Error(t, err, "no user may be provisioned")
+		})
+	}
+}
+
+func TestCompleteOAuthHandlesKeyRotation(t *testing.T) {
+	service, provider := newOAuthTestService(t)
+
+	req := authorizeOAuth(t, service, provider, verifiedClaims("subject-1", "jane@example.com"), nil)
+	_, err := service.CompleteOAuth("mock", req, RequestMeta{})
+	require.NoError(t, err)
+
+	require.NoError(t, provider.RotateKey())
+
+	// Unknown key IDs only trigger a JWKS refetch once per refresh interval
+	req = authorizeOAuth(t, service, provider, verifiedClaims("subject-1", "jane@example.com"), nil)
+	_, err = service.CompleteOAuth("mock", req, RequestMeta{})
+	assert.Equal(t, http.StatusUnauthorized, errors.StatusCode(err))
+
+	oidc := service.oauthProviders["mock"]
+	oidc.mu.Lock()
+	oidc.keysFetchedAt = time.Now().Add(-oidcKeyRefreshInterval)
+	oidc.mu.Unlock()
+
+	req = authorizeOAuth(t, service, provider, verifiedClaims("subject-1", "jane@example.com"), nil)
+	_, err = service.CompleteOAuth("mock", req, RequestMeta{})
+	assert.NoError(t, err)
+}
+
+func TestCompleteOAuthRejectsUnverifiedEmail(t *testing.T) {
+	service, provider := newOAuthTestService(t)
+	createTestUser(t, service, "john@example.com")
+
+	claims := verifiedClaims("subject-1", "john@example.com")
+	claims["email_verified"] = false
+
+	req := authorizeOAuth(t, service, provider, claims, nil)
+	_, err := service.CompleteOAuth("mock", req, RequestMeta{})
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, errors.StatusCode(err))
+
+	// The existing account must not be linked
+	_, err = service.repo.FindOAuthIdentity("mock", "subject-1")
+	assert.Error(t, err)
+}
+
+func TestCompleteOAuthDoesNotLinkUnverifiedAccount(t *testing.T) {
+	service, provider := newOAuthTestService(t)
+
+	// Someone registered the address without ever verifying it
+	existing := createTestUser(t, service, "john@example.com")
+	existing.EmailVerifiedAt = nil
+	require.NoError(t, service.userRepo.Update(existing))
+
+	req := authorizeOAuth(t, service, provider, verifiedClaims("subject-1", "john@example.com"), nil)
+	_, err := service.CompleteOAuth("mock", req, RequestMeta{})
+	assert.Equal(t, http.StatusConflict, errors.StatusCode(err))
+
+	_, err = service.repo.FindOAuthIdentity("mock", "subject-1")
+	assert.Error(t, err, "the provider account must not be linked")
+
+	found, err := service.userRepo.FindByID(existing.ID)
+	require.NoError(t, err)
+	assert.False(t, found.IsEmailVerified(), "the email must not be marked as verified")
+}
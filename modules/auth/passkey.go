@@ -0,0 +1,352 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/core/logger"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// passkeyChallengeExpiry is how long a registration or sign-in ceremony may take
+const passkeyChallengeExpiry = 5 * time.Minute
+
+// WebAuthn ceremony types as found in the client data
+const (
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+)
+
+// passkeyChallenge is kept server-side between the begin and finish steps
+type passkeyChallenge struct {
+	Ceremony string `json:"ceremony"`
+	UserID   uint   `json:"user_id,omitempty"` // Only set for registrations
+}
+
+// BeginPasskeyRegistration returns the options for creating a passkey for
+// the current user
+func (s *Service) BeginPasskeyRegistration(userID uint) (*PasskeyCreationOptions, error) {
+	foundUser, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.FindUserWebAuthnCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stop the authenticator from registering a second passkey for the same account
+	exclude := make([]PasskeyDescriptor, 0, len(existing))
+	for _, credential := range existing {
+		exclude = append(exclude, newPasskeyDescriptor(credential))
+	}
+
+	params := make([]PasskeyCredentialParameter, 0, len(webauthnAlgorithms))
+	for _, alg := range webauthnAlgorithms {
+		params = append(params, PasskeyCredentialParameter{Type: "public-key", Alg: alg})
+	}
+
+	challenge, err := s.storePasskeyChallenge(passkeyChallenge{Ceremony: ceremonyCreate, UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasskeyCreationOptions{
+		Challenge: challenge,
+		RP: PasskeyRelyingParty{
+			ID:   s.webauthn.RPID,
+			Name: s.webauthn.RPName,
+		},
+		User: PasskeyUser{
+			ID:          s.passkeyUserHandle(foundUser.ID),
+			Name:        foundUser.Email,
+			DisplayName: foundUser.Name,
+		},
+		PubKeyCredParams:   params,
+		Timeout:            passkeyChallengeExpiry.Milliseconds(),
+		ExcludeCredentials: exclude,
+		// Discoverable credentials allow signing in without entering an email
+		AuthenticatorSelection: PasskeyAuthenticatorCriteria{
+			ResidentKey:      "required",
+			RequireResident:  true,
+			UserVerification: "required",
+		},
+		Attestation: "none",
+	}, nil
+}
+
+// FinishPasskeyRegistration verifies a new passkey and stores it
+func (s *Service) FinishPasskeyRegistration(userID uint, req *PasskeyRegistrationRequest) (*PasskeyResponse, error) {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return nil, errors.NewValidationError(err)
+	}
+
+	clientDataJSON, err := decodeBase64URL(req.Response.ClientDataJSON)
+	if err != nil {
+		return nil, errors.NewBadRequestError("Invalid client data")
+	}
+	rawAttestation, err := decodeBase64URL(req.Response.AttestationObject)
+	if err != nil {
+		return nil, errors.NewBadRequestError("Invalid attestation object")
+	}
+
+	challenge, err := s.consumePasskeyChallenge(clientDataJSON, ceremonyCreate)
+	if err != nil || challenge.UserID != userID {
+		return nil, errors.NewBadRequestError("Invalid or expired passkey challenge")
+	}
+
+	data, err := parseAttestationObject(rawAttestation)
+	if err == nil {
+		err = s.webauthn.verifyAuthenticatorData(data)
+	}
+	if err == nil {
+		_, _, err = parseCOSEKey(data.PublicKey)
+	}
+	if err != nil {
+		logger.Warn("Passkey registration rejected:", err)
+		return nil, errors.NewBadRequestError("Passkey registration failed")
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(data.CredentialID)
+	if _, err := s.repo.FindWebAuthnCredential(credentialID); err == nil {
+		return nil, errors.New(http.StatusConflict, "PASSKEY_EXISTS", "This passkey is already registered")
+	}
+
+	credential := &WebAuthnCredential{
+		UserID:       userID,
+		CredentialID: credentialID,
+		PublicKey:    data.PublicKey,
+		SignCount:    data.SignCount,
+		AAGUID:       formatAAGUID(data.AAGUID),
+		Transports:   truncate(strings.Join(req.Response.Transports, ","), 100),
+		Name:         valueOr(truncate(req.Name, 100), "Passkey"),
+	}
+	if err := s.repo.CreateWebAuthnCredential(credential); err != nil {
+		return nil, errors.NewInternalServerError("Failed to save passkey")
+	}
+
+	logger.SecurityEvent("passkey_registered", logrus.Fields{
+		"user_id":    userID,
+		"passkey_id": credential.ID,
+		"aaguid":     credential.AAGUID,
+	})
+
+	response := newPasskeyResponse(*credential)
+	return &response, nil
+}
+
+// ListPasskeys returns the passkeys of a user
+func (s *Service) ListPasskeys(userID uint) ([]PasskeyResponse, error) {
+	credentials, err := s.repo.FindUserWebAuthnCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys := make([]PasskeyResponse, 0, len(credentials))
+	for _, credential := range credentials {
+		passkeys = append(passkeys, newPasskeyResponse(credential))
+	}
+	return passkeys, nil
+}
+
+// DeletePasskey removes one of a user's passkeys
+func (s *Service) DeletePasskey(userID, passkeyID uint) error {
+	deleted, err := s.repo.DeleteWebAuthnCredential(userID, passkeyID)
+	if err != nil {
+		return errors.NewInternalServerError("Failed to delete passkey")
+	}
+	if !deleted {
+		return errors.NewNotFoundError("Passkey")
+	}
+
+	logger.SecurityEvent("passkey_deleted", logrus.Fields{
+		"user_id":    userID,
+		"passkey_id": passkeyID,
+	})
+	return nil
+}
+
+// BeginPasskeyLogin returns the options for signing in with a passkey.
+// Only discoverable credentials are used, so no email is needed and the
+// response does not reveal which accounts have passkeys.
+func (s *Service) BeginPasskeyLogin() (*PasskeyRequestOptions, error) {
+	challenge, err := s.storePasskeyChallenge(passkeyChallenge{Ceremony: ceremonyGet})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasskeyRequestOptions{
+		Challenge:        challenge,
+		RPID:             s.webauthn.RPID,
+		Timeout:          passkeyChallengeExpiry.Milliseconds(),
+		UserVerification: "required",
+		AllowCredentials: []PasskeyDescriptor{},
+	}, nil
+}
+
+// FinishPasskeyLogin verifies a passkey assertion and starts a session.
+// A user-verified passkey counts as two factors, so no TOTP code is asked.
+func (s *Service) FinishPasskeyLogin(req *PasskeyLoginRequest, meta RequestMeta) (*AuthResponse, error) {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return nil, errors.NewValidationError(err)
+	}
+
+	clientDataJSON, err := decodeBase64URL(req.Response.ClientDataJSON)
+	if err != nil {
+		return nil, errors.NewBadRequestError("Invalid client data")
+	}
+	authData, err := decodeBase64URL(req.Response.AuthenticatorData)
+	if err != nil {
+		return nil, errors.NewBadRequestError("Invalid authenticator data")
+	}
+	signature, err := decodeBase64URL(req.Response.Signature)
+	if err != nil {
+		return nil, errors.NewBadRequestError("Invalid signature")
+	}
+
+	if _, err := s.consumePasskeyChallenge(clientDataJSON, ceremonyGet); err != nil {
+		return nil, errors.NewUnauthorizedError("Invalid or expired passkey challenge")
+	}
+
+	credential, err := s.repo.FindWebAuthnCredential(strings.TrimRight(req.ID, "="))
+	if err != nil {
+		return nil, errors.NewUnauthorizedError("Passkey login failed")
+	}
+
+	// Discoverable credentials return the user handle, which must match the owner
+	if req.Response.UserHandle != "" && req.Response.UserHandle != s.passkeyUserHandle(credential.UserID) {
+		return nil, errors.NewUnauthorizedError("Passkey login failed")
+	}
+
+	data, err := parseAuthenticatorData(authData)
+	if err == nil {
+		err = s.webauthn.verifyAuthenticatorData(data)
+	}
+	if err == nil {
+		err = verifyAssertionSignature(credential.PublicKey, authData, clientDataJSON, signature)
+	}
+	if err != nil {
+		logger.Warn("Passkey login rejected:", err)
+		return nil, errors.NewUnauthorizedError("Passkey login failed")
+	}
+
+	// A counter that does not increase points to a cloned authenticator.
+	// Synced passkeys always report zero and are exempt.
+	if (data.SignCount != 0 || credential.SignCount != 0) && data.SignCount <= credential.SignCount {
+		logger.SecurityEvent("passkey_counter_regression", logrus.Fields{
+			"user_id":    credential.UserID,
+			"passkey_id": credential.ID,
+			"stored":     credential.SignCount,
+			"received":   data.SignCount,
+			"client_ip":  meta.IP,
+			"user_agent": meta.UserAgent,
+		})
+		return nil, errors.NewUnauthorizedError("Passkey login failed")
+	}
+
+	updated, err := s.repo.UpdateWebAuthnSignCount(credential.ID, credential.SignCount, data.SignCount)
+	if err != nil {
+		return nil, errors.NewInternalServerError("Failed to update passkey")
+	}
+	if !updated {
+		return nil, errors.NewUnauthorizedError("Passkey login failed")
+	}
+
+	foundUser, err := s.userRepo.FindByID(credential.UserID)
+	if err != nil {
+		return nil, errors.NewUnauthorizedError("Passkey login failed")
+	}
+
+	// Block unverified users when verification is required
+	if s.requireEmailVerification && !foundUser.IsEmailVerified() {
+		s.loginFailed(foundUser, "", LoginMethodPasskey, LoginFailureEmailNotVerified, meta)
+		return nil, errors.New(http.StatusForbidden, "EMAIL_NOT_VERIFIED", "Please verify your email address before logging in")
+	}
+
+	return s.startSession(foundUser, LoginMethodPasskey, meta)
+}
+
+// storePasskeyChallenge creates a challenge and remembers its ceremony
+func (s *Service) storePasskeyChallenge(challenge passkeyChallenge) (string, error) {
+	value := generateRandomToken(32)
+
+	data, _ := json.Marshal(challenge)
+	if err := s.store.Set(passkeyChallengeKey(value), string(data), passkeyChallengeExpiry); err != nil {
+		return "", errors.NewInternalServerError("Failed to start passkey ceremony")
+	}
+	return value, nil
+}
+
+// consumePasskeyChallenge looks up and deletes the challenge signed in the
+// client data, then verifies the client data against it. Challenges are
+// single-use, even when verification fails.
+func (s *Service) consumePasskeyChallenge(clientDataJSON []byte, ceremony string) (*passkeyChallenge, error) {
+	value, err := clientDataChallenge(clientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := s.store.Get(passkeyChallengeKey(value))
+	if !ok {
+		return nil, errors.NewBadRequestError("Unknown challenge")
+	}
+	if err := s.store.Delete(passkeyChallengeKey(value)); err != nil {
+		logger.Error("Failed to delete passkey challenge:", err)
+	}
+
+	var challenge passkeyChallenge
+	if err := json.Unmarshal([]byte(data), &challenge); err != nil || challenge.Ceremony != ceremony {
+		return nil, errors.NewBadRequestError("Unknown challenge")
+	}
+
+	if err := s.webauthn.verifyClientData(clientDataJSON, ceremony, value); err != nil {
+		logger.Warn("Passkey client data rejected:", err)
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// passkeyUserHandle derives the opaque WebAuthn user handle of a user, so
+// authenticators never see the database ID
+func (s *Service) passkeyUserHandle(userID uint) string {
+	mac := hmac.New(sha256.New, s.purposeKey("webauthn_user_handle"))
+	mac.Write([]byte(strconv.FormatUint(uint64(userID), 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newPasskeyDescriptor references a stored credential in ceremony options
+func newPasskeyDescriptor(credential WebAuthnCredential) PasskeyDescriptor {
+	descriptor := PasskeyDescriptor{
+		Type: "public-key",
+		ID:   credential.CredentialID,
+	}
+	if credential.Transports != "" {
+		descriptor.Transports = strings.Split(credential.Transports, ",")
+	}
+	return descriptor
+}
+
+// newPasskeyResponse builds the listing entry of a passkey
+func newPasskeyResponse(credential WebAuthnCredential) PasskeyResponse {
+	return PasskeyResponse{
+		ID:         credential.ID,
+		Name:       credential.Name,
+		AAGUID:     credential.AAGUID,
+		CreatedAt:  credential.CreatedAt,
+		LastUsedAt: credential.LastUsedAt,
+	}
+}
+
+func passkeyChallengeKey(challenge string) string {
+	return "webauthn:challenge:" + challenge
+}
@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/modules/user"
+	"go-fiber-gorm/test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testWebAuthnOrigin = "http://localhost:3000"
+
+// newPasskeyTestService creates a service with localhost as relying party
+// and a user to register passkeys for
+func newPasskeyTestService(t *testing.T) (*Service, *user.User) {
+	t.Helper()
+
+	service, _ := newTestService(t, ServiceConfig{
+		WebAuthn: WebAuthnConfig{
+			RPName:  "Test",
+			Origins: []string{testWebAuthnOrigin},
+		},
+	})
+	return service, createTestUser(t, service, "jane@example.com")
+}
+
+// convert round-trips a value through JSON, the way it travels between the
+// API and the browser
+func convert(t *testing.T, from, to interface{}) {
+	t.Helper()
+
+	data, err := json.Marshal(from)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, to))
+}
+
+// createPasskey runs the registration ceremony with the authenticator
+func createPasskey(t *testing.T, service *Service, authenticator *test.SoftAuthenticator, userID uint) (*PasskeyResponse, error) {
+	t.Helper()
+
+	options, err := service.BeginPasskeyRegistration(userID)
+	require.NoError(t, err)
+	optionsJSON, err := json.Marshal(options)
+	require.NoError(t, err)
+
+	credential, err := authenticator.Register(optionsJSON)
+	require.NoError(t, err)
+
+	req := new(PasskeyRegistrationRequest)
+	convert(t, credential, req)
+	return service.FinishPasskeyRegistration(userID, req)
+}
+
+// beginPasskeyLogin starts a sign-in ceremony and returns its options as JSON
+func beginPasskeyLogin(t *testing.T, service *Service) []byte {
+	t.Helper()
+
+	options, err := service.BeginPasskeyLogin()
+	require.NoError(t, err)
+	optionsJSON, err := json.Marshal(options)
+	require.NoError(t, err)
+	return optionsJSON
+}
+
+// assertPasskey answers sign-in options with the authenticator. tamper may
+// alter the assertion before it is posted.
+func assertPasskey(t *testing.T, authenticator *test.SoftAuthenticator, optionsJSON []byte, tamper func(map[string]interface{})) *PasskeyLoginRequest {
+	t.Helper()
+
+	assertion, err := authenticator.Login(optionsJSON)
+	require.NoError(t, err)
+	if tamper != nil {
+		tamper(assertion["response"].(map[string]interface{}))
+	}
+
+	req := new(PasskeyLoginRequest)
+	convert(t, assertion, req)
+	return req
+}
+
+// loginWithPasskey runs a full sign-in ceremony with the authenticator
+func loginWithPasskey(t *testing.T, service *Service, authenticator *test.SoftAuthenticator) (*AuthResponse, error) {
+	t.Helper()
+
+	req := assertPasskey(t, authenticator, beginPasskeyLogin(t, service), nil)
+	return service.FinishPasskeyLogin(req, RequestMeta{})
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	service, u := newPasskeyTestService(t)
+	authenticator := test.NewSoftAuthenticator(testWebAuthnOrigin)
+
+	passkey, err := createPasskey(t, service, authenticator, u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Passkey", passkey.Name)
+
+	result, err := loginWithPasskey(t, service, authenticator)
+	require.NoError(t, err)
+	assert.Equal(t, u.ID, result.User.ID)
+	assert.NotEmpty(t, result.Token.AccessToken)
+
+	// The counter advances with every assertion
+	_, err = loginWithPasskey(t, service, authenticator)
+	assert.NoError(t, err)
+}
+
+func TestPasskeyRegistrationRejectsReusedChallenge(t *testing.T) {
+	service, u := newPasskeyTestService(t)
+	authenticator := test.NewSoftAuthenticator(testWebAuthnOrigin)
+
+	options, err := service.BeginPasskeyRegistration(u.ID)
+	require.NoError(t, err)
+	optionsJSON, err := json.Marshal(options)
+	require.NoError(t, err)
+
+	// Two different credentials answering the same challenge
+	for i, wantErr := range []bool{false, true} {
+		credential, err := authenticator.Register(optionsJSON)
+		require.NoError(t, err)
+
+		req := new(PasskeyRegistrationRequest)
+		convert(t, credential, req)
+		_, err = service.FinishPasskeyRegistration(u.ID, req)
+		if wantErr {
+			assert.Equal(t, http.StatusBadRequest, errors.StatusCode(err), "attempt %d", i+1)
+		} else {
+			assert.NoError(t, err, "attempt %d", i+1)
+		}
+	}
+
+	passkeys, err := service.ListPasskeys(u.ID)
+	require.NoError(t, err)
+	assert.Len(t, passkeys, 1)
+}
+
+func TestPasskeyRegistrationRejectsChallengeOfOtherUser(t *testing.T) {
+	service, u := newPasskeyTestService(t)
+	other := createTestUser(t, service, "john@example.com")
+	authenticator := test.NewSoftAuthenticator(testWebAuthnOrigin)
+
+	options, err := service.BeginPasskeyRegistration(u.ID)
+	require.NoError(t, err)
+	optionsJSON, err := json.Marshal(options)
+	require.NoError(t, err)
+
+	credential, err := authenticator.Register(optionsJSON)
+	require.NoError(t, err)
+
+	req := new(PasskeyRegistrationRequest)
+	convert(t, credential, req)
+	_, err = service.FinishPasskeyRegistration(other.ID, req)
+	assert.Equal(t, http.StatusBadRequest, errors.StatusCode(err))
+}
+
+func TestPasskeyRegistrationRejectsInvalidCeremonies(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*test.SoftAuthenticator)
+	}{
+		{
+			name:      "wrong origin",
+			configure: func(a *test.SoftAuthenticator) { a.Origin = "https://evil.example.com" },
+		},
+		{
+			name:      "wrong RP ID",
+			configure: func(a *test.SoftAuthenticator) { a.FakeRPID = "evil.example.com" },
+		},
+		{
+			name:      "missing user verification",
+			configure: func(a *test.SoftAuthenticator) { a.SkipUserVerification = true },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, u := newPasskeyTestService(t)
+			authenticator := test.NewSoftAuthenticator(testWebAuthnOrigin)
+			tt.configure(authenticator)
+
+			_, err := createPasskey(t, service, authenticator, u.ID)
+			assert.Equal(t, http.StatusBadRequest, errors.StatusCode(err))
+
+			passkeys, err := service.ListPasskeys(u.ID)
+			require.NoError(t, err)
+			assert.Empty(t, passkeys)
+		})
+	}
+}
+
+func TestPasskeyLoginRejectsReusedChallenge(t *testing.T) {
+	service, u := newPasskeyTestService(t)
+	authenticator := test.NewSoftAuthenticator(testWebAuthnOrigin)
+	_, err := createPasskey(t, service, authenticator, u.ID)
+	require.NoError(t, err)
+
+	optionsJSON := beginPasskeyLogin(t, service)
+
+	_, err = service.FinishPasskeyLogin(assertPasskey(t, authenticator, optionsJSON, nil), RequestMeta{})
+	require.NoError(t, err)
+
+	// A fresh, validly signed assertion over the spent challenge
+	_, err = service.FinishPasskeyLogin(assertPasskey(t, authenticator, optionsJSON, nil), RequestMeta{})
+	assert.Equal(t, http.StatusUnauthorized, errors.StatusCode(err))
+}
+
+func TestPasskeyLoginRejectsInvalidAssertions(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*test.SoftAuthenticator)
+		tamper    func(map[string]interface{})
+	}{
+		{
+			name:      "wrong origin",
+			configure: func(a *test.SoftAuthenticator) { a.Origin = "https://evil.example.com" },
+		},
+		{
+			name:      "wrong RP ID",
+			configure: func(a *test.SoftAuthenticator) { a.FakeRPID = "evil.example.com" },
+		},
+		{
+			name:      "missing user verification",
+			configure: func(a *test.SoftAuthenticator) { a.SkipUserVerification = true },
+		},
+		{
+			name:   "user handle mismatch",
+			tamper: func(response map[string]interface{}) { response["userHandle"] = "c29tZW9uZS1lbHNl" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, u := newPasskeyTestService(t)
+			authenticator := test.NewSoftAuthenticator(testWebAuthnOrigin)
+			_, err := createPasskey(t, service, authenticator, u.ID)
+			require.NoError(t, err)
+
+			if tt.configure != nil {
+				tt.configure(authenticator)
+			}
+			req := assertPasskey(t, authenticator, beginPasskeyLogin(t, service), tt.tamper)
+
+			_, err = service.FinishPasskeyLogin(req, RequestMeta{})
+			assert.Equal(t, http.StatusUnauthorized, errors.StatusCode(err))
+		})
+	}
+}
+
+func TestPasskeyLoginRejectsSignCountRegression(t *testing.T) {
+	service, u := newPasskeyTestService(t)
+	authenticator := test.NewSoftAuthenticator(testWebAuthnOrigin)
+	_, err := createPasskey(t, service, authenticator, u.ID)
+	require.NoError(t, err)
+
+	clone := authenticator.Clone()
+
+	_, err = loginWithPasskey(t, service, authenticator)
+	require.NoError(t, err)
+
+	// The clone reports the same counter value that was just used
+	_, err = loginWithPasskey(t, service, clone)
+	assert.Equal(t, http.StatusUnauthorized, errors.StatusCode(err))
+
+	// The original authenticator keeps working
+	_, err = loginWithPasskey(t, service, authenticator)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/core/logger"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicy decides which new passwords are accepted. It applies to
+// registration, password changes and resets, and users created by admins.
+type PasswordPolicy struct {
+	MinLength           int                // Minimum number of characters
+	MaxLength           int                // Maximum number of characters; bounds the hashing cost
+	MinCharacterClasses int                // Lowercase, uppercase, digits and symbols that must be present; zero disables the rule
+	MinScore            int                // Minimum strength score from 0 (guessable) to 4 (very strong)
+	Breached            *BreachedPasswords // Known breached passwords; defaults to the bundled list
+}
+
+// PasswordViolation describes one rule a password breaks
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewPasswordPolicy fills in the unset fields of a policy
+func NewPasswordPolicy(p PasswordPolicy) *PasswordPolicy {
+	if p.MinLength <= 0 {
+		p.MinLength = 8
+	}
+	if p.MaxLength <= 0 {
+		p.MaxLength = 128
+	}
+	if p.MinScore <= 0 {
+		p.MinScore = 2
+	}
+	if p.MinScore > 4 {
+		p.MinScore = 4
+	}
+	if p.Breached == nil {
+		breached, err := LoadBreachedPasswords("")
+		if err != nil {
+			logger.Error("Failed to load the bundled breached password list:", err)
+		}
+		p.Breached = breached
+	}
+	return &p
+}
+
+// CheckPassword returns a VALIDATION_ERROR listing every rule the password
+// breaks, or nil if it is acceptable. The name and email of the account are
+// used to reject passwords built from them.
+func (p *PasswordPolicy) CheckPassword(password, name, email string) error {
+	violations, score := p.Evaluate(password, name, email)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return errors.New(http.StatusBadRequest, "VALIDATION_ERROR", "Password does not meet the password policy").
+		WithDetails(map[string]interface{}{
+			"password": violations,
+			"strength": score,
+		})
+}
+
+// Evaluate returns the rules the password breaks and its strength score
+func (p *PasswordPolicy) Evaluate(password, name, email string) ([]PasswordViolation, int) {
+	violations := []PasswordViolation{}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    "too_short",
+			Message: "Password must be at least " + strconv.Itoa(p.MinLength) + " characters long",
+		})
+	}
+	if length > p.MaxLength {
+		violations = append(violations, PasswordViolation{
+			Code:    "too_long",
+			Message: "Password must be at most " + strconv.Itoa(p.MaxLength) + " characters long",
+		})
+	}
+
+	if p.MinCharacterClasses > 0 && characterClasses(password) < p.MinCharacterClasses {
+		violations = append(violations, PasswordViolation{
+			Code:    "character_classes",
+			Message: "Password must mix at least " + strconv.Itoa(p.MinCharacterClasses) + " of lowercase letters, uppercase letters, digits and symbols",
+		})
+	}
+
+	personal := personalInputs(name, email)
+	lower := strings.ToLower(password)
+	for _, input := range personal {
+		if strings.Contains(lower, input) {
+			violations = append(violations, PasswordViolation{
+				Code:    "personal_info",
+				Message: "Password must not contain your name or email address",
+			})
+			break
+		}
+	}
+
+	if p.Breached != nil && (p.Breached.Contains(password) || p.Breached.Contains(lower)) {
+		violations = append(violations, PasswordViolation{
+			Code:    "breached",
+			Message: "Password has appeared in a data breach and cannot be used",
+		})
+	}
+
+	score := passwordScore(password, personal)
+	if score < p.MinScore {
+		violations = append(violations, PasswordViolation{
+			Code:    "too_weak",
+			Message: "Password is too easy to guess; use a longer password or an uncommon phrase",
+		})
+	}
+
+	return violations, score
+}
+
+// characterClasses counts the character classes used in a password
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// personalInputs returns the lowercase parts of the name and email that a
+// password must not contain. Parts shorter than three characters are ignored.
+func personalInputs(name, email string) []string {
+	var inputs []string
+	add := func(s string) {
+		if s = strings.ToLower(strings.TrimSpace(s)); utf8.RuneCountInString(s) >= 3 {
+			inputs = append(inputs, s)
+		}
+	}
+
+	add(email)
+	if at := strings.LastIndexByte(email, '@'); at > 0 {
+		add(email[:at])
+	}
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		add(part)
+	}
+	return inputs
+}
+
+// bruteForceBits is the cost of a character that matches no pattern. Like
+// zxcvbn we assume a cardinality of 10 rather than the full character set,
+// as attackers try likely characters first.
+var bruteForceBits = math.Log2(10)
+
+// leetReplacements undoes common character substitutions before dictionary matching
+var leetReplacements = strings.NewReplacer("@", "a", "4", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t", "+", "t")
+
+// keyboardRows are the rows used to detect keyboard walks such as "qwerty" or "asdf"
+var keyboardRows = []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"}
+
+// passwordScore estimates how hard a password is to guess, in the spirit of
+// zxcvbn: dictionary words, the user's own details, repeats, sequences and
+// keyboard walks cost an attacker little, other characters cost more. The
+// estimated guesses map to a score from 0 to 4.
+func passwordScore(password string, personal []string) int {
+	runes := []rune(strings.ToLower(password))
+	unleeted := []rune(leetReplacements.Replace(string(runes)))
+	if len(unleeted) != len(runes) {
+		unleeted = runes
+	}
+
+	dictionary := append(append([]string{}, personal...), commonPasswordWords()...)
+
+	var bits float64
+	for i := 0; i < len(runes); {
+		// Dictionary words and personal details, longest match first
+		if word, rank := longestMatch(runes, unleeted, i, dictionary); word > 0 {
+			bits += math.Log2(float64(rank + 1))
+			if hasUpper(password, i, word) {
+				bits++
+			}
+			if string(runes[i:i+word]) != string(unleeted[i:i+word]) {
+				bits++
+			}
+			i += word
+			continue
+		}
+
+		switch {
+		case i > 0 && runes[i] == runes[i-1]:
+			bits++ // Repeat
+		case i > 0 && isSequence(runes[i-1], runes[i]):
+			bits++ // abc, 123, cba
+		case i > 0 && isKeyboardNeighbor(runes[i-1], runes[i]):
+			bits += 2 // qwerty, asdf
+		default:
+			bits += bruteForceBits
+		}
+		i++
+	}
+
+	// Score thresholds of zxcvbn in guesses: 10^3, 10^6, 10^8 and 10^10
+	log10 := bits * math.Log10(2)
+	switch {
+	case log10 < 3:
+		return 0
+	case log10 < 6:
+		return 1
+	case log10 < 8:
+		return 2
+	case log10 < 10:
+		return 3
+	}
+	return 4
+}
+
+// longestMatch finds the longest dictionary word starting at position i,
+// in either the plain or the unleeted password. It returns the word length
+// and its rank in the dictionary.
+func longestMatch(runes, unleeted []rune, i int, dictionary []string) (int, int) {
+	best, bestRank := 0, 0
+	for rank, word := range dictionary {
+		length := utf8.RuneCountInString(word)
+		if length <= best || length < 4 || i+length > len(runes) {
+			continue
+		}
+		if string(runes[i:i+length]) == word || string(unleeted[i:i+length]) == word {
+			best, bestRank = length, rank
+		}
+	}
+	return best, bestRank
+}
+
+var (
+	commonWords     []string
+	commonWordsOnce sync.Once
+)
+
+// commonPasswordWords returns the bundled common passwords, most common first
+func commonPasswordWords() []string {
+	commonWordsOnce.Do(func() {
+		for _, line := range strings.Split(commonPasswords, "\n") {
+			if line = strings.ToLower(strings.TrimSpace(line)); line != "" {
+				commonWords = append(commonWords, line)
+			}
+		}
+	})
+	return commonWords
+}
+
+func hasUpper(password string, start, length int) bool {
+	runes := []rune(password)
+	for _, r := range runes[start : start+length] {
+		if unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSequence(a, b rune) bool {
+	d := b - a
+	return (d == 1 || d == -1) && (unicode.IsLetter(a) && unicode.IsLetter(b) || unicode.IsDigit(a) && unicode.IsDigit(b))
+}
+
+func isKeyboardNeighbor(a, b rune) bool {
+	for _, row := range keyboardRows {
+		i := strings.IndexRune(row, a)
+		j := strings.IndexRune(row, b)
+		if i >= 0 && j >= 0 && (i-j == 1 || j-i == 1) {
+			return true
+		}
+	}
+	return false
+}
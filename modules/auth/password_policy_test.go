@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"go-fiber-gorm/core/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// violationCodes returns the codes of the violations in order
+func violationCodes(violations []PasswordViolation) []string {
+	codes := []string{}
+	for _, v := range violations {
+		codes = append(codes, v.Code)
+	}
+	return codes
+}
+
+func TestPasswordPolicyRules(t *testing.T) {
+	// An empty breached list and no score requirement isolate the other rules
+	noBreaches, err := newBreachedPasswords(strings.NewReader(""))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		want     []string
+	}{
+		{"long enough", PasswordPolicy{MinLength: 8}, "zq8vkw3m", []string{}},
+		{"too short", PasswordPolicy{MinLength: 8}, "zq8vkw3", []string{"too_short"}},
+		{"length counts characters, not bytes", PasswordPolicy{MinLength: 8}, "żółwkąpę", []string{}},
+		{"too long", PasswordPolicy{MinLength: 8, MaxLength: 10}, "zq8vkw3mxr7", []string{"too_long"}},
+		{"enough character classes", PasswordPolicy{MinCharacterClasses: 3}, "zq8Vkw3m", []string{}},
+		{"too few character classes", PasswordPolicy{MinCharacterClasses: 3}, "zq8vkw3m", []string{"character_classes"}},
+		{"symbols count as a class", PasswordPolicy{MinCharacterClasses: 3}, "zq8vk#3m", []string{}},
+		{"contains the name", PasswordPolicy{}, "xx-jane-42-zq", []string{"personal_info"}},
+		{"contains the email's local part", PasswordPolicy{}, "zqJANEDOE!8v", []string{"personal_info"}},
+		{"contains the whole email", PasswordPolicy{}, "janedoe@example.com", []string{"personal_info"}},
+		{"several rules at once", PasswordPolicy{MinLength: 12, MinCharacterClasses: 2}, "janedoe", []string{"too_short", "character_classes", "personal_info"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.policy.Breached = noBreaches
+			policy := NewPasswordPolicy(tt.policy)
+			policy.MinScore = 0
+
+			violations, _ := policy.Evaluate(tt.password, "Jane Doe", "janedoe@example.com")
+			assert.Equal(t, tt.want, violationCodes(violations))
+		})
+	}
+}
+
+func TestPasswordPolicyIgnoresShortPersonalParts(t *testing.T) {
+	// Parts under three characters would reject too many passwords
+	assert.Equal(t, []string{"al@example.com", "bob"}, personalInputs("Al Bob", "al@example.com"))
+}
+
+func TestPasswordScore(t *testing.T) {
+	tests := []struct {
+		password string
+		min, max int
+	}{
+		{"password", 0, 0},
+		{"P@ssw0rd", 0, 1},
+		{"qwertyuiop", 0, 1},
+		{"aaaaaaaaaaaa", 0, 1},
+		{"abcdefgh", 0, 0},
+		{"12345678", 0, 0},
+		{"zq8vkw3m", 3, 3},
+		{"correct horse battery staple", 4, 4},
+		{"Tr0ub4dor&3-x9Lq", 4, 4},
+	}
+
+	for _, tt := range tests {
+		score := passwordScore(tt.password, nil)
+		assert.GreaterOrEqual(t, score, tt.min, tt.password)
+		assert.LessOrEqual(t, score, tt.max, tt.password)
+	}
+
+	// The user's own details are as cheap to guess as dictionary words
+	assert.Less(t,
+		passwordScore("janedoe2024", personalInputs("Jane Doe", "janedoe@example.com")),
+		passwordScore("janedoe2024", nil))
+}
+
+func TestPasswordPolicyRejectsBreachedPasswords(t *testing.T) {
+	policy := NewPasswordPolicy(PasswordPolicy{})
+
+	// Listed passwords are also caught with different capitalization
+	for _, password := range []string{"letmein1", "LetMeIn1", "DRAGON"} {
+		violations, _ := policy.Evaluate(password, "", "")
+		assert.Contains(t, violationCodes(violations), "breached", password)
+	}
+
+	violations, _ := policy.Evaluate(testPassword, "", "")
+	assert.Empty(t, violations)
+}
+
+func TestCheckPasswordReturnsStructuredDetails(t *testing.T) {
+	policy := NewPasswordPolicy(PasswordPolicy{MinLength: 10})
+
+	assert.NoError(t, policy.CheckPassword(testPassword, "Jane Doe", "jane@example.com"))
+
+	err := policy.CheckPassword("password", "Jane Doe", "jane@example.com")
+	require.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, errors.StatusCode(err))
+
+	appErr := err.(*errors.AppError)
+	assert.Equal(t, "VALIDATION_ERROR", appErr.Code)
+
+	details, ok := appErr.Details.(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, 0, details["strength"])
+
+	violations, ok := details["password"].([]PasswordViolation)
+	require.True(t, ok)
+	assert.Equal(t, []string{"too_short", "breached", "too_weak"}, violationCodes(violations))
+	for _, v := range violations {
+		assert.NotEmpty(t, v.Message, v.Code)
+	}
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"go-fiber-gorm/core/errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Subject is the authenticated principal a policy rule is evaluated for.
+// OAuth clients have no roles or permissions, only scopes.
+type Subject struct {
+	Claims *Claims
+	Grants *Grants
+}
+
+// Rule is a policy rule. It reports whether the subject may access the
+// resource addressed by the request.
+type Rule func(ctx *fiber.Ctx, subject *Subject) bool
+
+// Self matches when the subject's user ID equals the given path parameter,
+// e.g. Self("id") for /users/:id
+func Self(param string) Rule {
+	return func(ctx *fiber.Ctx, subject *Subject) bool {
+		if subject.Claims.IsClient() {
+			return false
+		}
+		id, err := strconv.ParseUint(ctx.Params(param), 10, 32)
+		return err == nil && uint(id) == subject.Claims.UserID
+	}
+}
+
+// HasRole matches when the subject has at least one of the roles
+func HasRole(roles ...string) Rule {
+	return func(ctx *fiber.Ctx, subject *Subject) bool {
+		for _, role := range roles {
+			if subject.Grants.HasRole(role) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// HasPermission matches when the subject has all of the permissions
+func HasPermission(permissions ...string) Rule {
+	return func(ctx *fiber.Ctx, subject *Subject) bool {
+		for _, permission := range permissions {
+			if !subject.Grants.HasPermission(permission) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// HasScope matches when the token has all of the scopes, e.g. an OAuth
+// client token issued with them
+func HasScope(scopes ...string) Rule {
+	return func(ctx *fiber.Ctx, subject *Subject) bool {
+		for _, scope := range scopes {
+			if !hasScope(subject.Claims.Scopes, scope) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// AnyOf matches when at least one of the rules matches
+func AnyOf(rules ...Rule) Rule {
+	return func(ctx *fiber.Ctx, subject *Subject) bool {
+		for _, rule := range rules {
+			if rule(ctx, subject) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AllOf matches when every rule matches
+func AllOf(rules ...Rule) Rule {
+	return func(ctx *fiber.Ctx, subject *Subject) bool {
+		for _, rule := range rules {
+			if !rule(ctx, subject) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Authorize ensures the request is authenticated and satisfies the policy
+// rule, e.g. "self or admin":
+//
+//	Authorize(AnyOf(Self("id"), HasRole("admin")))
+func (m *Middleware) Authorize(rule Rule) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if err := m.authenticate(ctx); err != nil {
+			return err
+		}
+
+		claims, err := GetPrincipal(ctx)
+		if err != nil {
+			return err
+		}
+
+		grants := &Grants{}
+		if !claims.IsClient() {
+			if grants, err = m.grants(ctx); err != nil {
+				return err
+			}
+		}
+
+		if !rule(ctx, &Subject{Claims: claims, Grants: grants}) {
+			return errors.NewForbiddenError("You don't have permission to access this resource")
+		}
+
+		return ctx.Next()
+	}
+}
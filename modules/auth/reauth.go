@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"fmt"
+	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/core/logger"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// errReauthenticationRequired tells the client to prompt for the password or
+// a code and call POST /auth/reauth before retrying
+func errReauthenticationRequired(maxAge time.Duration) error {
+	return errors.New(http.StatusUnauthorized, "REAUTHENTICATION_REQUIRED", "Please confirm your identity to continue").
+		WithDetails(map[string]interface{}{"max_age": int64(maxAge.Seconds())})
+}
+
+// reauthChallenge is the WWW-Authenticate challenge of a step-up
+// authentication request (RFC 9470)
+func reauthChallenge(maxAge time.Duration) string {
+	return fmt.Sprintf(`Bearer error="insufficient_user_authentication", error_description="A more recent authentication is required", max_age=%d`, int64(maxAge.Seconds()))
+}
+
+// Reauthenticate confirms the identity of a signed-in user with their
+// password or a TOTP or recovery code, and issues a new access token for the
+// same session with a fresh "auth_time". The refresh token is unchanged.
+// Failures count towards the login lockout.
+func (s *Service) Reauthenticate(claims *Claims, req *ReauthRequest, meta RequestMeta) (*TokenResponse, error) {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return nil, errors.NewValidationError(err)
+	}
+	if (req.Password == "") == (req.Code == "") {
+		return nil, errors.NewBadRequestError("Provide either a password or a verification code")
+	}
+
+	// Tokens issued before sessions were tracked cannot be refreshed in place
+	if claims.SessionID == 0 {
+		return nil, errors.NewBadRequestError("Please log in again")
+	}
+	session, err := s.repo.FindSessionByID(claims.SessionID)
+	if err != nil || session.UserID != claims.UserID || session.IsBlocked || session.ExpiresAt.Before(time.Now()) {
+		return nil, errors.NewUnauthorizedError("Session is no longer active")
+	}
+
+	foundUser, err := s.userRepo.FindByID(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	email := normalizeEmail(foundUser.Email)
+	if err := s.checkLoginAllowed(email, meta.IP); err != nil {
+		return nil, err
+	}
+
+	method := LoginMethodPassword
+	if req.Password != "" {
+		if valid, _ := s.verifyPassword(foundUser, req.Password); !valid {
+			s.recordLoginFailure(email, meta)
+			return nil, errors.NewUnauthorizedError("Invalid password")
+		}
+	} else {
+		method = LoginMethodMFA
+		if err := s.confirmSecondFactor(foundUser, req.Code, meta); err != nil {
+			return nil, err
+		}
+	}
+	s.resetLoginFailures(email)
+
+	now := time.Now()
+	if err := s.repo.UpdateSessionAuthTime(session.ID, now); err != nil {
+		return nil, errors.NewInternalServerError("Failed to update session")
+	}
+	session.AuthenticatedAt = &now
+
+	tokenDetails := &TokenDetails{SessionID: session.ID}
+	if err := s.generateAccessToken(tokenDetails, foundUser, session); err != nil {
+		return nil, errors.NewInternalServerError("Failed to generate token")
+	}
+
+	logger.SecurityEvent("reauthenticated", logrus.Fields{
+		"user_id":    foundUser.ID,
+		"session_id": session.ID,
+		"method":     method,
+		"ip":         meta.IP,
+	})
+
+	return &TokenResponse{
+		AccessToken: tokenDetails.AccessToken,
+		ExpiresIn:   tokenDetails.AtExpires - now.Unix(),
+		TokenType:   "Bearer",
+	}, nil
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"go-fiber-gorm/core/errors"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -23,10 +24,11 @@ func (r *Repository) CreateSession(session *Session) error {
 	return r.DB.Create(session).Error
 }
 
-// FindSessionByToken finds a session by refresh token
+// FindSessionByToken finds an active session by refresh token. Sessions are
+// looked up by the digest of the token, never by the token itself.
 func (r *Repository) FindSessionByToken(refreshToken string) (*Session, error) {
 	var session Session
-	err := r.DB.Where("refresh_token = ? AND is_blocked = ?", refreshToken, false).First(&session).Error
+	err := r.DB.Where("refresh_token_hash = ? AND is_blocked = ?", hashToken(refreshToken), false).First(&session).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, errors.NewNotFoundError("Session")
@@ -36,6 +38,49 @@ func (r *Repository) FindSessionByToken(refreshToken string) (*Session, error) {
 	return &session, nil
 }
 
+// FindSessionByTokenAnyState finds a session by refresh token, including blocked sessions
+func (r *Repository) FindSessionByTokenAnyState(refreshToken string) (*Session, error) {
+	var session Session
+	err := r.DB.Where("refresh_token_hash = ?", hashToken(refreshToken)).First(&session).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError("Session")
+		}
+		return nil, errors.NewInternalServerError(err.Error())
+	}
+	return &session, nil
+}
+
+// ClaimSessionForRotation blocks a session that is about to be replaced. It
+// returns false if the session was already blocked, so a refresh token can
+// only be rotated once even under concurrent requests.
+func (r *Repository) ClaimSessionForRotation(sessionID uint) (bool, error) {
+	result := r.DB.Model(&Session{}).
+		Where("id = ? AND is_blocked = ?", sessionID, false).
+		Update("is_blocked", true)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// SetSessionReplacedBy links a rotated-out session to its successor
+func (r *Repository) SetSessionReplacedBy(sessionID, replacedByID uint) error {
+	return r.DB.Model(&Session{}).Where("id = ?", sessionID).Update("replaced_by_id", replacedByID).Error
+}
+
+// FindSessionIDsByFamily returns the IDs of all sessions in a token family
+func (r *Repository) FindSessionIDsByFamily(familyID string) ([]uint, error) {
+	var ids []uint
+	err := r.DB.Model(&Session{}).Where("family_id = ?", familyID).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// InvalidateSessionFamily marks all sessions in a token family as blocked
+func (r *Repository) InvalidateSessionFamily(familyID string) error {
+	return r.DB.Model(&Session{}).Where("family_id = ?", familyID).Update("is_blocked", true).Error
+}
+
 // InvalidateSession marks a session as blocked
 func (r *Repository) InvalidateSession(sessionID uint) error {
 	return r.DB.Model(&Session{}).Where("id = ?", sessionID).Update("is_blocked", true).Error
@@ -50,3 +95,268 @@ func (r *Repository) InvalidateAllUserSessions(userID uint) error {
 func (r *Repository) DeleteExpiredSessions() error {
 	return r.DB.Where("expires_at < NOW()").Delete(&Session{}).Error
 }
+
+// CreatePasswordResetToken stores a new password reset token
+func (r *Repository) CreatePasswordResetToken(token *PasswordResetToken) error {
+	return r.DB.Create(token).Error
+}
+
+// FindPasswordResetToken finds an unused password reset token by its hash
+func (r *Repository) FindPasswordResetToken(tokenHash string) (*PasswordResetToken, error) {
+	var token PasswordResetToken
+	err := r.DB.Where("token_hash = ? AND used_at IS NULL", tokenHash).First(&token).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError("Password reset token")
+		}
+		return nil, errors.NewInternalServerError(err.Error())
+	}
+	return &token, nil
+}
+
+// ConsumePasswordResetToken marks a reset token as used. It returns false if
+// the token had already been used, so concurrent requests cannot both succeed.
+func (r *Repository) ConsumePasswordResetToken(tokenID uint) (bool, error) {
+	result := r.DB.Model(&PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", tokenID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// DeleteUserPasswordResetTokens deletes all password reset tokens for a user
+func (r *Repository) DeleteUserPasswordResetTokens(userID uint) error {
+	return r.DB.Where("user_id = ?", userID).Delete(&PasswordResetToken{}).Error
+}
+
+// FindTOTPFactor finds the TOTP factor of a user
+func (r *Repository) FindTOTPFactor(userID uint) (*TOTPFactor, error) {
+	var factor TOTPFactor
+	err := r.DB.Where("user_id = ?", userID).First(&factor).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError("TOTP factor")
+		}
+		return nil, errors.NewInternalServerError(err.Error())
+	}
+	return &factor, nil
+}
+
+// HasConfirmedTOTPFactor reports whether the user has two-factor authentication enabled
+func (r *Repository) HasConfirmedTOTPFactor(userID uint) (bool, error) {
+	var count int64
+	err := r.DB.Model(&TOTPFactor{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// SaveTOTPFactor creates or replaces the TOTP factor of a user
+func (r *Repository) SaveTOTPFactor(factor *TOTPFactor) error {
+	return r.DB.Save(factor).Error
+}
+
+// AdvanceTOTPStep records the last used TOTP time step. It returns false if
+// the step is not newer than the stored one, i.e. the code was replayed.
+func (r *Repository) AdvanceTOTPStep(factorID uint, step int64) (bool, error) {
+	result := r.DB.Model(&TOTPFactor{}).
+		Where("id = ? AND last_used_step < ?", factorID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// DeleteTOTPFactor removes the TOTP factor and recovery codes of a user
+func (r *Repository) DeleteTOTPFactor(userID uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&TOTPFactor{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error
+	})
+}
+
+// ReplaceRecoveryCodes deletes the existing recovery codes of a user and stores new ones
+func (r *Repository) ReplaceRecoveryCodes(userID uint, codes []RecoveryCode) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// ConsumeRecoveryCode marks an unused recovery code as used.
+// It returns false if no matching unused code exists.
+func (r *Repository) ConsumeRecoveryCode(userID uint, codeHash string) (bool, error) {
+	result := r.DB.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// UpdateSessionAuthTime records that the user re-authenticated in a session
+func (r *Repository) UpdateSessionAuthTime(sessionID uint, authenticatedAt time.Time) error {
+	return r.DB.Model(&Session{}).Where("id = ?", sessionID).Update("authenticated_at", authenticatedAt).Error
+}
+
+// FindSessionByID finds a session by ID
+func (r *Repository) FindSessionByID(sessionID uint) (*Session, error) {
+	var session Session
+	err := r.DB.First(&session, sessionID).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError("Session")
+		}
+		return nil, errors.NewInternalServerError(err.Error())
+	}
+	return &session, nil
+}
+
+// FindActiveUserSessions returns the sessions of a user that are neither blocked nor expired
+func (r *Repository) FindActiveUserSessions(userID uint) ([]Session, error) {
+	var sessions []Session
+	err := r.DB.Where("user_id = ? AND is_blocked = ? AND expires_at > ?", userID, false, time.Now()).
+		Order("created_at desc").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, errors.NewInternalServerError(err.Error())
+	}
+	return sessions, nil
+}
+
+// FindOAuthIdentity finds the identity of a provider account
+func (r *Repository) FindOAuthIdentity(provider, subject string) (*OAuthIdentity, error) {
+	var identity OAuthIdentity
+	err := r.DB.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError("OAuth identity")
+		}
+		return nil, errors.NewInternalServerError(err.Error())
+	}
+	return &identity, nil
+}
+
+// CreateOAuthIdentity links a provider account to a user
+func (r *Repository) CreateOAuthIdentity(identity *OAuthIdentity) error {
+	return r.DB.Create(identity).Error
+}
+
+// CreateWebAuthnCredential stores a new passkey
+func (r *Repository) CreateWebAuthnCredential(credential *WebAuthnCredential) error {
+	return r.DB.Create(credential).Error
+}
+
+// FindWebAuthnCredential finds a passkey by its credential ID
+func (r *Repository) FindWebAuthnCredential(credentialID string) (*WebAuthnCredential, error) {
+	var credential WebAuthnCredential
+	err := r.DB.Where("credential_id = ?", credentialID).First(&credential).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError("Passkey")
+		}
+		return nil, errors.NewInternalServerError(err.Error())
+	}
+	return &credential, nil
+}
+
+// FindUserWebAuthnCredentials returns the passkeys of a user
+func (r *Repository) FindUserWebAuthnCredentials(userID uint) ([]WebAuthnCredential, error) {
+	var credentials []WebAuthnCredential
+	err := r.DB.Where("user_id = ?", userID).
+		Order("created_at desc").
+		Find(&credentials).Error
+	if err != nil {
+		return nil, errors.NewInternalServerError(err.Error())
+	}
+	return credentials, nil
+}
+
+// UpdateWebAuthnSignCount records a passkey use. It returns false if the
+// stored counter changed in the meantime, i.e. the assertion raced another.
+func (r *Repository) UpdateWebAuthnSignCount(id uint, previous, signCount uint32) (bool, error) {
+	result := r.DB.Model(&WebAuthnCredential{}).
+		Where("id = ? AND sign_count = ?", id, previous).
+		Updates(map[string]interface{}{
+			"sign_count":   signCount,
+			"last_used_at": time.Now(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// DeleteWebAuthnCredential removes one of a user's passkeys.
+// It returns false if the user has no such passkey.
+func (r *Repository) DeleteWebAuthnCredential(userID, id uint) (bool, error) {
+	result := r.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&WebAuthnCredential{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CreateAuditLog stores an audit log entry
+func (r *Repository) CreateAuditLog(entry *AuditLog) error {
+	return r.DB.Create(entry).Error
+}
+
+// CreateLoginEvent stores a login attempt
+func (r *Repository) CreateLoginEvent(event *LoginEvent) error {
+	return r.DB.Create(event).Error
+}
+
+// HasSuccessfulLogin reports whether the user ever logged in successfully,
+// from the device with the given fingerprint unless it is empty
+func (r *Repository) HasSuccessfulLogin(userID uint, fingerprint string) (bool, error) {
+	query := r.DB.Model(&LoginEvent{}).Where("user_id = ? AND success = ?", userID, true)
+	if fingerprint != "" {
+		query = query.Where("device_fingerprint = ?", fingerprint)
+	}
+
+	var count int64
+	if err := query.Limit(1).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// FindUserLoginEvents returns the login events of a user, newest first, with pagination
+func (r *Repository) FindUserLoginEvents(userID uint, page, limit int) ([]LoginEvent, int64, error) {
+	var events []LoginEvent
+	var count int64
+
+	// Count total records
+	if err := r.DB.Model(&LoginEvent{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return nil, 0, errors.NewInternalServerError(err.Error())
+	}
+
+	// Get paginated records
+	offset := (page - 1) * limit
+	err := r.DB.Where("user_id = ?", userID).
+		Order("created_at desc").
+		Offset(offset).
+		Limit(limit).
+		Find(&events).Error
+	if err != nil {
+		return nil, 0, errors.NewInternalServerError(err.Error())
+	}
+
+	return events, count, nil
+}
+
+// DeleteLoginEventsBefore removes login events older than cutoff and
+// returns how many were deleted
+func (r *Repository) DeleteLoginEventsBefore(cutoff time.Time) (int64, error) {
+	result := r.DB.Where("created_at < ?", cutoff).Delete(&LoginEvent{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"go-fiber-gorm/core/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogoutAllRevokesEarlierTokensOnly(t *testing.T) {
+	service, _ := newTestService(t, ServiceConfig{AccessExpiry: 15 * time.Minute})
+	u := createTestUser(t, service, "jane@example.com")
+
+	before, err := service.startSession(u, LoginMethodPassword, RequestMeta{})
+	require.NoError(t, err)
+
+	// Revocations are kept to the millisecond; the steps below usually all
+	// happen within the same "iat" second
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, service.LogoutAll(u.ID))
+	time.Sleep(2 * time.Millisecond)
+
+	_, err = service.ValidateToken(before.Token.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, errors.StatusCode(err))
+
+	after, err := service.startSession(u, LoginMethodPassword, RequestMeta{})
+	require.NoError(t, err)
+
+	claims, err := service.ValidateToken(after.Token.AccessToken)
+	require.NoError(t, err, "tokens issued after the revocation stay valid")
+	assert.Equal(t, u.ID, claims.UserID)
+}
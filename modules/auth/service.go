@@ -1,54 +1,252 @@
 package auth
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"go-fiber-gorm/core/cache"
 	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/core/logger"
+	"go-fiber-gorm/core/mailer"
 	"go-fiber-gorm/modules/user"
+	"net/http"
+	"net/url"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/golang-jwt/jwt/v4"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/sirupsen/logrus"
 )
 
 // Service handles auth-related business logic
 type Service struct {
-	repo          *Repository
-	userRepo      *user.Repository
-	validator     *validator.Validate
-	jwtSecret     string
-	accessExpiry  time.Duration
-	refreshExpiry time.Duration
+	repo             *Repository
+	userRepo         *user.Repository
+	validator        *validator.Validate
+	passwords        *user.PasswordHasher
+	passwordPolicy   *PasswordPolicy
+	mailQueue        mailer.Mailer
+	revocations      *cache.RevocationStore
+	apiKeys          APIKeyAuthenticator
+	clients          ClientAuthenticator
+	permissions      PermissionResolver
+	store            cache.Store
+	oauthProviders   map[string]*oidcProvider
+	webauthn         WebAuthnConfig
+	cookies          CookieConfig
+	attempts         *cache.AttemptStore
+	lockout          LockoutPolicy
+	jwtSecret        string
+	keys             *KeySet
+	accessExpiry     time.Duration
+	refreshExpiry    time.Duration
+	resetExpiry      time.Duration
+	passwordResetURL string
+
+	verificationExpiry       time.Duration
+	emailVerificationURL     string
+	requireEmailVerification bool
+
+	magicLinkExpiry time.Duration
+	magicLinkURL    string
+
+	impersonationExpiry time.Duration
+
+	clientTokenExpiry time.Duration
+	audience          string
+
+	reauthMaxAge time.Duration
+
+	registrationMode string
+	invitations      InvitationRedeemer
+
+	loginHistoryRetention time.Duration
+	notifyNewDevices      bool
+
+	mfaIssuer string
 }
 
 // ServiceConfig contains configuration for the auth service
 type ServiceConfig struct {
-	JWTSecret     string
-	AccessExpiry  time.Duration // Usually short, e.g., 15 minutes
-	RefreshExpiry time.Duration // Usually longer, e.g., 7 days
+	JWTSecret           string
+	Keys                *KeySet              // Access token signing keys; defaults to HS256 with JWTSecret
+	AccessExpiry        time.Duration        // Usually short, e.g., 15 minutes
+	RefreshExpiry       time.Duration        // Usually longer, e.g., 7 days
+	PasswordResetExpiry time.Duration        // Lifetime of a password reset token, e.g., 1 hour
+	PasswordResetURL    string               // Frontend page the reset token is appended to
+	Mailer              mailer.Mailer        // Sends mail; defaults to a log mailer
+	PasswordHasher      *user.PasswordHasher // Defaults to argon2id with the default parameters
+	PasswordPolicy      *PasswordPolicy      // Rules for new passwords; defaults to NewPasswordPolicy with zero values
+
+	Revocations *cache.RevocationStore // Revoked access tokens; defaults to an in-memory store
+	APIKeys     APIKeyAuthenticator    // Resolves API keys; API key authentication is disabled when nil
+	Clients     ClientAuthenticator    // Verifies OAuth client credentials; the client credentials grant is disabled when nil
+	Permissions PermissionResolver     // Resolves roles and permissions; only the user's role applies when nil
+	Store       cache.Store            // Short-lived flow state such as OAuth states; defaults to an in-memory store
+
+	OAuthProviders []OAuthProviderConfig // OpenID Connect providers for social login
+	WebAuthn       WebAuthnConfig        // Relying party for passkeys; the RP ID defaults to the host of the first origin
+	Cookies        CookieConfig          // Cookie transport for browser clients; tokens are returned in the body by default
+	Attempts       *cache.AttemptStore   // Failed login counters; defaults to an in-memory store
+	Lockout        LockoutPolicy         // Brute-force protection thresholds; zero values use defaults
+
+	EmailVerificationExpiry  time.Duration // Lifetime of an email verification link, e.g., 24 hours
+	EmailVerificationURL     string        // Frontend page the verification token is appended to
+	RequireEmailVerification bool          // Block login until the email is verified
+
+	MagicLinkExpiry time.Duration // Lifetime of a passwordless sign-in link, e.g., 15 minutes
+	MagicLinkURL    string        // Frontend page the sign-in token is appended to
+
+	ImpersonationExpiry time.Duration // Lifetime of an admin impersonation token, e.g., 15 minutes
+
+	ClientTokenExpiry time.Duration // Lifetime of a client credentials access token, e.g., 15 minutes
+	Audience          string        // Identifier of this API; client tokens for other audiences are rejected
+
+	ReauthMaxAge time.Duration // How recently the user must have authenticated for sensitive operations, e.g., 5 minutes
+
+	RegistrationMode string             // open, invite or disabled; defaults to open
+	Invitations      InvitationRedeemer // Accepts invitations; invitations cannot be accepted when nil
+
+	LoginHistoryRetention time.Duration // How long login events are kept, e.g., 90 days
+	NotifyNewDevices      bool          // Email users when they log in from a new device
+	MailQueue             mailer.Mailer // Delivers mail in the background so responses do not wait for it; defaults to a queue in front of Mailer
+
+	MFAIssuer string // Issuer shown in authenticator apps
 }
 
 // NewService creates a new auth service
 func NewService(repo *Repository, userRepo *user.Repository, config ServiceConfig) *Service {
+	if config.Mailer == nil {
+		config.Mailer = mailer.NewLogMailer()
+	}
+	if config.PasswordHasher == nil {
+		config.PasswordHasher = user.NewPasswordHasher(user.Argon2Params{})
+	}
+	if config.PasswordPolicy == nil {
+		config.PasswordPolicy = NewPasswordPolicy(PasswordPolicy{})
+	}
+	if config.PasswordResetExpiry <= 0 {
+		config.PasswordResetExpiry = time.Hour
+	}
+	if config.EmailVerificationExpiry <= 0 {
+		config.EmailVerificationExpiry = 24 * time.Hour
+	}
+	if config.MagicLinkExpiry <= 0 {
+		config.MagicLinkExpiry = 15 * time.Minute
+	}
+	if config.ImpersonationExpiry <= 0 {
+		config.ImpersonationExpiry = 15 * time.Minute
+	}
+	if config.ClientTokenExpiry <= 0 {
+		config.ClientTokenExpiry = 15 * time.Minute
+	}
+	if config.Revocations == nil {
+		config.Revocations = cache.NewRevocationStore(cache.NewMemoryStore())
+	}
+	if config.Attempts == nil {
+		config.Attempts = cache.NewAttemptStore(cache.NewMemoryStore())
+	}
+	if config.Store == nil {
+		config.Store = cache.NewMemoryStore()
+	}
+	if config.Keys == nil {
+		config.Keys = NewHMACKeySet(config.JWTSecret)
+	}
+	if config.MailQueue == nil {
+		config.MailQueue = mailer.NewQueueMailer(config.Mailer, 100)
+	}
+	if config.LoginHistoryRetention <= 0 {
+		config.LoginHistoryRetention = 90 * 24 * time.Hour
+	}
+	if config.ReauthMaxAge <= 0 {
+		config.ReauthMaxAge = 5 * time.Minute
+	}
+	if config.RegistrationMode == "" {
+		config.RegistrationMode = RegistrationOpen
+	}
+	if config.MFAIssuer == "" {
+		config.MFAIssuer = "fiber-gorm-api"
+	}
+	if config.WebAuthn.RPID == "" && len(config.WebAuthn.Origins) > 0 {
+		config.WebAuthn.RPID = originHost(config.WebAuthn.Origins[0])
+	}
+	if config.WebAuthn.RPName == "" {
+		config.WebAuthn.RPName = config.MFAIssuer
+	}
+
+	oauthProviders := make(map[string]*oidcProvider, len(config.OAuthProviders))
+	for _, provider := range config.OAuthProviders {
+		oauthProviders[provider.Name] = newOIDCProvider(provider)
+	}
+
 	return &Service{
-		repo:          repo,
-		userRepo:      userRepo,
-		validator:     validator.New(),
-		jwtSecret:     config.JWTSecret,
-		accessExpiry:  config.AccessExpiry,
-		refreshExpiry: config.RefreshExpiry,
+		repo:             repo,
+		userRepo:         userRepo,
+		validator:        validator.New(),
+		passwords:        config.PasswordHasher,
+		passwordPolicy:   config.PasswordPolicy,
+		mailQueue:        config.MailQueue,
+		revocations:      config.Revocations,
+		apiKeys:          config.APIKeys,
+		clients:          config.Clients,
+		permissions:      config.Permissions,
+		store:            config.Store,
+		oauthProviders:   oauthProviders,
+		webauthn:         config.WebAuthn,
+		cookies:          config.Cookies.withDefaults(),
+		attempts:         config.Attempts,
+		lockout:          config.Lockout.withDefaults(),
+		jwtSecret:        config.JWTSecret,
+		keys:             config.Keys,
+		accessExpiry:     config.AccessExpiry,
+		refreshExpiry:    config.RefreshExpiry,
+		resetExpiry:      config.PasswordResetExpiry,
+		passwordResetURL: config.PasswordResetURL,
+
+		verificationExpiry:       config.EmailVerificationExpiry,
+		emailVerificationURL:     config.EmailVerificationURL,
+		requireEmailVerification: config.RequireEmailVerification,
+
+		magicLinkExpiry: config.MagicLinkExpiry,
+		magicLinkURL:    config.MagicLinkURL,
+
+		impersonationExpiry: config.ImpersonationExpiry,
+
+		clientTokenExpiry: config.ClientTokenExpiry,
+		audience:          config.Audience,
+
+		reauthMaxAge: config.ReauthMaxAge,
+
+		registrationMode: config.RegistrationMode,
+		invitations:      config.Invitations,
+
+		loginHistoryRetention: config.LoginHistoryRetention,
+		notifyNewDevices:      config.NotifyNewDevices,
+
+		mfaIssuer: config.MFAIssuer,
 	}
 }
 
 // Register registers a new user
-func (s *Service) Register(req *RegisterRequest) (*AuthResponse, error) {
+func (s *Service) Register(req *RegisterRequest, meta RequestMeta) (*AuthResponse, error) {
+	// Closed deployments only create accounts through invitations
+	if s.registrationMode != RegistrationOpen {
+		return nil, s.errRegistrationClosed()
+	}
+
 	// Validate request
 	if err := s.validator.Struct(req); err != nil {
 		return nil, errors.NewValidationError(err)
 	}
 
+	if err := s.passwordPolicy.CheckPassword(req.Password, req.Name, req.Email); err != nil {
+		return nil, err
+	}
+
 	// Check if user with this email already exists
 	existingUser, err := s.userRepo.FindByEmail(req.Email)
 	if err == nil && existingUser != nil {
@@ -56,7 +254,7 @@ func (s *Service) Register(req *RegisterRequest) (*AuthResponse, error) {
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := s.passwords.Hash(req.Password)
 	if err != nil {
 		return nil, errors.NewInternalServerError("Failed to hash password")
 	}
@@ -65,7 +263,7 @@ func (s *Service) Register(req *RegisterRequest) (*AuthResponse, error) {
 	newUser := &user.User{
 		Name:     req.Name,
 		Email:    req.Email,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
 		Role:     "user", // Default role
 	}
 
@@ -73,117 +271,112 @@ func (s *Service) Register(req *RegisterRequest) (*AuthResponse, error) {
 		return nil, errors.NewInternalServerError("Failed to create user")
 	}
 
-	// Generate tokens
-	tokenDetails, err := s.generateTokens(newUser.ID, newUser.Email, newUser.Role)
-	if err != nil {
-		return nil, errors.NewInternalServerError("Failed to generate tokens")
-	}
-
-	// Save session
-	session := &Session{
-		UserID:       newUser.ID,
-		RefreshToken: tokenDetails.RefreshToken,
-		UserAgent:    "Not provided", // Should be extracted from request context in actual implementation
-		ClientIP:     "Not provided", // Should be extracted from request context in actual implementation
-		ExpiresAt:    time.Unix(tokenDetails.RtExpires, 0),
-	}
-
-	if err := s.repo.CreateSession(session); err != nil {
-		return nil, errors.NewInternalServerError("Failed to create session")
+	// Send the verification email; registration succeeds even if it fails
+	if err := s.sendVerificationEmail(newUser); err != nil {
+		logger.Error("Failed to send verification email:", err)
 	}
 
-	// Prepare response
-	response := &AuthResponse{
-		User: UserInfo{
-			ID:    newUser.ID,
-			Name:  newUser.Name,
-			Email: newUser.Email,
-			Role:  newUser.Role,
-		},
-		Token: TokenResponse{
-			AccessToken:  tokenDetails.AccessToken,
-			RefreshToken: tokenDetails.RefreshToken,
-			ExpiresIn:    tokenDetails.AtExpires - time.Now().Unix(),
-			TokenType:    "Bearer",
-		},
+	// Users must verify their email before they get a session
+	if s.requireEmailVerification {
+		return &AuthResponse{User: newUserInfo(newUser)}, nil
 	}
 
-	return response, nil
+	return s.startSession(newUser, LoginMethodRegister, meta)
 }
 
 // Login authenticates a user
-func (s *Service) Login(req *LoginRequest) (*AuthResponse, error) {
+func (s *Service) Login(req *LoginRequest, meta RequestMeta) (*LoginResponse, error) {
 	// Validate request
 	if err := s.validator.Struct(req); err != nil {
 		return nil, errors.NewValidationError(err)
 	}
 
+	// Reject locked accounts and IPs before checking the password
+	email := normalizeEmail(req.Email)
+	if err := s.checkLoginAllowed(email, meta.IP); err != nil {
+		s.loginFailed(nil, email, LoginMethodPassword, LoginFailureLocked, meta)
+		return nil, err
+	}
+
 	// Find user by email
 	foundUser, err := s.userRepo.FindByEmail(req.Email)
 	if err != nil {
+		s.recordLoginFailure(email, meta)
+		s.loginFailed(nil, email, LoginMethodPassword, LoginFailureInvalidCredentials, meta)
 		return nil, errors.NewUnauthorizedError("Invalid credentials")
 	}
 
 	// Verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(foundUser.Password), []byte(req.Password)); err != nil {
+	valid, needsRehash := s.verifyPassword(foundUser, req.Password)
+	if !valid {
+		s.recordLoginFailure(email, meta)
+		s.loginFailed(foundUser, email, LoginMethodPassword, LoginFailureInvalidCredentials, meta)
 		return nil, errors.NewUnauthorizedError("Invalid credentials")
 	}
+	s.resetLoginFailures(email)
 
-	// Generate tokens
-	tokenDetails, err := s.generateTokens(foundUser.ID, foundUser.Email, foundUser.Role)
-	if err != nil {
-		return nil, errors.NewInternalServerError("Failed to generate tokens")
+	// Upgrade bcrypt hashes and hashes with outdated parameters
+	if needsRehash {
+		s.rehashPassword(foundUser, req.Password)
 	}
 
-	// Save session
-	session := &Session{
-		UserID:       foundUser.ID,
-		RefreshToken: tokenDetails.RefreshToken,
-		UserAgent:    "Not provided", // Should be extracted from request context
-		ClientIP:     "Not provided", // Should be extracted from request context
-		ExpiresAt:    time.Unix(tokenDetails.RtExpires, 0),
+	// Block unverified users when verification is required
+	if s.requireEmailVerification && !foundUser.IsEmailVerified() {
+		s.loginFailed(foundUser, email, LoginMethodPassword, LoginFailureEmailNotVerified, meta)
+		return nil, errors.New(http.StatusForbidden, "EMAIL_NOT_VERIFIED", "Please verify your email address before logging in")
 	}
 
-	if err := s.repo.CreateSession(session); err != nil {
-		return nil, errors.NewInternalServerError("Failed to create session")
+	return s.completeLogin(foundUser, LoginMethodPassword, meta)
+}
+
+// completeLogin finishes a login once the first factor has been verified.
+// Users with two-factor authentication get a short-lived MFA token first.
+func (s *Service) completeLogin(u *user.User, method string, meta RequestMeta) (*LoginResponse, error) {
+	mfaEnabled, err := s.repo.HasConfirmedTOTPFactor(u.ID)
+	if err != nil {
+		return nil, errors.NewInternalServerError("Failed to check two-factor authentication")
+	}
+	if mfaEnabled {
+		return s.startMFAChallenge(u, method)
 	}
 
-	// Prepare response
-	response := &AuthResponse{
-		User: UserInfo{
-			ID:    foundUser.ID,
-			Name:  foundUser.Name,
-			Email: foundUser.Email,
-			Role:  foundUser.Role,
-		},
-		Token: TokenResponse{
-			AccessToken:  tokenDetails.AccessToken,
-			RefreshToken: tokenDetails.RefreshToken,
-			ExpiresIn:    tokenDetails.AtExpires - time.Now().Unix(),
-			TokenType:    "Bearer",
-		},
+	authResponse, err := s.startSession(u, method, meta)
+	if err != nil {
+		return nil, err
 	}
 
-	return response, nil
+	return &LoginResponse{AuthResponse: authResponse}, nil
 }
 
 // RefreshToken refreshes an access token using a refresh token
-func (s *Service) RefreshToken(req *RefreshTokenRequest) (*TokenResponse, error) {
+func (s *Service) RefreshToken(req *RefreshTokenRequest, meta RequestMeta) (*TokenResponse, error) {
 	// Validate request
 	if err := s.validator.Struct(req); err != nil {
 		return nil, errors.NewValidationError(err)
 	}
 
-	// Find session by refresh token
-	session, err := s.repo.FindSessionByToken(req.RefreshToken)
+	// Find session by refresh token, including blocked ones so that replayed
+	// tokens can be detected
+	session, err := s.repo.FindSessionByTokenAnyState(req.RefreshToken)
 	if err != nil {
 		return nil, errors.NewUnauthorizedError("Invalid refresh token")
 	}
 
+	// A rotated-out token being presented again means it has leaked
+	if session.IsRotated() {
+		s.refreshFailed(session, LoginFailureTokenReuse, meta)
+		return nil, s.handleRefreshTokenReuse(session, meta)
+	}
+	if session.IsBlocked {
+		s.refreshFailed(session, LoginFailureSessionRevoked, meta)
+		return nil, errors.NewUnauthorizedError("Invalid refresh token")
+	}
+
 	// Check if session is expired
 	if session.ExpiresAt.Before(time.Now()) {
 		// Invalidate session
 		_ = s.repo.InvalidateSession(session.ID)
+		s.refreshFailed(session, LoginFailureSessionExpired, meta)
 		return nil, errors.NewUnauthorizedError("Refresh token expired")
 	}
 
@@ -193,29 +386,37 @@ func (s *Service) RefreshToken(req *RefreshTokenRequest) (*TokenResponse, error)
 		return nil, errors.NewInternalServerError("Failed to find user")
 	}
 
-	// Generate new tokens
-	tokenDetails, err := s.generateTokens(foundUser.ID, foundUser.Email, foundUser.Role)
+	// Invalidate old session; losing this race means the token was used twice
+	claimed, err := s.repo.ClaimSessionForRotation(session.ID)
 	if err != nil {
-		return nil, errors.NewInternalServerError("Failed to generate tokens")
-	}
-
-	// Invalidate old session
-	if err := s.repo.InvalidateSession(session.ID); err != nil {
 		return nil, errors.NewInternalServerError("Failed to invalidate old session")
 	}
+	if !claimed {
+		s.loginFailed(foundUser, "", LoginMethodRefresh, LoginFailureTokenReuse, meta)
+		return nil, s.handleRefreshTokenReuse(session, meta)
+	}
 
-	// Create new session
-	newSession := &Session{
-		UserID:       foundUser.ID,
-		RefreshToken: tokenDetails.RefreshToken,
-		UserAgent:    session.UserAgent, // Preserve user agent
-		ClientIP:     session.ClientIP,  // Preserve client IP
-		ExpiresAt:    time.Unix(tokenDetails.RtExpires, 0),
+	// Create new session with the current client details, keeping the
+	// previous ones for anything the client did not send this time
+	if meta.IP == "" {
+		meta.IP = session.ClientIP
+	}
+	if meta.UserAgent == "" {
+		meta.UserAgent = session.UserAgent
+	}
+	if meta.DeviceName == "" {
+		meta.DeviceName = session.DeviceName
+	}
+	tokenDetails, err := s.createSession(foundUser, meta, session.FamilyID, session.AuthenticatedAt)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.repo.CreateSession(newSession); err != nil {
-		return nil, errors.NewInternalServerError("Failed to create new session")
+	// Link the old session to its successor
+	if err := s.repo.SetSessionReplacedBy(session.ID, tokenDetails.SessionID); err != nil {
+		return nil, errors.NewInternalServerError("Failed to rotate session")
 	}
+	s.loginSucceeded(foundUser, LoginMethodRefresh, meta)
 
 	// Return new tokens
 	return &TokenResponse{
@@ -226,8 +427,65 @@ func (s *Service) RefreshToken(req *RefreshTokenRequest) (*TokenResponse, error)
 	}, nil
 }
 
-// Logout invalidates a session
-func (s *Service) Logout(refreshToken string) error {
+// handleRefreshTokenReuse revokes every session of the token family after a
+// rotated-out refresh token was presented again (OAuth 2.0 Security BCP).
+// Either the legitimate client or an attacker holds a stale copy, and we
+// cannot tell which, so the whole family has to log in again.
+func (s *Service) handleRefreshTokenReuse(session *Session, meta RequestMeta) error {
+	logger.SecurityEvent("refresh_token_reuse", logrus.Fields{
+		"user_id":    session.UserID,
+		"session_id": session.ID,
+		"family_id":  session.FamilyID,
+		"client_ip":  meta.IP,
+		"user_agent": meta.UserAgent,
+	})
+
+	if err := s.revokeSessionFamily(session); err != nil {
+		logger.Error("Failed to revoke session family:", err)
+		return errors.NewInternalServerError("Failed to revoke session family")
+	}
+
+	return errors.NewUnauthorizedError("Refresh token reuse detected, please log in again")
+}
+
+// revokeSessionFamily blocks every session in the token family of session
+// and revokes their access tokens
+func (s *Service) revokeSessionFamily(session *Session) error {
+	familyID := session.FamilyID
+	if familyID == "" {
+		// Sessions created before family tracking stand alone
+		if err := s.repo.InvalidateSession(session.ID); err != nil {
+			return err
+		}
+		return s.revocations.RevokeSession(session.ID, s.accessExpiry)
+	}
+
+	sessionIDs, err := s.repo.FindSessionIDsByFamily(familyID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.InvalidateSessionFamily(familyID); err != nil {
+		return err
+	}
+
+	for _, sessionID := range sessionIDs {
+		if err := s.revocations.RevokeSession(sessionID, s.accessExpiry); err != nil {
+			logger.Error("Failed to revoke session tokens:", err)
+		}
+	}
+	return nil
+}
+
+// Logout invalidates a session and revokes the access token used for the request
+func (s *Service) Logout(refreshToken string, claims *Claims) error {
+	// The caller's access token stops working right away
+	if claims != nil && claims.TokenID != "" {
+		if err := s.revocations.RevokeToken(claims.TokenID, time.Unix(claims.ExpiresAt, 0)); err != nil {
+			logger.Error("Failed to revoke access token:", err)
+		}
+	}
+
 	// Find session by refresh token
 	session, err := s.repo.FindSessionByToken(refreshToken)
 	if err != nil {
@@ -236,12 +494,79 @@ func (s *Service) Logout(refreshToken string) error {
 	}
 
 	// Invalidate session
-	return s.repo.InvalidateSession(session.ID)
+	return s.invalidateSession(session.ID)
 }
 
 // LogoutAll invalidates all sessions for a user
 func (s *Service) LogoutAll(userID uint) error {
-	return s.repo.InvalidateAllUserSessions(userID)
+	return s.invalidateAllUserSessions(userID)
+}
+
+// ListSessions returns the active sessions of a user. The session with
+// currentSessionID is marked as the current one.
+func (s *Service) ListSessions(userID, currentSessionID uint) ([]SessionResponse, error) {
+	sessions, err := s.repo.FindActiveUserSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]SessionResponse, 0, len(sessions))
+	for i := range sessions {
+		responses = append(responses, newSessionResponse(&sessions[i], currentSessionID))
+	}
+
+	return responses, nil
+}
+
+// Me returns the authenticated user with the session the token belongs to.
+// The user is loaded fresh, so changes since the token was issued show.
+func (s *Service) Me(claims *Claims) (*MeResponse, error) {
+	foundUser, err := s.userRepo.FindByID(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &MeResponse{
+		User:  newUserInfo(foundUser),
+		Actor: claims.Actor,
+	}
+	if claims.ExpiresAt != 0 {
+		expiresAt := time.Unix(claims.ExpiresAt, 0)
+		response.ExpiresAt = &expiresAt
+	}
+
+	// API keys and impersonation tokens are not bound to a session
+	if claims.SessionID != 0 {
+		session, err := s.repo.FindSessionByID(claims.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if session.UserID == claims.UserID {
+			current := newSessionResponse(session, session.ID)
+			response.Session = &current
+		}
+	}
+
+	return response, nil
+}
+
+// RevokeSession invalidates one of the user's own sessions
+func (s *Service) RevokeSession(userID, sessionID uint) error {
+	session, err := s.repo.FindSessionByID(sessionID)
+	if err != nil {
+		return err
+	}
+
+	// Don't reveal that sessions of other users exist
+	if session.UserID != userID {
+		return errors.NewNotFoundError("Session")
+	}
+
+	if err := s.invalidateSession(session.ID); err != nil {
+		return errors.NewInternalServerError("Failed to revoke session")
+	}
+
+	return nil
 }
 
 // ChangePassword changes a user's password
@@ -258,51 +583,445 @@ func (s *Service) ChangePassword(userID uint, req *ChangePasswordRequest) error
 	}
 
 	// Verify old password
-	if err := bcrypt.CompareHashAndPassword([]byte(foundUser.Password), []byte(req.OldPassword)); err != nil {
+	if valid, _ := s.verifyPassword(foundUser, req.OldPassword); !valid {
 		return errors.NewBadRequestError("Current password is incorrect")
 	}
 
+	if err := s.passwordPolicy.CheckPassword(req.NewPassword, foundUser.Name, foundUser.Email); err != nil {
+		return err
+	}
+
 	// Hash new password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	hashedPassword, err := s.passwords.Hash(req.NewPassword)
 	if err != nil {
 		return errors.NewInternalServerError("Failed to hash password")
 	}
 
 	// Update password
-	foundUser.Password = string(hashedPassword)
+	foundUser.Password = hashedPassword
 	if err := s.userRepo.Update(foundUser); err != nil {
 		return errors.NewInternalServerError("Failed to update password")
 	}
 
 	// Invalidate all sessions for security
-	return s.repo.InvalidateAllUserSessions(userID)
+	return s.invalidateAllUserSessions(userID)
 }
 
-// ValidateToken validates a JWT token and returns the claims
-func (s *Service) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// startSession generates tokens for the user, stores a new session,
+// records the login and builds the auth response
+func (s *Service) startSession(u *user.User, method string, meta RequestMeta) (*AuthResponse, error) {
+	// Every login starts a new refresh token family
+	now := time.Now()
+	tokenDetails, err := s.createSession(u, meta, generateUUID(), &now)
+	if err != nil {
+		return nil, err
+	}
+	s.loginSucceeded(u, method, meta)
+
+	// Prepare response
+	response := &AuthResponse{
+		User: newUserInfo(u),
+		Token: &TokenResponse{
+			AccessToken:  tokenDetails.AccessToken,
+			RefreshToken: tokenDetails.RefreshToken,
+			ExpiresIn:    tokenDetails.AtExpires - time.Now().Unix(),
+			TokenType:    "Bearer",
+		},
+	}
+
+	return response, nil
+}
+
+// newSession builds a session for freshly generated tokens
+func newSession(userID uint, td *TokenDetails, meta RequestMeta, familyID string) *Session {
+	return &Session{
+		UserID:           userID,
+		FamilyID:         familyID,
+		RefreshTokenHash: hashToken(td.RefreshToken),
+		UserAgent:        truncate(valueOr(meta.UserAgent, "Not provided"), 255),
+		ClientIP:         truncate(valueOr(meta.IP, "Not provided"), 100),
+		DeviceName:       truncate(meta.DeviceName, 100),
+		ExpiresAt:        time.Unix(td.RtExpires, 0),
+	}
+}
+
+// verifyPassword checks a password against the user's stored hash.
+// needsRehash reports whether the hash should be upgraded.
+func (s *Service) verifyPassword(u *user.User, password string) (valid, needsRehash bool) {
+	valid, needsRehash, err := s.passwords.Verify(password, u.Password)
+	if err != nil {
+		logger.Error("Failed to verify password:", err)
+		return false, false
+	}
+	return valid, needsRehash
+}
+
+// rehashPassword stores a fresh hash of a password that was just verified.
+// Failures are only logged; the old hash keeps working.
+func (s *Service) rehashPassword(u *user.User, password string) {
+	hashedPassword, err := s.passwords.Hash(password)
+	if err != nil {
+		logger.Error("Failed to rehash password:", err)
+		return
+	}
+
+	u.Password = hashedPassword
+	if err := s.userRepo.Update(u); err != nil {
+		logger.Error("Failed to rehash password:", err)
+	}
+}
+
+// ForgotPassword sends a password reset link to the user.
+// It never reveals whether the email belongs to an account.
+func (s *Service) ForgotPassword(req *ResetPasswordRequest) error {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return errors.NewValidationError(err)
+	}
+
+	foundUser, err := s.userRepo.FindByEmail(req.Email)
+	if err != nil {
+		return nil
+	}
+
+	// Generate a random token; only its digest is stored
+	rawToken := generateRandomToken(32)
+	resetToken := &PasswordResetToken{
+		UserID:    foundUser.ID,
+		TokenHash: hashToken(rawToken),
+		ExpiresAt: time.Now().Add(s.resetExpiry),
+	}
+
+	// Failures are only logged; the response must be the same whether or
+	// not the account exists
+	if err := s.repo.CreatePasswordResetToken(resetToken); err != nil {
+		logger.Error("Failed to create password reset token:", err)
+		return nil
+	}
+
+	msg := &mailer.Message{
+		To:      foundUser.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse the link below to reset your password. It expires in %s.\n\n%s\n\nIf you did not request a password reset, you can ignore this email.\n",
+			foundUser.Name, s.resetExpiry, s.buildLink(s.passwordResetURL, rawToken),
+		),
+	}
+
+	if err := s.mailQueue.Send(msg); err != nil {
+		logger.Error("Failed to send password reset email:", err)
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password using a password reset token
+func (s *Service) ResetPassword(req *ResetPasswordConfirmRequest) error {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return errors.NewValidationError(err)
+	}
+
+	resetToken, err := s.repo.FindPasswordResetToken(hashToken(req.Token))
+	if err != nil {
+		return errors.NewBadRequestError("Invalid or expired reset token")
+	}
+
+	if resetToken.ExpiresAt.Before(time.Now()) {
+		return errors.NewBadRequestError("Invalid or expired reset token")
+	}
+
+	foundUser, err := s.userRepo.FindByID(resetToken.UserID)
+	if err != nil {
+		return errors.NewBadRequestError("Invalid or expired reset token")
+	}
+
+	// Check the policy first so a rejected password does not burn the link
+	if err := s.passwordPolicy.CheckPassword(req.NewPassword, foundUser.Name, foundUser.Email); err != nil {
+		return err
+	}
+
+	// Mark the token as used before changing anything
+	consumed, err := s.repo.ConsumePasswordResetToken(resetToken.ID)
+	if err != nil {
+		return errors.NewInternalServerError("Failed to consume reset token")
+	}
+	if !consumed {
+		return errors.NewBadRequestError("Invalid or expired reset token")
+	}
+
+	// Hash new password
+	hashedPassword, err := s.passwords.Hash(req.NewPassword)
+	if err != nil {
+		return errors.NewInternalServerError("Failed to hash password")
+	}
+
+	// Update password
+	foundUser.Password = hashedPassword
+	if err := s.userRepo.Update(foundUser); err != nil {
+		return errors.NewInternalServerError("Failed to update password")
+	}
+
+	// Any other outstanding reset links are no longer needed
+	if err := s.repo.DeleteUserPasswordResetTokens(foundUser.ID); err != nil {
+		logger.Warn("Failed to delete password reset tokens:", err)
+	}
+
+	// Invalidate all sessions so stolen refresh tokens stop working
+	return s.invalidateAllUserSessions(foundUser.ID)
+}
+
+// VerifyEmail marks the user's email as verified using a signed verification token
+func (s *Service) VerifyEmail(req *VerifyEmailRequest) (*UserInfo, error) {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return nil, errors.NewValidationError(err)
+	}
+
+	claims, err := s.parsePurposeToken(purposeEmailVerification, req.Token)
+	if err != nil {
+		// Links sent to a new address confirm an email change
+		if claims, err := s.parsePurposeToken(purposeEmailChange, req.Token); err == nil {
+			return s.confirmEmailChange(claims)
 		}
-		return []byte(s.jwtSecret), nil
+		return nil, errors.NewBadRequestError("Invalid or expired verification token")
+	}
+
+	userID, _ := claims["user_id"].(float64)
+	email, _ := claims["email"].(string)
+
+	foundUser, err := s.userRepo.FindByID(uint(userID))
+	if err != nil {
+		return nil, errors.NewBadRequestError("Invalid or expired verification token")
+	}
+
+	// The link is only valid for the address it was sent to
+	if foundUser.Email != email {
+		return nil, errors.NewBadRequestError("Invalid or expired verification token")
+	}
+
+	if !foundUser.IsEmailVerified() {
+		now := time.Now()
+		foundUser.EmailVerifiedAt = &now
+		if err := s.userRepo.Update(foundUser); err != nil {
+			return nil, errors.NewInternalServerError("Failed to verify email")
+		}
+	}
+
+	info := newUserInfo(foundUser)
+	return &info, nil
+}
+
+// ResendVerificationEmail sends a new verification email.
+// It never reveals whether the email belongs to an account.
+func (s *Service) ResendVerificationEmail(req *ResendVerificationRequest) error {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return errors.NewValidationError(err)
+	}
+
+	foundUser, err := s.userRepo.FindByEmail(req.Email)
+	if err != nil || foundUser.IsEmailVerified() {
+		return nil
+	}
+
+	// Delivery errors are only logged; failing here would reveal the account
+	if err := s.sendVerificationEmail(foundUser); err != nil {
+		logger.Error("Failed to send verification email:", err)
+	}
+
+	return nil
+}
+
+// sendVerificationEmail queues a signed verification link for the user
+func (s *Service) sendVerificationEmail(u *user.User) error {
+	token, err := s.signPurposeToken(purposeEmailVerification, jwt.MapClaims{
+		"user_id": u.ID,
+		"email":   u.Email,
+	}, s.verificationExpiry)
+	if err != nil {
+		return err
+	}
+
+	return s.mailQueue.Send(&mailer.Message{
+		To:      u.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s\n",
+			u.Name, s.verificationExpiry, s.buildLink(s.emailVerificationURL, token),
+		),
+	})
+}
+
+// RequestEmailChange mails a confirmation link to the new address. The
+// user's email only changes once the link is used; the current address is
+// told about the request so a change made from a stolen session is noticed.
+func (s *Service) RequestEmailChange(u *user.User, newEmail string) error {
+	token, err := s.signPurposeToken(purposeEmailChange, jwt.MapClaims{
+		"user_id":   u.ID,
+		"email":     u.Email,
+		"new_email": newEmail,
+	}, s.verificationExpiry)
+	if err != nil {
+		return err
+	}
+
+	if err := s.mailQueue.Send(&mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm your new email address by opening the link below. It expires in %s.\n\n%s\n",
+			u.Name, s.verificationExpiry, s.buildLink(s.emailVerificationURL, token),
+		),
+	}); err != nil {
+		return err
+	}
+
+	logger.SecurityEvent("email_change_requested", logrus.Fields{
+		"user_id": u.ID,
+	})
+
+	// The notice is best effort; the change still needs the new address
+	if err := s.mailQueue.Send(&mailer.Message{
+		To:      u.Email,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nA request was made to change the email address of your account to %s. "+
+				"It only takes effect once confirmed from that address. If this wasn't you, change your password and sign out of all devices.\n",
+			u.Name, newEmail,
+		),
+	}); err != nil {
+		logger.Error("Failed to send email change notice:", err)
+	}
+
+	return nil
+}
+
+// confirmEmailChange applies a pending email change from a confirmation link
+func (s *Service) confirmEmailChange(claims jwt.MapClaims) (*UserInfo, error) {
+	userID, _ := claims["user_id"].(float64)
+	email, _ := claims["email"].(string)
+	newEmail, _ := claims["new_email"].(string)
+
+	foundUser, err := s.userRepo.FindByID(uint(userID))
+	if err != nil || newEmail == "" {
+		return nil, errors.NewBadRequestError("Invalid or expired verification token")
+	}
+
+	// The link is only valid while the address it was requested from is current
+	if foundUser.Email != email {
+		return nil, errors.NewBadRequestError("Invalid or expired verification token")
+	}
+
+	// The address may have been taken since the change was requested
+	if existing, err := s.userRepo.FindByEmail(newEmail); err == nil && existing != nil {
+		return nil, errors.NewBadRequestError("Email already in use")
+	}
+
+	now := time.Now()
+	foundUser.Email = newEmail
+	foundUser.EmailVerifiedAt = &now
+	if err := s.userRepo.Update(foundUser); err != nil {
+		return nil, errors.NewInternalServerError("Failed to verify email")
+	}
+
+	logger.SecurityEvent("email_changed", logrus.Fields{
+		"user_id": foundUser.ID,
 	})
 
+	info := newUserInfo(foundUser)
+	return &info, nil
+}
+
+// invalidateSession blocks a session and revokes its access tokens
+func (s *Service) invalidateSession(sessionID uint) error {
+	if err := s.repo.InvalidateSession(sessionID); err != nil {
+		return err
+	}
+
+	if err := s.revocations.RevokeSession(sessionID, s.accessExpiry); err != nil {
+		logger.Error("Failed to revoke session tokens:", err)
+	}
+	return nil
+}
+
+// invalidateAllUserSessions blocks all sessions of a user and revokes every
+// access token issued to them so far
+func (s *Service) invalidateAllUserSessions(userID uint) error {
+	if err := s.repo.InvalidateAllUserSessions(userID); err != nil {
+		return err
+	}
+
+	if err := s.revocations.RevokeUserTokens(userID, s.longestTokenLifetime()); err != nil {
+		logger.Error("Failed to revoke user tokens:", err)
+	}
+	return nil
+}
+
+// ValidateToken validates a JWT token and returns the claims
+func (s *Service) ValidateToken(tokenString string) (*Claims, error) {
+	// The key set resolves the key from the "kid" header and validates the signing method
+	token, err := jwt.Parse(tokenString, s.keys.Keyfunc)
 	if err != nil {
 		return nil, errors.NewUnauthorizedError(err.Error())
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		// Check if token is expired
-		if float64(time.Now().Unix()) > claims["exp"].(float64) {
+		exp, ok := claims["exp"].(float64)
+		if !ok || float64(time.Now().Unix()) > exp {
 			return nil, errors.NewUnauthorizedError("Token expired")
 		}
 
+		// Client credentials tokens identify a client instead of a user
+		if _, isClient := claims["client_id"]; isClient {
+			clientClaims, ok := s.parseClientClaims(claims)
+			if !ok {
+				return nil, errors.NewUnauthorizedError("Invalid token")
+			}
+			if err := s.checkRevoked(clientClaims); err != nil {
+				return nil, err
+			}
+			return clientClaims, nil
+		}
+
 		// Extract claims
+		userID, ok1 := claims["user_id"].(float64)
+		email, ok2 := claims["email"].(string)
+		role, ok3 := claims["role"].(string)
+		if !ok1 || !ok2 || !ok3 {
+			return nil, errors.NewUnauthorizedError("Invalid token")
+		}
+		sessionID, _ := claims["sid"].(float64)
+		tokenID, _ := claims["uuid"].(string)
+		issuedAt, _ := claims["iat"].(float64)
+		issuedAtMs, _ := claims["iat_ms"].(float64)
+		authTime, _ := claims["auth_time"].(float64)
+
 		userClaims := &Claims{
-			UserID: uint(claims["user_id"].(float64)),
-			Email:  claims["email"].(string),
-			Role:   claims["role"].(string),
+			UserID:     uint(userID),
+			Email:      email,
+			Role:       role,
+			SessionID:  uint(sessionID),
+			TokenID:    tokenID,
+			IssuedAt:   int64(issuedAt),
+			IssuedAtMs: int64(issuedAtMs),
+			ExpiresAt:  int64(exp),
+			AuthTime:   int64(authTime),
+		}
+
+		// Impersonation tokens name the admin behind them
+		if act, ok := claims["act"].(map[string]interface{}); ok {
+			actorID, _ := act["user_id"].(float64)
+			actorEmail, _ := act["email"].(string)
+			if actorID == 0 {
+				return nil, errors.NewUnauthorizedError("Invalid token")
+			}
+			userClaims.Actor = &Actor{UserID: uint(actorID), Email: actorEmail}
+		}
+
+		if err := s.checkRevoked(userClaims); err != nil {
+			return nil, err
 		}
 
 		return userClaims, nil
@@ -311,35 +1030,112 @@ func (s *Service) ValidateToken(tokenString string) (*Claims, error) {
 	return nil, errors.NewUnauthorizedError("Invalid token")
 }
 
-// generateTokens generates access and refresh tokens
-func (s *Service) generateTokens(userID uint, email, role string) (*TokenDetails, error) {
-	now := time.Now()
+// AuthenticateAPIKey resolves an API key to the claims of its owner
+func (s *Service) AuthenticateAPIKey(rawKey, clientIP string) (*Claims, error) {
+	if s.apiKeys == nil {
+		return nil, errors.NewUnauthorizedError("API key authentication is not enabled")
+	}
 
-	td := &TokenDetails{
-		AtExpires:   now.Add(s.accessExpiry).Unix(),
-		RtExpires:   now.Add(s.refreshExpiry).Unix(),
-		AccessUUID:  generateUUID(),
-		RefreshUUID: generateUUID(),
-		ExpiresAt:   now.Add(s.accessExpiry),
+	principal, err := s.apiKeys.AuthenticateKey(rawKey, clientIP)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create access token
-	accessClaims := jwt.MapClaims{
-		"user_id": userID,
-		"email":   email,
-		"role":    role,
-		"uuid":    td.AccessUUID,
-		"exp":     td.AtExpires,
-		"iat":     now.Unix(),
+	foundUser, err := s.userRepo.FindByID(principal.UserID)
+	if err != nil {
+		return nil, errors.NewUnauthorizedError("Invalid API key")
 	}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	var err error
-	td.AccessToken, err = accessToken.SignedString([]byte(s.jwtSecret))
+	return &Claims{
+		UserID:   foundUser.ID,
+		Email:    foundUser.Email,
+		Role:     foundUser.Role,
+		APIKeyID: principal.KeyID,
+		Scopes:   principal.Scopes,
+	}, nil
+}
+
+// ResolveGrants returns the effective roles and permissions of a user. The
+// user's primary role is always included.
+func (s *Service) ResolveGrants(userID uint, role string) (*Grants, error) {
+	if s.permissions == nil {
+		return &Grants{Roles: []string{role}, Permissions: []string{}}, nil
+	}
+
+	grants, err := s.permissions.ResolveGrants(userID, role)
 	if err != nil {
 		return nil, err
 	}
 
+	if !grants.HasRole(role) {
+		grants.Roles = append([]string{role}, grants.Roles...)
+	}
+	return grants, nil
+}
+
+// createSession stores a new session for the user in the given token family
+// and issues the token pair bound to it. The access token carries the
+// session ID in the "sid" claim and authenticatedAt in "auth_time".
+func (s *Service) createSession(u *user.User, meta RequestMeta, familyID string, authenticatedAt *time.Time) (*TokenDetails, error) {
+	// Generate refresh token
+	tokenDetails, err := s.generateRefreshToken(u.ID)
+	if err != nil {
+		return nil, errors.NewInternalServerError("Failed to generate tokens")
+	}
+
+	// Save session
+	session := newSession(u.ID, tokenDetails, meta, familyID)
+	session.AuthenticatedAt = authenticatedAt
+	if err := s.repo.CreateSession(session); err != nil {
+		return nil, errors.NewInternalServerError("Failed to create session")
+	}
+	tokenDetails.SessionID = session.ID
+
+	// Generate access token for the session
+	if err := s.generateAccessToken(tokenDetails, u, session); err != nil {
+		return nil, errors.NewInternalServerError("Failed to generate tokens")
+	}
+
+	return tokenDetails, nil
+}
+
+// checkRevoked rejects tokens that were revoked before they expired
+func (s *Service) checkRevoked(claims *Claims) error {
+	if claims.TokenID != "" && s.revocations.IsTokenRevoked(claims.TokenID) {
+		return errors.NewUnauthorizedError("Token has been revoked")
+	}
+
+	if claims.SessionID != 0 && s.revocations.IsSessionRevoked(claims.SessionID) {
+		return errors.NewUnauthorizedError("Token has been revoked")
+	}
+
+	if claims.IsClient() {
+		return nil
+	}
+
+	if validAfter, ok := s.revocations.UserTokensValidAfter(claims.UserID); ok && claims.issuedAtMilli() < validAfter.UnixMilli() {
+		return errors.NewUnauthorizedError("Token has been revoked")
+	}
+
+	// Signing the admin out everywhere also ends their impersonations
+	if claims.Actor != nil {
+		if validAfter, ok := s.revocations.UserTokensValidAfter(claims.Actor.UserID); ok && claims.issuedAtMilli() < validAfter.UnixMilli() {
+			return errors.NewUnauthorizedError("Token has been revoked")
+		}
+	}
+
+	return nil
+}
+
+// generateRefreshToken generates a refresh token
+func (s *Service) generateRefreshToken(userID uint) (*TokenDetails, error) {
+	now := time.Now()
+
+	td := &TokenDetails{
+		RtExpires:   now.Add(s.refreshExpiry).Unix(),
+		RefreshUUID: generateUUID(),
+	}
+
 	// Create refresh token
 	refreshClaims := jwt.MapClaims{
 		"user_id": userID,
@@ -349,6 +1145,7 @@ func (s *Service) generateTokens(userID uint, email, role string) (*TokenDetails
 	}
 
 	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
+	var err error
 	td.RefreshToken, err = refreshToken.SignedString([]byte(s.jwtSecret))
 	if err != nil {
 		return nil, err
@@ -357,9 +1154,171 @@ func (s *Service) generateTokens(userID uint, email, role string) (*TokenDetails
 	return td, nil
 }
 
+// generateAccessToken generates an access token for a session
+func (s *Service) generateAccessToken(td *TokenDetails, u *user.User, session *Session) error {
+	now := time.Now()
+
+	td.AtExpires = now.Add(s.accessExpiry).Unix()
+	td.AccessUUID = generateUUID()
+	td.ExpiresAt = now.Add(s.accessExpiry)
+
+	// Create access token
+	accessClaims := jwt.MapClaims{
+		"user_id": u.ID,
+		"email":   u.Email,
+		"role":    u.Role,
+		"sid":     session.ID,
+		"uuid":    td.AccessUUID,
+		"exp":     td.AtExpires,
+		"iat":     now.Unix(),
+		"iat_ms":  now.UnixMilli(),
+	}
+	if session.AuthenticatedAt != nil {
+		accessClaims["auth_time"] = session.AuthenticatedAt.Unix()
+	}
+
+	var err error
+	td.AccessToken, err = s.keys.Sign(accessClaims)
+	return err
+}
+
+// longestTokenLifetime returns how long any access token issued by the
+// service stays valid: session, impersonation and client tokens
+func (s *Service) longestTokenLifetime() time.Duration {
+	lifetime := s.accessExpiry
+	for _, expiry := range []time.Duration{s.impersonationExpiry, s.clientTokenExpiry} {
+		if expiry > lifetime {
+			lifetime = expiry
+		}
+	}
+	return lifetime
+}
+
+// JWKS returns the public keys access tokens can be verified with
+func (s *Service) JWKS() *JSONWebKeySet {
+	return s.keys.JWKS()
+}
+
+// Token purposes for single-purpose signed tokens
+const (
+	purposeEmailVerification = "email_verification"
+	purposeEmailChange       = "email_change"
+	purposeMFAPending        = "mfa_pending"
+	purposeMagicLink         = "magic_link"
+)
+
+// signPurposeToken signs a short-lived token for a single purpose.
+// Each purpose uses its own key derived from the JWT secret, so these
+// tokens can never be accepted as access tokens or for another purpose.
+func (s *Service) signPurposeToken(purpose string, claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims["typ"] = purpose
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(s.purposeKey(purpose))
+}
+
+// parsePurposeToken verifies a token created by signPurposeToken
+func (s *Service) parsePurposeToken(purpose, tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return s.purposeKey(purpose), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["typ"] != purpose {
+		return nil, fmt.Errorf("invalid %s token", purpose)
+	}
+
+	return claims, nil
+}
+
+// purposeKey derives the signing key for a token purpose
+func (s *Service) purposeKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(s.jwtSecret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// newUserInfo builds the user information returned in auth responses
+func newUserInfo(u *user.User) UserInfo {
+	return UserInfo{
+		ID:            u.ID,
+		Name:          u.Name,
+		Email:         u.Email,
+		Role:          u.Role,
+		EmailVerified: u.IsEmailVerified(),
+	}
+}
+
+// newSessionResponse converts a session to its response. The session with
+// currentSessionID is marked as the current one.
+func newSessionResponse(session *Session, currentSessionID uint) SessionResponse {
+	return SessionResponse{
+		ID:         session.ID,
+		CreatedAt:  session.CreatedAt,
+		UserAgent:  session.UserAgent,
+		ClientIP:   session.ClientIP,
+		DeviceName: session.DeviceName,
+		ExpiresAt:  session.ExpiresAt,
+		Current:    session.ID == currentSessionID,
+	}
+}
+
+// buildLink appends a token to a base URL as the "token" query parameter
+func (s *Service) buildLink(baseURL, token string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return baseURL + "?token=" + url.QueryEscape(token)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// valueOr returns value, or fallback if value is empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// truncate shortens s to at most max bytes without splitting a UTF-8 character
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
 // generateUUID generates a random UUID
 func generateUUID() string {
 	b := make([]byte, 16)
 	_, _ = rand.Read(b)
 	return base64.URLEncoding.EncodeToString(b)
 }
+
+// generateRandomToken generates a URL-safe random token from n random bytes
+func generateRandomToken(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// hashToken returns the hex-encoded SHA-256 digest of a token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
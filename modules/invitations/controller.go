@@ -0,0 +1,129 @@
+package invitations
+
+import (
+	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/modules/auth"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Controller handles HTTP requests related to invitations
+type Controller struct {
+	service *Service
+}
+
+// NewController creates a new invitation controller
+func NewController(service *Service) *Controller {
+	return &Controller{
+		service: service,
+	}
+}
+
+// RegisterRoutes registers the admin routes for managing invitations. The
+// given middleware must authenticate the user and check their permission.
+// Invitees accept at /auth/invitations/accept in the auth module.
+func (c *Controller) RegisterRoutes(router fiber.Router, middleware ...fiber.Handler) {
+	invitations := router.Group("/admin/invitations", middleware...)
+
+	invitations.Post("/", c.Create)
+	invitations.Get("/", c.List)
+	invitations.Delete("/:id", c.Revoke)
+}
+
+// Create handles inviting a user
+// @Summary Create invitation
+// @Description Invite a person by email with a pre-assigned role. They are mailed a single-use link to create their account. The inviter must hold every permission of the role.
+// @Tags invitations
+// @Accept json
+// @Produce json
+// @Param invitation body CreateInvitationRequest true "Invitation details"
+// @Security BearerAuth
+// @Success 201 {object} InvitationResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /admin/invitations [post]
+func (c *Controller) Create(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userID").(uint)
+	if !ok {
+		return errors.NewUnauthorizedError("User not authenticated")
+	}
+
+	// Resolved by the permission check the routes are registered with
+	grants, ok := ctx.Locals("grants").(*auth.Grants)
+	if !ok {
+		return errors.NewForbiddenError("You don't have permission to access this resource")
+	}
+
+	req := new(CreateInvitationRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	result, err := c.service.Create(userID, grants, req)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// List handles listing invitations
+// @Summary List invitations
+// @Description List all invitations with their status
+// @Tags invitations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} InvitationResponse
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /admin/invitations [get]
+func (c *Controller) List(ctx *fiber.Ctx) error {
+	invitations, err := c.service.List()
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    invitations,
+	})
+}
+
+// Revoke handles revoking an invitation
+// @Summary Revoke invitation
+// @Description Revoke a pending invitation so its link no longer works
+// @Tags invitations
+// @Accept json
+// @Produce json
+// @Param id path int true "Invitation ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /admin/invitations/{id} [delete]
+func (c *Controller) Revoke(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return errors.NewBadRequestError("Invalid invitation ID")
+	}
+
+	if err := c.service.Revoke(uint(id)); err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"message": "Invitation revoked successfully",
+	})
+}
@@ -0,0 +1,23 @@
+package invitations
+
+import "time"
+
+// CreateInvitationRequest represents the request for inviting a user
+type CreateInvitationRequest struct {
+	Email         string `json:"email" validate:"required,email,max=255"`
+	Role          string `json:"role" validate:"omitempty,max=20"`                  // Defaults to "user"; at most the size of the user role column
+	ExpiresInDays int    `json:"expires_in_days" validate:"omitempty,min=1,max=30"` // Defaults to the configured expiry
+}
+
+// InvitationResponse represents an invitation. The token is never returned;
+// it is only sent to the invitee.
+type InvitationResponse struct {
+	ID         uint       `json:"id"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	Status     string     `json:"status"`
+	InvitedBy  uint       `json:"invited_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+}
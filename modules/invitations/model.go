@@ -0,0 +1,54 @@
+package invitations
+
+import "time"
+
+// Invitation statuses reported in responses
+const (
+	StatusPending  = "pending"
+	StatusAccepted = "accepted"
+	StatusExpired  = "expired"
+	StatusRevoked  = "revoked"
+)
+
+// Invitation lets a person create an account with a pre-assigned role.
+// Only the SHA-256 digest of the token is stored.
+type Invitation struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Email      string     `gorm:"size:255;not null;index" json:"email"`
+	Role       string     `gorm:"size:50;not null" json:"role"`
+	TokenHash  string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	InvitedBy  uint       `gorm:"not null" json:"invited_by"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// Status returns the state of the invitation at the given time
+func (i *Invitation) Status(now time.Time) string {
+	switch {
+	case i.AcceptedAt != nil:
+		return StatusAccepted
+	case i.RevokedAt != nil:
+		return StatusRevoked
+	case !now.Before(i.ExpiresAt):
+		return StatusExpired
+	default:
+		return StatusPending
+	}
+}
+
+// ToResponse converts an invitation to a response
+func (i *Invitation) ToResponse() *InvitationResponse {
+	return &InvitationResponse{
+		ID:         i.ID,
+		Email:      i.Email,
+		Role:       i.Role,
+		Status:     i.Status(time.Now()),
+		InvitedBy:  i.InvitedBy,
+		CreatedAt:  i.CreatedAt,
+		ExpiresAt:  i.ExpiresAt,
+		AcceptedAt: i.AcceptedAt,
+	}
+}
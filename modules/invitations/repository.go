@@ -0,0 +1,80 @@
+package invitations
+
+import (
+	"go-fiber-gorm/core/errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Repository handles database operations for invitations
+type Repository struct {
+	DB *gorm.DB
+}
+
+// NewRepository creates a new invitation repository
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{
+		DB: db,
+	}
+}
+
+// Create creates a new invitation
+func (r *Repository) Create(invitation *Invitation) error {
+	return r.DB.Create(invitation).Error
+}
+
+// FindPendingByTokenHash finds an invitation that can still be accepted
+func (r *Repository) FindPendingByTokenHash(tokenHash string) (*Invitation, error) {
+	var invitation Invitation
+	err := r.DB.Where("token_hash = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", tokenHash, time.Now()).
+		First(&invitation).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError("Invitation")
+		}
+		return nil, errors.NewInternalServerError(err.Error())
+	}
+	return &invitation, nil
+}
+
+// FindAll returns the invitations, newest first
+func (r *Repository) FindAll() ([]Invitation, error) {
+	var invitations []Invitation
+	err := r.DB.Order("created_at desc").Find(&invitations).Error
+	return invitations, err
+}
+
+// MarkAccepted marks a pending invitation as accepted. It returns false if
+// the invitation was accepted, revoked or expired in the meantime, so each
+// invitation is used at most once.
+func (r *Repository) MarkAccepted(id uint) (bool, error) {
+	now := time.Now()
+	result := r.DB.Model(&Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", id, now).
+		Update("accepted_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Revoke revokes a pending invitation. It returns false if no pending
+// invitation matched.
+func (r *Repository) Revoke(id uint) (bool, error) {
+	result := r.DB.Model(&Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RevokePendingForEmail revokes the pending invitations of an email, so
+// only the newest invitation link works
+func (r *Repository) RevokePendingForEmail(email string) error {
+	return r.DB.Model(&Invitation{}).
+		Where("LOWER(email) = LOWER(?) AND accepted_at IS NULL AND revoked_at IS NULL", email).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,230 @@
+package invitations
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/core/logger"
+	"go-fiber-gorm/core/mailer"
+	"go-fiber-gorm/modules/auth"
+	"go-fiber-gorm/modules/rbac"
+	"go-fiber-gorm/modules/user"
+	"net/url"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultExpiry = 7 * 24 * time.Hour
+	defaultRole   = "user"
+)
+
+// errInvalidInvitation does not say why the token was rejected
+var errInvalidInvitation = errors.NewBadRequestError("Invalid or expired invitation")
+
+// ServiceConfig holds the settings of the invitation service
+type ServiceConfig struct {
+	Mailer    mailer.Mailer // Defaults to a log mailer
+	AcceptURL string        // Frontend page that accepts the invitation; the token is appended
+	Expiry    time.Duration // How long an invitation stays valid; defaults to 7 days
+}
+
+// Service handles invitation business logic
+type Service struct {
+	repo      *Repository
+	userRepo  *user.Repository
+	roleRepo  *rbac.Repository
+	mailer    mailer.Mailer
+	acceptURL string
+	expiry    time.Duration
+	validator *validator.Validate
+}
+
+// NewService creates a new invitation service
+func NewService(repo *Repository, userRepo *user.Repository, roleRepo *rbac.Repository, config ServiceConfig) *Service {
+	if config.Mailer == nil {
+		config.Mailer = mailer.NewLogMailer()
+	}
+	if config.Expiry == 0 {
+		config.Expiry = defaultExpiry
+	}
+
+	return &Service{
+		repo:      repo,
+		userRepo:  userRepo,
+		roleRepo:  roleRepo,
+		mailer:    config.Mailer,
+		acceptURL: config.AcceptURL,
+		expiry:    config.Expiry,
+		validator: validator.New(),
+	}
+}
+
+// Create invites a person by email. Earlier pending invitations for the same
+// email are revoked, and the invitee is mailed a single-use link. Roles other
+// than the default can only be assigned if the inviter holds every
+// permission of the role, so inviting cannot escalate privileges.
+func (s *Service) Create(invitedBy uint, grants *auth.Grants, req *CreateInvitationRequest) (*InvitationResponse, error) {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return nil, errors.NewValidationError(err)
+	}
+
+	if existing, err := s.userRepo.FindByEmail(req.Email); err == nil && existing != nil {
+		return nil, errors.NewBadRequestError("A user with this email already exists")
+	}
+
+	role := req.Role
+	if role == "" {
+		role = defaultRole
+	}
+	invitedRole, err := s.roleRepo.FindRoleByName(role)
+	if err != nil {
+		return nil, errors.NewBadRequestError("Unknown role: " + role)
+	}
+	if role != defaultRole {
+		for _, permission := range invitedRole.PermissionNames() {
+			if !grants.HasPermission(permission) {
+				return nil, errors.NewForbiddenError("You cannot invite users with a role that has permissions you don't have")
+			}
+		}
+	}
+
+	expiry := s.expiry
+	if req.ExpiresInDays > 0 {
+		expiry = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+
+	if err := s.repo.RevokePendingForEmail(req.Email); err != nil {
+		return nil, errors.NewInternalServerError("Failed to create invitation")
+	}
+
+	rawToken := generateToken()
+	invitation := &Invitation{
+		Email:     req.Email,
+		Role:      role,
+		TokenHash: hashToken(rawToken),
+		ExpiresAt: time.Now().Add(expiry),
+		InvitedBy: invitedBy,
+	}
+	if err := s.repo.Create(invitation); err != nil {
+		return nil, errors.NewInternalServerError("Failed to create invitation")
+	}
+
+	if err := s.sendInvitation(invitation, rawToken, expiry); err != nil {
+		logger.Error("Failed to send invitation email:", err)
+		// Nobody can use the link now, so don't leave it pending
+		if _, err := s.repo.Revoke(invitation.ID); err != nil {
+			logger.Error("Failed to revoke unsent invitation:", err)
+		}
+		return nil, errors.NewInternalServerError("Failed to send invitation email")
+	}
+
+	logger.SecurityEvent("invitation_created", logrus.Fields{
+		"invitation_id": invitation.ID,
+		"invited_by":    invitedBy,
+		"role":          role,
+	})
+
+	return invitation.ToResponse(), nil
+}
+
+// List returns all invitations with their status
+func (s *Service) List() ([]InvitationResponse, error) {
+	invitations, err := s.repo.FindAll()
+	if err != nil {
+		return nil, errors.NewInternalServerError("Failed to list invitations")
+	}
+
+	responses := make([]InvitationResponse, len(invitations))
+	for i := range invitations {
+		responses[i] = *invitations[i].ToResponse()
+	}
+	return responses, nil
+}
+
+// Revoke revokes a pending invitation
+func (s *Service) Revoke(id uint) error {
+	revoked, err := s.repo.Revoke(id)
+	if err != nil {
+		return errors.NewInternalServerError("Failed to revoke invitation")
+	}
+	if !revoked {
+		return errors.NewNotFoundError("Invitation")
+	}
+	return nil
+}
+
+// FindInvitation returns the pending invitation for a token without using
+// it up. It implements auth.InvitationRedeemer.
+func (s *Service) FindInvitation(rawToken string) (*auth.InvitationPrincipal, error) {
+	invitation, err := s.repo.FindPendingByTokenHash(hashToken(rawToken))
+	if err != nil {
+		return nil, errInvalidInvitation
+	}
+
+	return &auth.InvitationPrincipal{
+		ID:    invitation.ID,
+		Email: invitation.Email,
+		Role:  invitation.Role,
+	}, nil
+}
+
+// RedeemInvitation marks an invitation as accepted and creates the user in
+// the same transaction. It fails if the invitation was used, revoked or
+// expired since it was looked up. It implements auth.InvitationRedeemer.
+func (s *Service) RedeemInvitation(id uint, createUser func(tx *gorm.DB) error) error {
+	return s.repo.DB.Transaction(func(tx *gorm.DB) error {
+		accepted, err := NewRepository(tx).MarkAccepted(id)
+		if err != nil {
+			return errors.NewInternalServerError("Failed to accept invitation")
+		}
+		if !accepted {
+			return errInvalidInvitation
+		}
+		return createUser(tx)
+	})
+}
+
+// sendInvitation mails the invitation link to the invitee
+func (s *Service) sendInvitation(invitation *Invitation, rawToken string, expiry time.Duration) error {
+	return s.mailer.Send(&mailer.Message{
+		To:      invitation.Email,
+		Subject: "You have been invited",
+		Body: fmt.Sprintf(
+			"Hi,\n\nYou have been invited to create an account. Use the link below to choose a password. It expires in %s and can only be used once.\n\n%s\n\nIf you were not expecting this invitation, you can ignore this email.\n",
+			expiry, buildLink(s.acceptURL, rawToken),
+		),
+	})
+}
+
+// buildLink appends a token to a base URL as the "token" query parameter
+func buildLink(baseURL, token string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return baseURL + "?token=" + url.QueryEscape(token)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// generateToken generates a random invitation token
+func generateToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// hashToken hashes an invitation token for storage and lookup
+func hashToken(rawToken string) string {
+	sum := sha256.Sum256([]byte(rawToken))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,121 @@
+package oauthclients
+
+import (
+	"go-fiber-gorm/core/errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Controller handles HTTP requests related to OAuth clients
+type Controller struct {
+	service *Service
+}
+
+// NewController creates a new OAuth client controller
+func NewController(service *Service) *Controller {
+	return &Controller{
+		service: service,
+	}
+}
+
+// RegisterRoutes registers the admin routes for managing OAuth clients. The
+// given middleware must authenticate the user and check their permission.
+func (c *Controller) RegisterRoutes(router fiber.Router, middleware ...fiber.Handler) {
+	clients := router.Group("/admin/oauth-clients", middleware...)
+
+	clients.Post("/", c.Create)
+	clients.Get("/", c.List)
+	clients.Delete("/:id", c.Revoke)
+}
+
+// Create handles OAuth client registration
+// @Summary Create OAuth client
+// @Description Register a client for the client credentials grant. The secret is only shown in this response.
+// @Tags oauth-clients
+// @Accept json
+// @Produce json
+// @Param client body CreateClientRequest true "Client details"
+// @Security BearerAuth
+// @Success 201 {object} CreatedClientResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /admin/oauth-clients [post]
+func (c *Controller) Create(ctx *fiber.Ctx) error {
+	userID, ok := ctx.Locals("userID").(uint)
+	if !ok {
+		return errors.NewUnauthorizedError("User not authenticated")
+	}
+
+	req := new(CreateClientRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	result, err := c.service.Create(userID, req)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// List handles listing OAuth clients
+// @Summary List OAuth clients
+// @Description List the active OAuth clients
+// @Tags oauth-clients
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} ClientResponse
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /admin/oauth-clients [get]
+func (c *Controller) List(ctx *fiber.Ctx) error {
+	clients, err := c.service.List()
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    clients,
+	})
+}
+
+// Revoke handles revoking an OAuth client
+// @Summary Revoke OAuth client
+// @Description Revoke an OAuth client so it can no longer obtain tokens
+// @Tags oauth-clients
+// @Accept json
+// @Produce json
+// @Param id path int true "OAuth client ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /admin/oauth-clients/{id} [delete]
+func (c *Controller) Revoke(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return errors.NewBadRequestError("Invalid OAuth client ID")
+	}
+
+	if err := c.service.Revoke(uint(id)); err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"message": "OAuth client revoked successfully",
+	})
+}
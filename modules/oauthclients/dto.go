@@ -0,0 +1,28 @@
+package oauthclients
+
+import "time"
+
+// CreateClientRequest represents the request for registering an OAuth client
+type CreateClientRequest struct {
+	Name     string   `json:"name" validate:"required,max=100"`
+	Scopes   []string `json:"scopes" validate:"required,min=1,dive,required,max=100"`
+	Audience string   `json:"audience" validate:"omitempty,max=255"` // Defaults to this API
+}
+
+// ClientResponse represents an OAuth client in listings. The secret is never returned.
+type ClientResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	ClientID   string     `json:"client_id"`
+	Scopes     []string   `json:"scopes"`
+	Audience   string     `json:"audience,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// CreatedClientResponse is returned once when a client is registered. It is
+// the only time the plaintext secret is available.
+type CreatedClientResponse struct {
+	*ClientResponse
+	ClientSecret string `json:"client_secret"`
+}
@@ -0,0 +1,50 @@
+package oauthclients
+
+import (
+	"strings"
+	"time"
+)
+
+// Client is an OAuth2 client that obtains access tokens for
+// service-to-service calls with the client credentials grant
+type Client struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	ClientID   string     `gorm:"size:64;not null;uniqueIndex" json:"client_id"`
+	SecretHash string     `gorm:"size:64;not null" json:"-"`
+	Scopes     string     `gorm:"size:1000;not null" json:"-"` // Space-separated scopes the client may request
+	Audience   string     `gorm:"size:255" json:"audience"`
+	CreatedBy  uint       `gorm:"not null" json:"created_by"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// TableName keeps the table name explicit, as "clients" is too generic
+func (Client) TableName() string {
+	return "oauth_clients"
+}
+
+// ScopeList returns the scopes the client may request
+func (c *Client) ScopeList() []string {
+	return strings.Fields(c.Scopes)
+}
+
+// IsActive reports whether the client can still obtain tokens
+func (c *Client) IsActive() bool {
+	return c.RevokedAt == nil
+}
+
+// ToResponse converts a client to a response
+func (c *Client) ToResponse() *ClientResponse {
+	return &ClientResponse{
+		ID:         c.ID,
+		Name:       c.Name,
+		ClientID:   c.ClientID,
+		Scopes:     c.ScopeList(),
+		Audience:   c.Audience,
+		CreatedAt:  c.CreatedAt,
+		LastUsedAt: c.LastUsedAt,
+	}
+}
@@ -0,0 +1,61 @@
+package oauthclients
+
+import (
+	"go-fiber-gorm/core/errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Repository handles database operations for OAuth clients
+type Repository struct {
+	DB *gorm.DB
+}
+
+// NewRepository creates a new OAuth client repository
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{
+		DB: db,
+	}
+}
+
+// Create creates a new client
+func (r *Repository) Create(client *Client) error {
+	return r.DB.Create(client).Error
+}
+
+// FindByClientID finds a client by its public client ID
+func (r *Repository) FindByClientID(clientID string) (*Client, error) {
+	var client Client
+	err := r.DB.Where("client_id = ?", clientID).First(&client).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError("OAuth client")
+		}
+		return nil, errors.NewInternalServerError(err.Error())
+	}
+	return &client, nil
+}
+
+// FindActive returns the clients that have not been revoked
+func (r *Repository) FindActive() ([]Client, error) {
+	var clients []Client
+	err := r.DB.Where("revoked_at IS NULL").Order("created_at desc").Find(&clients).Error
+	return clients, err
+}
+
+// Revoke revokes a client. It returns false if no active client matched.
+func (r *Repository) Revoke(id uint) (bool, error) {
+	result := r.DB.Model(&Client{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// TouchLastUsed records when a client last obtained a token
+func (r *Repository) TouchLastUsed(id uint, usedAt time.Time) error {
+	return r.DB.Model(&Client{}).Where("id = ?", id).Update("last_used_at", usedAt).Error
+}
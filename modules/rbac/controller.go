@@ -0,0 +1,326 @@
+package rbac
+
+import (
+	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/modules/auth"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Controller handles HTTP requests for managing roles
+type Controller struct {
+	service *Service
+}
+
+// NewController creates a new RBAC controller
+func NewController(service *Service) *Controller {
+	return &Controller{
+		service: service,
+	}
+}
+
+// RegisterRoutes registers the admin routes of the RBAC module. The given
+// middleware must restrict access, e.g. to the roles:manage permission. It
+// is applied per route so other modules can add their own /admin routes.
+// recentAuth additionally guards the routes that change roles or role
+// assignments, e.g. to require a recent login; it may be nil.
+func (c *Controller) RegisterRoutes(router fiber.Router, recentAuth fiber.Handler, middleware ...fiber.Handler) {
+	admin := router.Group("/admin")
+	guard := func(handlers ...fiber.Handler) []fiber.Handler {
+		return append(append([]fiber.Handler{}, middleware...), handlers...)
+	}
+	guardChange := func(handler fiber.Handler) []fiber.Handler {
+		if recentAuth == nil {
+			return guard(handler)
+		}
+		return guard(recentAuth, handler)
+	}
+
+	admin.Get("/roles", guard(c.ListRoles)...)
+	admin.Post("/roles", guardChange(c.CreateRole)...)
+	admin.Get("/roles/:id", guard(c.GetRole)...)
+	admin.Put("/roles/:id", guardChange(c.UpdateRole)...)
+	admin.Delete("/roles/:id", guardChange(c.DeleteRole)...)
+	admin.Get("/permissions", guard(c.ListPermissions)...)
+	admin.Get("/users/:id/roles", guard(c.GetUserRoles)...)
+	admin.Put("/users/:id/roles", guardChange(c.SetUserRoles)...)
+}
+
+// ListRoles handles listing all roles
+// @Summary List roles
+// @Description List all roles with their permissions
+// @Tags rbac
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} RoleResponse
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /admin/roles [get]
+func (c *Controller) ListRoles(ctx *fiber.Ctx) error {
+	roles, err := c.service.ListRoles()
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    roles,
+	})
+}
+
+// CreateRole handles role creation
+// @Summary Create role
+// @Description Create a role with a set of permissions
+// @Tags rbac
+// @Accept json
+// @Produce json
+// @Param role body CreateRoleRequest true "Role"
+// @Security BearerAuth
+// @Success 201 {object} RoleResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /admin/roles [post]
+func (c *Controller) CreateRole(ctx *fiber.Ctx) error {
+	grants, err := callerGrants(ctx)
+	if err != nil {
+		return err
+	}
+
+	req := new(CreateRoleRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	role, err := c.service.CreateRole(grants, req)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    role,
+	})
+}
+
+// GetRole handles retrieving a role by ID
+// @Summary Get role
+// @Description Get a role and its permissions
+// @Tags rbac
+// @Accept json
+// @Produce json
+// @Param id path int true "Role ID"
+// @Security BearerAuth
+// @Success 200 {object} RoleResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/roles/{id} [get]
+func (c *Controller) GetRole(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return errors.NewBadRequestError("Invalid role ID")
+	}
+
+	role, err := c.service.GetRole(uint(id))
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    role,
+	})
+}
+
+// UpdateRole handles updating a role
+// @Summary Update role
+// @Description Update a role's description and replace its permissions
+// @Tags rbac
+// @Accept json
+// @Produce json
+// @Param id path int true "Role ID"
+// @Param role body UpdateRoleRequest true "Role changes"
+// @Security BearerAuth
+// @Success 200 {object} RoleResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /admin/roles/{id} [put]
+func (c *Controller) UpdateRole(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return errors.NewBadRequestError("Invalid role ID")
+	}
+
+	grants, err := callerGrants(ctx)
+	if err != nil {
+		return err
+	}
+
+	req := new(UpdateRoleRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	role, err := c.service.UpdateRole(uint(id), grants, req)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    role,
+	})
+}
+
+// DeleteRole handles deleting a role
+// @Summary Delete role
+// @Description Delete a role and remove it from all users. Built-in roles cannot be deleted.
+// @Tags rbac
+// @Accept json
+// @Produce json
+// @Param id path int true "Role ID"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /admin/roles/{id} [delete]
+func (c *Controller) DeleteRole(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return errors.NewBadRequestError("Invalid role ID")
+	}
+
+	grants, err := callerGrants(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := c.service.DeleteRole(uint(id), grants); err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"message": "Role deleted successfully",
+	})
+}
+
+// ListPermissions handles listing the permission catalog
+// @Summary List permissions
+// @Description List the permissions that can be granted to roles
+// @Tags rbac
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} Permission
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /admin/permissions [get]
+func (c *Controller) ListPermissions(ctx *fiber.Ctx) error {
+	permissions, err := c.service.ListPermissions()
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    permissions,
+	})
+}
+
+// GetUserRoles handles listing the roles assigned to a user
+// @Summary Get user roles
+// @Description List the roles assigned to a user in addition to their primary role
+// @Tags rbac
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Security BearerAuth
+// @Success 200 {array} RoleResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/users/{id}/roles [get]
+func (c *Controller) GetUserRoles(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return errors.NewBadRequestError("Invalid user ID")
+	}
+
+	roles, err := c.service.GetUserRoles(uint(id))
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    roles,
+	})
+}
+
+// SetUserRoles handles replacing the roles assigned to a user
+// @Summary Set user roles
+// @Description Replace the roles assigned to a user
+// @Tags rbac
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param roles body SetUserRolesRequest true "Role names"
+// @Security BearerAuth
+// @Success 200 {array} RoleResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /admin/users/{id}/roles [put]
+func (c *Controller) SetUserRoles(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return errors.NewBadRequestError("Invalid user ID")
+	}
+
+	grants, err := callerGrants(ctx)
+	if err != nil {
+		return err
+	}
+
+	req := new(SetUserRolesRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return errors.NewBadRequestError("Invalid request body")
+	}
+
+	roles, err := c.service.SetUserRoles(uint(id), grants, req)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(fiber.Map{
+		"success": true,
+		"data":    roles,
+	})
+}
+
+// callerGrants returns the grants resolved by the permission check the
+// routes are registered with
+func callerGrants(ctx *fiber.Ctx) (*auth.Grants, error) {
+	grants, ok := ctx.Locals("grants").(*auth.Grants)
+	if !ok {
+		return nil, errors.NewForbiddenError("You don't have permission to access this resource")
+	}
+	return grants, nil
+}
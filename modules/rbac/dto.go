@@ -0,0 +1,32 @@
+package rbac
+
+import "time"
+
+// CreateRoleRequest represents the request for creating a role
+type CreateRoleRequest struct {
+	Name        string   `json:"name" validate:"required,min=2,max=50"`
+	Description string   `json:"description" validate:"max=255"`
+	Permissions []string `json:"permissions"`
+}
+
+// UpdateRoleRequest represents the request for updating a role. The
+// permission list replaces the current one when given.
+type UpdateRoleRequest struct {
+	Description *string  `json:"description" validate:"omitempty,max=255"`
+	Permissions []string `json:"permissions"`
+}
+
+// SetUserRolesRequest represents the request for replacing a user's roles
+type SetUserRolesRequest struct {
+	Roles []string `json:"roles" validate:"dive,required"`
+}
+
+// RoleResponse represents a role in responses
+type RoleResponse struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
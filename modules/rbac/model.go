@@ -0,0 +1,81 @@
+package rbac
+
+import "time"
+
+// Built-in permissions. Roles are managed at runtime, but the permissions
+// they grant are checked in code, so the catalog is fixed.
+const (
+	PermissionUsersCreate  = "users:create"
+	PermissionUsersRead    = "users:read"
+	PermissionUsersUpdate  = "users:update"
+	PermissionUsersDelete  = "users:delete"
+	PermissionUsersUnlock  = "users:unlock"
+	PermissionSessionsRead = "sessions:read"
+	PermissionRolesManage  = "roles:manage"
+
+	PermissionUsersImpersonate = "users:impersonate"
+	PermissionClientsManage    = "clients:manage"
+	PermissionUsersInvite      = "users:invite"
+)
+
+// DefaultPermissions describes the permission catalog seeded by the migrations
+var DefaultPermissions = map[string]string{
+	PermissionUsersCreate:  "Create users",
+	PermissionUsersRead:    "View any user",
+	PermissionUsersUpdate:  "Edit any user",
+	PermissionUsersDelete:  "Delete users",
+	PermissionUsersUnlock:  "Lift login lockouts",
+	PermissionSessionsRead: "View the sessions of any user",
+	PermissionRolesManage:  "Manage roles and role assignments",
+
+	PermissionUsersImpersonate: "Act as another user; every request is audited",
+	PermissionClientsManage:    "Register and revoke OAuth clients",
+	PermissionUsersInvite:      "Invite users by email with a pre-assigned role",
+}
+
+// Permission is a named capability that can be granted through roles
+type Permission struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Name        string    `gorm:"size:100;not null;uniqueIndex" json:"name"`
+	Description string    `gorm:"size:255" json:"description"`
+}
+
+// Role is a named set of permissions
+type Role struct {
+	ID          uint         `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	Name        string       `gorm:"size:50;not null;uniqueIndex" json:"name"`
+	Description string       `gorm:"size:255" json:"description"`
+	Permissions []Permission `gorm:"many2many:role_permissions;constraint:OnDelete:CASCADE" json:"permissions"`
+}
+
+// UserRole assigns a role to a user
+type UserRole struct {
+	UserID    uint      `gorm:"primaryKey" json:"user_id"`
+	RoleID    uint      `gorm:"primaryKey;index" json:"role_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Role      Role      `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// PermissionNames returns the names of the permissions granted by the role
+func (r *Role) PermissionNames() []string {
+	names := make([]string, len(r.Permissions))
+	for i, p := range r.Permissions {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// ToResponse converts a role to a response
+func (r *Role) ToResponse() *RoleResponse {
+	return &RoleResponse{
+		ID:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		Permissions: r.PermissionNames(),
+		CreatedAt:   r.CreatedAt,
+		UpdatedAt:   r.UpdatedAt,
+	}
+}
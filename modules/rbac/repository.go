@@ -0,0 +1,137 @@
+package rbac
+
+import (
+	"go-fiber-gorm/core/errors"
+
+	"gorm.io/gorm"
+)
+
+// Repository handles database operations for roles and permissions
+type Repository struct {
+	DB *gorm.DB
+}
+
+// NewRepository creates a new RBAC repository
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{
+		DB: db,
+	}
+}
+
+// ListRoles returns all roles with their permissions
+func (r *Repository) ListRoles() ([]Role, error) {
+	var roles []Role
+	err := r.DB.Preload("Permissions").Order("name").Find(&roles).Error
+	return roles, err
+}
+
+// FindRoleByID finds a role by ID
+func (r *Repository) FindRoleByID(id uint) (*Role, error) {
+	var role Role
+	err := r.DB.Preload("Permissions").First(&role, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError("Role")
+		}
+		return nil, errors.NewInternalServerError(err.Error())
+	}
+	return &role, nil
+}
+
+// FindRoleByName finds a role by name
+func (r *Repository) FindRoleByName(name string) (*Role, error) {
+	var role Role
+	err := r.DB.Preload("Permissions").Where("name = ?", name).First(&role).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError("Role")
+		}
+		return nil, errors.NewInternalServerError(err.Error())
+	}
+	return &role, nil
+}
+
+// FindRolesByNames returns the roles with the given names and their permissions
+func (r *Repository) FindRolesByNames(names []string) ([]Role, error) {
+	var roles []Role
+	err := r.DB.Preload("Permissions").Where("name IN ?", names).Find(&roles).Error
+	return roles, err
+}
+
+// CreateRole creates a new role with its permissions
+func (r *Repository) CreateRole(role *Role) error {
+	return r.DB.Create(role).Error
+}
+
+// UpdateRole saves a role and replaces its permissions
+func (r *Repository) UpdateRole(role *Role) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Permissions").Save(role).Error; err != nil {
+			return err
+		}
+		return tx.Model(role).Association("Permissions").Replace(role.Permissions)
+	})
+}
+
+// DeleteRole deletes a role along with its permission grants and user assignments
+func (r *Repository) DeleteRole(role *Role) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", role.ID).Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+		return tx.Select("Permissions").Delete(role).Error
+	})
+}
+
+// ListPermissions returns the permission catalog
+func (r *Repository) ListPermissions() ([]Permission, error) {
+	var permissions []Permission
+	err := r.DB.Order("name").Find(&permissions).Error
+	return permissions, err
+}
+
+// FindPermissionsByNames returns the permissions with the given names
+func (r *Repository) FindPermissionsByNames(names []string) ([]Permission, error) {
+	var permissions []Permission
+	err := r.DB.Where("name IN ?", names).Find(&permissions).Error
+	return permissions, err
+}
+
+// FindUserRoles returns the roles assigned to a user
+func (r *Repository) FindUserRoles(userID uint) ([]Role, error) {
+	var roles []Role
+	err := r.DB.Preload("Permissions").
+		Where("id IN (?)", r.DB.Model(&UserRole{}).Select("role_id").Where("user_id = ?", userID)).
+		Order("name").
+		Find(&roles).Error
+	return roles, err
+}
+
+// FindEffectiveRoles returns the roles assigned to a user plus the role
+// named by the user's primary role, with their permissions
+func (r *Repository) FindEffectiveRoles(userID uint, primaryRole string) ([]Role, error) {
+	var roles []Role
+	err := r.DB.Preload("Permissions").
+		Where("id IN (?) OR name = ?", r.DB.Model(&UserRole{}).Select("role_id").Where("user_id = ?", userID), primaryRole).
+		Find(&roles).Error
+	return roles, err
+}
+
+// SetUserRoles replaces the roles assigned to a user
+func (r *Repository) SetUserRoles(userID uint, roleIDs []uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+
+		if len(roleIDs) == 0 {
+			return nil
+		}
+
+		assignments := make([]UserRole, len(roleIDs))
+		for i, roleID := range roleIDs {
+			assignments[i] = UserRole{UserID: userID, RoleID: roleID}
+		}
+		return tx.Create(&assignments).Error
+	})
+}
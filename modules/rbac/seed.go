@@ -0,0 +1,30 @@
+package rbac
+
+import "gorm.io/gorm"
+
+// Seed creates the permission catalog and the built-in roles. The admin role
+// is granted every permission; the user role starts without any. Existing
+// rows are left untouched, so it is safe to run repeatedly.
+func Seed(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var permissions []Permission
+		for name, description := range DefaultPermissions {
+			permission := Permission{Name: name, Description: description}
+			if err := tx.Where(Permission{Name: name}).FirstOrCreate(&permission).Error; err != nil {
+				return err
+			}
+			permissions = append(permissions, permission)
+		}
+
+		admin := Role{Name: "admin", Description: "Full access"}
+		if err := tx.Where(Role{Name: admin.Name}).FirstOrCreate(&admin).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&admin).Association("Permissions").Append(permissions); err != nil {
+			return err
+		}
+
+		member := Role{Name: "user", Description: "Regular user"}
+		return tx.Where(Role{Name: member.Name}).FirstOrCreate(&member).Error
+	})
+}
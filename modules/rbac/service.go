@@ -0,0 +1,358 @@
+package rbac
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-fiber-gorm/core/cache"
+	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/core/logger"
+	"go-fiber-gorm/modules/auth"
+	"go-fiber-gorm/modules/user"
+	"sort"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	// grantsTTL bounds how long resolved permissions are cached per user
+	grantsTTL = 5 * time.Minute
+	// versionKey is bumped on every RBAC change to invalidate all cached grants
+	versionKey = "rbac:version"
+)
+
+// builtinRoles are referenced by user.User.Role and cannot be deleted
+var builtinRoles = map[string]bool{
+	"admin": true,
+	"user":  true,
+}
+
+// Service handles role and permission business logic
+type Service struct {
+	repo      *Repository
+	userRepo  *user.Repository
+	store     cache.Store
+	validator *validator.Validate
+}
+
+// NewService creates a new RBAC service. Resolved permissions are cached in store.
+func NewService(repo *Repository, userRepo *user.Repository, store cache.Store) *Service {
+	return &Service{
+		repo:      repo,
+		userRepo:  userRepo,
+		store:     store,
+		validator: validator.New(),
+	}
+}
+
+// ListRoles returns all roles
+func (s *Service) ListRoles() ([]RoleResponse, error) {
+	roles, err := s.repo.ListRoles()
+	if err != nil {
+		return nil, errors.NewInternalServerError("Failed to list roles")
+	}
+	return toRoleResponses(roles), nil
+}
+
+// GetRole returns a role by ID
+func (s *Service) GetRole(id uint) (*RoleResponse, error) {
+	role, err := s.repo.FindRoleByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return role.ToResponse(), nil
+}
+
+// CreateRole creates a new role. The caller, described by grants, must hold
+// every permission the role grants.
+func (s *Service) CreateRole(grants *auth.Grants, req *CreateRoleRequest) (*RoleResponse, error) {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return nil, errors.NewValidationError(err)
+	}
+
+	if existing, err := s.repo.FindRoleByName(req.Name); err == nil && existing != nil {
+		return nil, errors.NewBadRequestError("Role already exists")
+	}
+
+	permissions, err := s.findPermissions(req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkGrantable(grants, req.Permissions); err != nil {
+		return nil, err
+	}
+
+	role := &Role{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: permissions,
+	}
+	if err := s.repo.CreateRole(role); err != nil {
+		return nil, errors.NewInternalServerError("Failed to create role")
+	}
+
+	s.invalidateGrants()
+	return role.ToResponse(), nil
+}
+
+// UpdateRole updates the description and permissions of a role. The
+// caller, described by grants, must hold every permission the role grants
+// before and after the change.
+func (s *Service) UpdateRole(id uint, grants *auth.Grants, req *UpdateRoleRequest) (*RoleResponse, error) {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return nil, errors.NewValidationError(err)
+	}
+
+	role, err := s.repo.FindRoleByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkGrantable(grants, role.PermissionNames()); err != nil {
+		return nil, err
+	}
+
+	if req.Description != nil {
+		role.Description = *req.Description
+	}
+	if req.Permissions != nil {
+		permissions, err := s.findPermissions(req.Permissions)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkGrantable(grants, req.Permissions); err != nil {
+			return nil, err
+		}
+		role.Permissions = permissions
+	}
+
+	if err := s.repo.UpdateRole(role); err != nil {
+		return nil, errors.NewInternalServerError("Failed to update role")
+	}
+
+	s.invalidateGrants()
+	return role.ToResponse(), nil
+}
+
+// DeleteRole deletes a role and removes it from all users. The caller,
+// described by grants, must hold every permission the role grants.
+func (s *Service) DeleteRole(id uint, grants *auth.Grants) error {
+	role, err := s.repo.FindRoleByID(id)
+	if err != nil {
+		return err
+	}
+
+	if builtinRoles[role.Name] {
+		return errors.NewBadRequestError("Built-in roles cannot be deleted")
+	}
+	if err := checkGrantable(grants, role.PermissionNames()); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteRole(role); err != nil {
+		return errors.NewInternalServerError("Failed to delete role")
+	}
+
+	s.invalidateGrants()
+	return nil
+}
+
+// ListPermissions returns the permission catalog
+func (s *Service) ListPermissions() ([]Permission, error) {
+	permissions, err := s.repo.ListPermissions()
+	if err != nil {
+		return nil, errors.NewInternalServerError("Failed to list permissions")
+	}
+	return permissions, nil
+}
+
+// GetUserRoles returns the roles assigned to a user
+func (s *Service) GetUserRoles(userID uint) ([]RoleResponse, error) {
+	if _, err := s.userRepo.FindByID(userID); err != nil {
+		return nil, err
+	}
+
+	roles, err := s.repo.FindUserRoles(userID)
+	if err != nil {
+		return nil, errors.NewInternalServerError("Failed to list user roles")
+	}
+	return toRoleResponses(roles), nil
+}
+
+// SetUserRoles replaces the roles assigned to a user. The caller, described
+// by grants, must hold every permission of the roles that are added or
+// removed.
+func (s *Service) SetUserRoles(userID uint, grants *auth.Grants, req *SetUserRolesRequest) ([]RoleResponse, error) {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return nil, errors.NewValidationError(err)
+	}
+
+	if _, err := s.userRepo.FindByID(userID); err != nil {
+		return nil, err
+	}
+
+	current, err := s.repo.FindUserRoles(userID)
+	if err != nil {
+		return nil, errors.NewInternalServerError("Failed to list user roles")
+	}
+
+	roles := []Role{}
+	if len(req.Roles) > 0 {
+		roles, err = s.repo.FindRolesByNames(req.Roles)
+		if err != nil {
+			return nil, errors.NewInternalServerError("Failed to look up roles")
+		}
+		found := make([]string, len(roles))
+		for i, role := range roles {
+			found[i] = role.Name
+		}
+		if missing := missingNames(req.Roles, found); len(missing) > 0 {
+			return nil, errors.NewBadRequestError("Unknown roles").WithDetails(map[string]interface{}{"roles": missing})
+		}
+	}
+
+	// Unchanged assignments are fine; only added and removed roles are checked
+	assigned := make(map[uint]bool, len(current))
+	for _, role := range current {
+		assigned[role.ID] = true
+	}
+	requested := make(map[uint]bool, len(roles))
+	roleIDs := []uint{}
+	for _, role := range roles {
+		requested[role.ID] = true
+		roleIDs = append(roleIDs, role.ID)
+		if !assigned[role.ID] {
+			if err := checkGrantable(grants, role.PermissionNames()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, role := range current {
+		if !requested[role.ID] {
+			if err := checkGrantable(grants, role.PermissionNames()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := s.repo.SetUserRoles(userID, roleIDs); err != nil {
+		return nil, errors.NewInternalServerError("Failed to assign roles")
+	}
+
+	s.invalidateGrants()
+	return s.GetUserRoles(userID)
+}
+
+// ResolveGrants returns the effective roles and permissions of a user. The
+// user's primary role (user.User.Role) counts as an assigned role. Results
+// are cached until the next RBAC change. It implements auth.PermissionResolver.
+func (s *Service) ResolveGrants(userID uint, primaryRole string) (*auth.Grants, error) {
+	key := s.grantsKey(userID, primaryRole)
+	if cached, ok := s.store.Get(key); ok {
+		var grants auth.Grants
+		if err := json.Unmarshal([]byte(cached), &grants); err == nil {
+			return &grants, nil
+		}
+	}
+
+	roles, err := s.repo.FindEffectiveRoles(userID, primaryRole)
+	if err != nil {
+		return nil, errors.NewInternalServerError("Failed to resolve permissions")
+	}
+
+	grants := &auth.Grants{Roles: []string{}, Permissions: []string{}}
+	seen := make(map[string]bool)
+	for _, role := range roles {
+		grants.Roles = append(grants.Roles, role.Name)
+		for _, permission := range role.Permissions {
+			if !seen[permission.Name] {
+				seen[permission.Name] = true
+				grants.Permissions = append(grants.Permissions, permission.Name)
+			}
+		}
+	}
+	sort.Strings(grants.Roles)
+	sort.Strings(grants.Permissions)
+
+	if data, err := json.Marshal(grants); err == nil {
+		if err := s.store.Set(key, string(data), grantsTTL); err != nil {
+			logger.Error("Failed to cache permissions:", err)
+		}
+	}
+
+	return grants, nil
+}
+
+// checkGrantable rejects changes to permissions the caller does not hold
+// themselves, so managing roles cannot escalate privileges
+func checkGrantable(grants *auth.Grants, permissions []string) error {
+	for _, permission := range permissions {
+		if !grants.HasPermission(permission) {
+			return errors.NewForbiddenError("You cannot grant or revoke permissions you don't have")
+		}
+	}
+	return nil
+}
+
+// findPermissions looks up permissions by name and rejects unknown names
+func (s *Service) findPermissions(names []string) ([]Permission, error) {
+	if len(names) == 0 {
+		return []Permission{}, nil
+	}
+
+	permissions, err := s.repo.FindPermissionsByNames(names)
+	if err != nil {
+		return nil, errors.NewInternalServerError("Failed to look up permissions")
+	}
+	found := make([]string, len(permissions))
+	for i, permission := range permissions {
+		found[i] = permission.Name
+	}
+	if missing := missingNames(names, found); len(missing) > 0 {
+		return nil, errors.NewBadRequestError("Unknown permissions").WithDetails(map[string]interface{}{"permissions": missing})
+	}
+	return permissions, nil
+}
+
+// grantsKey builds the cache key of a user's grants for the current RBAC version
+func (s *Service) grantsKey(userID uint, primaryRole string) string {
+	version, ok := s.store.Get(versionKey)
+	if !ok {
+		version = "0"
+	}
+	return fmt.Sprintf("rbac:grants:%s:%d:%s", version, userID, primaryRole)
+}
+
+// invalidateGrants drops all cached grants by moving to a new RBAC version
+func (s *Service) invalidateGrants() {
+	if _, err := s.store.Increment(versionKey, 0); err != nil {
+		logger.Error("Failed to invalidate cached permissions:", err)
+	}
+}
+
+// toRoleResponses converts roles to responses
+func toRoleResponses(roles []Role) []RoleResponse {
+	responses := make([]RoleResponse, len(roles))
+	for i := range roles {
+		responses[i] = *roles[i].ToResponse()
+	}
+	return responses
+}
+
+// missingNames returns the requested names that were not found
+func missingNames(requested, found []string) []string {
+	present := make(map[string]bool, len(found))
+	for _, name := range found {
+		present[name] = true
+	}
+
+	var missing []string
+	for _, n := range requested {
+		if !present[n] {
+			missing = append(missing, n)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,147 @@
+package rbac
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"go-fiber-gorm/core/cache"
+	"go-fiber-gorm/core/errors"
+	"go-fiber-gorm/core/logger"
+	"go-fiber-gorm/modules/auth"
+	"go-fiber-gorm/modules/user"
+	"go-fiber-gorm/test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	logger.Setup("testing")
+	os.Exit(m.Run())
+}
+
+// supportGrants are the grants of a caller who manages roles but holds
+// only part of the permission catalog
+var supportGrants = &auth.Grants{
+	Roles:       []string{"support"},
+	Permissions: []string{PermissionRolesManage, PermissionUsersRead},
+}
+
+// newTestService creates a service on a seeded in-memory database with a
+// "support" role that matches supportGrants
+func newTestService(t *testing.T) (*Service, *user.Repository) {
+	t.Helper()
+
+	db := test.NewTestDB(t, &user.User{}, &Permission{}, &Role{}, &UserRole{})
+	require.NoError(t, Seed(db))
+
+	repo := NewRepository(db)
+	userRepo := user.NewRepository(db)
+	service := NewService(repo, userRepo, cache.NewMemoryStore())
+
+	permissions, err := repo.FindPermissionsByNames(supportGrants.Permissions)
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateRole(&Role{Name: "support", Permissions: permissions}))
+
+	return service, userRepo
+}
+
+// createTestUser stores a user with the given primary role
+func createTestUser(t *testing.T, userRepo *user.Repository, email string) *user.User {
+	t.Helper()
+
+	hashedPassword, err := user.NewPasswordHasher(user.Argon2Params{Memory: 64, Iterations: 1}).Hash("correct horse battery staple")
+	require.NoError(t, err)
+
+	u := &user.User{Name: "Test User", Email: email, Password: hashedPassword, Role: "user"}
+	require.NoError(t, userRepo.Create(u))
+	return u
+}
+
+func TestCreateRoleOnlyGrantsHeldPermissions(t *testing.T) {
+	service, _ := newTestService(t)
+
+	_, err := service.CreateRole(supportGrants, &CreateRoleRequest{
+		Name:        "impersonators",
+		Permissions: []string{PermissionUsersRead, PermissionUsersImpersonate},
+	})
+	assert.Equal(t, http.StatusForbidden, errors.StatusCode(err))
+
+	role, err := service.CreateRole(supportGrants, &CreateRoleRequest{
+		Name:        "readers",
+		Permissions: []string{PermissionUsersRead},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{PermissionUsersRead}, role.Permissions)
+}
+
+func TestUpdateRoleOnlyChangesHeldPermissions(t *testing.T) {
+	service, _ := newTestService(t)
+
+	support, err := service.repo.FindRoleByName("support")
+	require.NoError(t, err)
+	admin, err := service.repo.FindRoleByName("admin")
+	require.NoError(t, err)
+
+	// Adding a permission the caller lacks, e.g. to their own role
+	_, err = service.UpdateRole(support.ID, supportGrants, &UpdateRoleRequest{
+		Permissions: []string{PermissionRolesManage, PermissionUsersRead, PermissionClientsManage},
+	})
+	assert.Equal(t, http.StatusForbidden, errors.StatusCode(err))
+
+	// Changing a role that holds permissions the caller lacks
+	description := "Reduced"
+	_, err = service.UpdateRole(admin.ID, supportGrants, &UpdateRoleRequest{Description: &description})
+	assert.Equal(t, http.StatusForbidden, errors.StatusCode(err))
+
+	_, err = service.UpdateRole(support.ID, supportGrants, &UpdateRoleRequest{Permissions: []string{PermissionRolesManage}})
+	assert.NoError(t, err)
+}
+
+func TestDeleteRoleRequiresItsPermissions(t *testing.T) {
+	service, _ := newTestService(t)
+
+	role, err := service.CreateRole(&auth.Grants{Permissions: []string{PermissionClientsManage}}, &CreateRoleRequest{
+		Name:        "integrations",
+		Permissions: []string{PermissionClientsManage},
+	})
+	require.NoError(t, err)
+
+	err = service.DeleteRole(role.ID, supportGrants)
+	assert.Equal(t, http.StatusForbidden, errors.StatusCode(err))
+}
+
+func TestSetUserRolesOnlyAssignsHeldPermissions(t *testing.T) {
+	service, userRepo := newTestService(t)
+	u := createTestUser(t, userRepo, "jane@example.com")
+
+	// Assigning admin would grant permissions the caller lacks
+	_, err := service.SetUserRoles(u.ID, supportGrants, &SetUserRolesRequest{Roles: []string{"admin"}})
+	assert.Equal(t, http.StatusForbidden, errors.StatusCode(err))
+
+	roles, err := service.SetUserRoles(u.ID, supportGrants, &SetUserRolesRequest{Roles: []string{"support"}})
+	require.NoError(t, err)
+	require.Len(t, roles, 1)
+	assert.Equal(t, "support", roles[0].Name)
+}
+
+func TestSetUserRolesKeepsRolesTheCallerCannotRevoke(t *testing.T) {
+	service, userRepo := newTestService(t)
+	u := createTestUser(t, userRepo, "jane@example.com")
+
+	adminGrants := &auth.Grants{Roles: []string{"admin"}}
+	for permission := range DefaultPermissions {
+		adminGrants.Permissions = append(adminGrants.Permissions, permission)
+	}
+	_, err := service.SetUserRoles(u.ID, adminGrants, &SetUserRolesRequest{Roles: []string{"admin"}})
+	require.NoError(t, err)
+
+	// Removing admin is as much out of reach as granting it
+	_, err = service.SetUserRoles(u.ID, supportGrants, &SetUserRolesRequest{Roles: []string{}})
+	assert.Equal(t, http.StatusForbidden, errors.StatusCode(err))
+
+	// Unchanged assignments do not need the caller's permissions
+	_, err = service.SetUserRoles(u.ID, supportGrants, &SetUserRolesRequest{Roles: []string{"admin", "support"}})
+	assert.NoError(t, err)
+}
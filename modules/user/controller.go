@@ -93,7 +93,7 @@ func (c *Controller) GetByID(ctx *fiber.Ctx) error {
 
 // Update handles updating a user
 // @Summary Update a user
-// @Description Update a user with the provided information
+// @Description Update a user with the provided information. A new email is only applied once confirmed through the link mailed to it; until then it is returned as pending_email.
 // @Tags users
 // @Accept json
 // @Produce json
@@ -165,7 +165,10 @@ func (c *Controller) Delete(ctx *fiber.Ctx) error {
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Page size" default(10)
 // @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
+// @Security BearerAuth
 // @Router /api/v1/users [get]
 func (c *Controller) GetAll(ctx *fiber.Ctx) error {
 	// Parse query parameters for pagination
@@ -6,7 +6,7 @@ import "time"
 type CreateUserRequest struct {
 	Name     string `json:"name" validate:"required"`
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6"`
+	Password string `json:"password" validate:"required"`
 }
 
 // UpdateUserRequest is the request to update a user
@@ -23,6 +23,11 @@ type UserResponseDTO struct {
 	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+
+	// PendingEmail is set when an email change awaits confirmation
+	PendingEmail string `json:"pending_email,omitempty"`
 }
 
 // UsersResponseDTO represents a paginated list of users
@@ -14,8 +14,10 @@ type User struct {
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 	Name      string         `gorm:"size:100;not null" json:"name" validate:"required"`
 	Email     string         `gorm:"size:100;not null;uniqueIndex" json:"email" validate:"required,email"`
-	Password  string         `gorm:"size:100;not null" json:"-" validate:"required,min=6"`
-	Role      string         `gorm:"size:20;not null;default:'user'" json:"role"`
+	Password  string         `gorm:"size:255;not null" json:"-" validate:"required,min=6"`
+	Role      string         `gorm:"size:50;not null;default:'user'" json:"role"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
 }
 
 // UserResponse is the response returned to clients
@@ -26,12 +28,21 @@ type UserResponse struct {
 	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+}
+
+// IsEmailVerified reports whether the user has verified their email address
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
 }
 
-// BeforeSave will be called before creating/updating a user
-// Here you would hash the password
+// BeforeSave will be called before creating/updating a user.
+// It refuses to store a password that was not hashed by the PasswordHasher.
 func (u *User) BeforeSave(tx *gorm.DB) error {
-	// TODO: Implement password hashing
+	if !IsPasswordHash(u.Password) {
+		return ErrUnhashedPassword
+	}
 	return nil
 }
 
@@ -44,5 +55,7 @@ func (u *User) ToResponse() *UserResponse {
 		Role:      u.Role,
 		CreatedAt: u.CreatedAt,
 		UpdatedAt: u.UpdatedAt,
+
+		EmailVerifiedAt: u.EmailVerifiedAt,
 	}
 }
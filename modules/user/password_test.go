@@ -0,0 +1,105 @@
+package user
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testParams are cheap argon2id parameters that keep the tests fast
+var testParams = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestPasswordHasherHashesWithArgon2id(t *testing.T) {
+	hasher := NewPasswordHasher(testParams)
+
+	hash, err := hasher.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$"), hash)
+	assert.True(t, IsPasswordHash(hash))
+
+	// Every hash gets its own salt
+	again, err := hasher.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, again)
+
+	ok, needsRehash, err := hasher.Verify("correct horse battery staple", hash)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, needsRehash)
+
+	ok, needsRehash, err = hasher.Verify("wrong password", hash)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, needsRehash)
+}
+
+func TestPasswordHasherVerifiesLegacyBcrypt(t *testing.T) {
+	hasher := NewPasswordHasher(testParams)
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct horse battery staple"), bcrypt.MinCost)
+	require.NoError(t, err)
+	assert.True(t, IsPasswordHash(string(legacy)))
+
+	ok, needsRehash, err := hasher.Verify("correct horse battery staple", string(legacy))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, needsRehash, "bcrypt hashes are upgraded to argon2id")
+
+	ok, needsRehash, err = hasher.Verify("wrong password", string(legacy))
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, needsRehash)
+}
+
+func TestPasswordHasherNeedsRehashWhenParametersChange(t *testing.T) {
+	old := NewPasswordHasher(testParams)
+	hash, err := old.Hash("correct horse battery staple")
+	require.NoError(t, err)
+
+	stronger := testParams
+	stronger.Iterations = 2
+	current := NewPasswordHasher(stronger)
+
+	ok, needsRehash, err := current.Verify("correct horse battery staple", hash)
+	require.NoError(t, err)
+	assert.True(t, ok, "hashes with old parameters still verify")
+	assert.True(t, needsRehash)
+
+	// A wrong password never asks for a rehash
+	ok, needsRehash, err = current.Verify("wrong password", hash)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, needsRehash)
+}
+
+func TestPasswordHasherRejectsValuesThatAreNotHashes(t *testing.T) {
+	hasher := NewPasswordHasher(testParams)
+
+	for _, value := range []string{
+		"",
+		"plaintext-password",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$aGFzaGhhc2g",
+		"$argon2id$v=18$m=64,t=1,p=1$c2FsdHNhbHQ$aGFzaGhhc2g",
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdHNhbHQ$aGFzaGhhc2g",
+		"$argon2id$v=19$m=64,t=1,p=1$$aGFzaGhhc2g",
+	} {
+		assert.False(t, IsPasswordHash(value), value)
+
+		ok, _, err := hasher.Verify(value, value)
+		assert.False(t, ok, value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestBeforeSaveRejectsUnhashedPasswords(t *testing.T) {
+	u := &User{Password: "plaintext-password"}
+	assert.ErrorIs(t, u.BeforeSave(nil), ErrUnhashedPassword)
+
+	hash, err := NewPasswordHasher(testParams).Hash("plaintext-password")
+	require.NoError(t, err)
+	u.Password = hash
+	assert.NoError(t, u.BeforeSave(nil))
+}
@@ -6,16 +6,38 @@ import (
 	"github.com/go-playground/validator/v10"
 )
 
+// PasswordChecker rejects passwords that do not meet the password policy
+type PasswordChecker interface {
+	CheckPassword(password, name, email string) error
+}
+
+// EmailChangeVerifier confirms a new email address with its owner before
+// it replaces the user's current one
+type EmailChangeVerifier interface {
+	RequestEmailChange(user *User, newEmail string) error
+}
+
 // Service handles user-related business logic
 type Service struct {
 	repo      *Repository
+	hasher    *PasswordHasher
+	policy    PasswordChecker
+	emails    EmailChangeVerifier
 	validator *validator.Validate
 }
 
-// NewService creates a new user service
-func NewService(repo *Repository) *Service {
+// NewService creates a new user service. A nil hasher uses the default
+// argon2id parameters; a nil policy accepts any password; without an email
+// verifier email addresses cannot be changed.
+func NewService(repo *Repository, hasher *PasswordHasher, policy PasswordChecker, emails EmailChangeVerifier) *Service {
+	if hasher == nil {
+		hasher = NewPasswordHasher(Argon2Params{})
+	}
 	return &Service{
 		repo:      repo,
+		hasher:    hasher,
+		policy:    policy,
+		emails:    emails,
 		validator: validator.New(),
 	}
 }
@@ -33,12 +55,23 @@ func (s *Service) Create(req *CreateUserRequest) (*UserResponseDTO, error) {
 		return nil, errors.NewBadRequestError("Email already in use")
 	}
 
+	if s.policy != nil {
+		if err := s.policy.CheckPassword(req.Password, req.Name, req.Email); err != nil {
+			return nil, err
+		}
+	}
+
+	hashedPassword, err := s.hasher.Hash(req.Password)
+	if err != nil {
+		return nil, errors.NewInternalServerError("Failed to hash password")
+	}
+
 	// Create user
 	user := &User{
 		Name:     req.Name,
 		Email:    req.Email,
-		Password: req.Password, // Note: Password should be hashed in BeforeSave hook
-		Role:     "user",       // Default role
+		Password: hashedPassword,
+		Role:     "user", // Default role
 	}
 
 	if err := s.repo.Create(user); err != nil {
@@ -53,6 +86,8 @@ func (s *Service) Create(req *CreateUserRequest) (*UserResponseDTO, error) {
 		Role:      user.Role,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
+
+		EmailVerifiedAt: user.EmailVerifiedAt,
 	}
 
 	return response, nil
@@ -72,6 +107,8 @@ func (s *Service) GetByID(id uint) (*UserResponseDTO, error) {
 		Role:      user.Role,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
+
+		EmailVerifiedAt: user.EmailVerifiedAt,
 	}
 
 	return response, nil
@@ -94,13 +131,19 @@ func (s *Service) Update(id uint, req *UpdateUserRequest) (*UserResponseDTO, err
 	if req.Name != "" {
 		user.Name = req.Name
 	}
-	if req.Email != "" {
+	pendingEmail := ""
+	if req.Email != "" && req.Email != user.Email {
+		if s.emails == nil {
+			return nil, errors.NewBadRequestError("Email addresses cannot be changed")
+		}
 		// Check if email is already in use by another user
 		existingUser, err := s.repo.FindByEmail(req.Email)
 		if err == nil && existingUser != nil && existingUser.ID != id {
 			return nil, errors.NewBadRequestError("Email already in use")
 		}
-		user.Email = req.Email
+		// The new address only replaces the current one once its owner
+		// confirms it, so a session alone cannot re-point the account
+		pendingEmail = req.Email
 	}
 
 	// Save updates
@@ -108,6 +151,12 @@ func (s *Service) Update(id uint, req *UpdateUserRequest) (*UserResponseDTO, err
 		return nil, errors.NewInternalServerError("Failed to update user")
 	}
 
+	if pendingEmail != "" {
+		if err := s.emails.RequestEmailChange(user, pendingEmail); err != nil {
+			return nil, errors.NewInternalServerError("Failed to send email confirmation")
+		}
+	}
+
 	response := &UserResponseDTO{
 		ID:        user.ID,
 		Name:      user.Name,
@@ -115,6 +164,9 @@ func (s *Service) Update(id uint, req *UpdateUserRequest) (*UserResponseDTO, err
 		Role:      user.Role,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
+
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		PendingEmail:    pendingEmail,
 	}
 
 	return response, nil
@@ -161,6 +213,8 @@ func (s *Service) GetAll(page, limit int) ([]UserResponseDTO, int64, error) {
 			Role:      user.Role,
 			CreatedAt: user.CreatedAt,
 			UpdatedAt: user.UpdatedAt,
+
+			EmailVerifiedAt: user.EmailVerifiedAt,
 		})
 	}
 
@@ -2,9 +2,17 @@ package routes
 
 import (
 	"go-fiber-gorm/config"
+	"go-fiber-gorm/core/cache"
+	"go-fiber-gorm/core/logger"
+	"go-fiber-gorm/core/mailer"
+	"go-fiber-gorm/modules/apikeys"
 	"go-fiber-gorm/modules/auth"
 	"go-fiber-gorm/modules/health"
+	"go-fiber-gorm/modules/invitations"
+	"go-fiber-gorm/modules/oauthclients"
+	"go-fiber-gorm/modules/rbac"
 	"go-fiber-gorm/modules/user"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -17,7 +25,7 @@ import (
 // SetupRoutes configures the application routes and middleware
 func SetupRoutes(app *fiber.App, cfg *config.Config, db *gorm.DB, redisClient *redis.Client) {
 	// Global middleware
-	app.Use(cors.New())
+	app.Use(corsMiddleware(cfg.Server.CORSOrigins))
 	app.Use(recover.New())
 
 	// API routes with version prefix
@@ -28,10 +36,69 @@ func SetupRoutes(app *fiber.App, cfg *config.Config, db *gorm.DB, redisClient *r
 	healthController := health.NewController(healthService)
 	healthController.RegisterRoutes(api)
 
-	// User module setup
+	// Every password is hashed by the same hasher
+	passwordHasher := user.NewPasswordHasher(user.Argon2Params{
+		Memory:      uint32(cfg.Auth.Argon2Memory),
+		Iterations:  uint32(cfg.Auth.Argon2Iterations),
+		Parallelism: uint8(cfg.Auth.Argon2Parallelism),
+	})
+
+	// Every new password is checked against the same policy
+	breachedPasswords, err := auth.LoadBreachedPasswords(cfg.Auth.BreachedPasswordsFile)
+	if err != nil {
+		logger.Fatal("Failed to load breached password list:", err)
+	}
+	passwordPolicy := auth.NewPasswordPolicy(auth.PasswordPolicy{
+		MinLength:           cfg.Auth.PasswordMinLength,
+		MinCharacterClasses: cfg.Auth.PasswordMinClasses,
+		MinScore:            cfg.Auth.PasswordMinScore,
+		Breached:            breachedPasswords,
+	})
+
+	// User repository, shared by the modules below
 	userRepo := user.NewRepository(db)
-	userService := user.NewService(userRepo)
-	userController := user.NewController(userService)
+
+	// Shared cache store (Redis, or in-memory when Redis is unavailable)
+	cacheStore := cache.NewStore(redisClient)
+
+	// Mailer setup
+	mail, err := mailer.New(&cfg.Mail)
+	if err != nil {
+		logger.Fatal("Failed to set up mailer:", err)
+	}
+
+	// Access token signing keys
+	keys, err := auth.LoadKeySet(cfg.JWT.Secret, cfg.JWT.SigningKeyFile, cfg.JWT.VerificationKeyFiles)
+	if err != nil {
+		logger.Fatal("Failed to load JWT keys:", err)
+	}
+
+	// API key module setup
+	apiKeyRepo := apikeys.NewRepository(db)
+	apiKeyService := apikeys.NewService(apiKeyRepo)
+	apiKeyController := apikeys.NewController(apiKeyService)
+
+	// OAuth client module setup
+	oauthClientRepo := oauthclients.NewRepository(db)
+	oauthClientService := oauthclients.NewService(oauthClientRepo)
+	oauthClientController := oauthclients.NewController(oauthClientService)
+
+	// RBAC module setup
+	rbacRepo := rbac.NewRepository(db)
+	rbacService := rbac.NewService(rbacRepo, userRepo, cacheStore)
+	rbacController := rbac.NewController(rbacService)
+
+	// Invitation module setup
+	invitationRepo := invitations.NewRepository(db)
+	invitationService := invitations.NewService(invitationRepo, userRepo, rbacRepo, invitations.ServiceConfig{
+		Mailer:    mail,
+		AcceptURL: cfg.Server.FrontendURL + "/accept-invitation",
+		Expiry:    time.Duration(cfg.Auth.InvitationExpiryIn) * time.Second,
+	})
+	invitationController := invitations.NewController(invitationService)
+
+	// Sensitive operations require a login within this window
+	reauthMaxAge := time.Duration(cfg.Auth.ReauthMaxAgeIn) * time.Second
 
 	// Auth module setup
 	authRepo := auth.NewRepository(db)
@@ -39,24 +106,118 @@ func SetupRoutes(app *fiber.App, cfg *config.Config, db *gorm.DB, redisClient *r
 		authRepo,
 		userRepo,
 		auth.ServiceConfig{
-			JWTSecret:     cfg.JWT.Secret,                         // Should be loaded from config
-			AccessExpiry:  time.Duration(cfg.JWT.AccessExpiryIn),  // 1 hour
-			RefreshExpiry: time.Duration(cfg.JWT.RefreshExpiryIn), // 7 days
+			JWTSecret:           cfg.JWT.Secret, // Should be loaded from config
+			Keys:                keys,
+			APIKeys:             apiKeyService,
+			Permissions:         rbacService,
+			AccessExpiry:        time.Duration(cfg.JWT.AccessExpiryIn) * time.Second,  // 1 hour
+			RefreshExpiry:       time.Duration(cfg.JWT.RefreshExpiryIn) * time.Second, // 7 days
+			PasswordResetExpiry: time.Duration(cfg.Auth.PasswordResetExpiryIn) * time.Second,
+			PasswordResetURL:    cfg.Server.FrontendURL + "/reset-password",
+			Mailer:              mail,
+			PasswordHasher:      passwordHasher,
+			PasswordPolicy:      passwordPolicy,
+
+			Revocations: cache.NewRevocationStore(cacheStore),
+			Store:       cacheStore,
+			Attempts:    cache.NewAttemptStore(cacheStore),
+			Lockout: auth.LockoutPolicy{
+				MaxAttempts:   cfg.Auth.LoginMaxAttempts,
+				IPMaxAttempts: cfg.Auth.LoginIPMaxAttempts,
+				Duration:      time.Duration(cfg.Auth.LoginLockoutDurationIn) * time.Second,
+			},
+			Cookies: auth.CookieConfig{
+				Transport:   cfg.Auth.TokenTransport,
+				Domain:      cfg.Auth.CookieDomain,
+				Secure:      cfg.Auth.CookieSecure,
+				SameSite:    cfg.Auth.CookieSameSite,
+				RefreshPath: "/api/v1/auth",
+			},
+
+			EmailVerificationExpiry:  time.Duration(cfg.Auth.EmailVerificationExpiryIn) * time.Second,
+			EmailVerificationURL:     cfg.Server.FrontendURL + "/verify-email",
+			RequireEmailVerification: cfg.Auth.RequireEmailVerification,
+
+			MagicLinkExpiry: time.Duration(cfg.Auth.MagicLinkExpiryIn) * time.Second,
+			MagicLinkURL:    cfg.Server.FrontendURL + "/magic-link",
+
+			ImpersonationExpiry: time.Duration(cfg.Auth.ImpersonationExpiryIn) * time.Second,
+			ReauthMaxAge:        reauthMaxAge,
+
+			LoginHistoryRetention: time.Duration(cfg.Auth.LoginHistoryRetentionDays) * 24 * time.Hour,
+			NotifyNewDevices:      cfg.Auth.NotifyNewDevices,
+			MailQueue:             mailer.NewQueueMailer(mail, 100),
+
+			Clients:           oauthClientService,
+			ClientTokenExpiry: time.Duration(cfg.Auth.ClientTokenExpiryIn) * time.Second,
+			Audience:          cfg.Auth.TokenAudience,
+
+			RegistrationMode: cfg.Auth.RegistrationMode,
+			Invitations:      invitationService,
+
+			MFAIssuer: cfg.Auth.MFAIssuer,
+
+			OAuthProviders: oauthProviders(cfg.Auth.OAuthProviders),
+			WebAuthn: auth.WebAuthnConfig{
+				RPID:    cfg.Auth.WebAuthnRPID,
+				RPName:  cfg.Auth.WebAuthnRPName,
+				Origins: cfg.Auth.WebAuthnOrigins,
+			},
 		},
 	)
 	authMiddleware := auth.NewMiddleware(authService)
+
+	// User module setup (email changes are confirmed through the auth module)
+	userService := user.NewService(userRepo, passwordHasher, passwordPolicy, authService)
+	userController := user.NewController(userService)
 	authController := auth.NewController(authService)
 
+	// Delete login events once they fall out of the retention period
+	authService.StartLoginEventPruning()
+
+	// Audit requests made with impersonation tokens
+	api.Use(authMiddleware.AuditImpersonation())
+
 	// Register auth routes
 	authController.RegisterRoutes(api)
 
-	// Register user routes (using auth middleware for protected routes)
+	// Register API key routes (managing keys requires the owner's own session)
+	apiKeyController.RegisterRoutes(api, authMiddleware.OwnerRequired())
+
+	// Public verification keys live at the well-known path, outside the API prefix
+	app.Get("/.well-known/jwks.json", authController.JWKS)
+
+	// Ownership policies: users may act on their own account, staff need the
+	// permission and OAuth clients the scope
+	canListUsers := auth.AnyOf(auth.HasPermission(rbac.PermissionUsersRead), auth.HasScope("users:read"))
+	canReadUser := auth.AnyOf(auth.Self("id"), auth.HasPermission(rbac.PermissionUsersRead), auth.HasScope("users:read"))
+	canUpdateUser := auth.AnyOf(auth.Self("id"), auth.HasPermission(rbac.PermissionUsersUpdate))
+	canReadSessions := auth.AnyOf(auth.Self("id"), auth.HasPermission(rbac.PermissionSessionsRead))
+
+	// Register user routes (using auth middleware for protected routes).
+	// Creating users and changing their email is not allowed while
+	// impersonating, as it would allow taking over accounts.
 	users := api.Group("/users")
-	users.Post("/", authMiddleware.RoleRequired("admin"), userController.Create)
-	users.Get("/", userController.GetAll)
-	users.Get("/:id", authMiddleware.Protected(), userController.GetByID)
-	users.Put("/:id", authMiddleware.Protected(), userController.Update)
-	users.Delete("/:id", authMiddleware.RoleRequired("admin"), userController.Delete)
+	users.Post("/", authMiddleware.NoImpersonation(), authMiddleware.RequirePermission(rbac.PermissionUsersCreate), userController.Create)
+	users.Get("/", authMiddleware.Authorize(canListUsers), userController.GetAll)
+	users.Get("/:id", authMiddleware.Authorize(canReadUser), userController.GetByID)
+	users.Get("/:id/sessions", authMiddleware.Authorize(canReadSessions), authController.ListUserSessions)
+	users.Post("/:id/unlock", authMiddleware.RequirePermission(rbac.PermissionUsersUnlock), authController.UnlockUser)
+	users.Put("/:id", authMiddleware.NoImpersonation(), authMiddleware.Authorize(canUpdateUser), userController.Update)
+	users.Delete("/:id", authMiddleware.RequirePermission(rbac.PermissionUsersDelete), authMiddleware.RequireRecentAuth(reauthMaxAge), userController.Delete)
+
+	// Register admin routes
+	admin := api.Group("/admin")
+	admin.Post("/impersonate/:userID", authMiddleware.RequirePermission(rbac.PermissionUsersImpersonate), authController.Impersonate)
+
+	// Register OAuth client management routes; client secrets are credentials
+	oauthClientController.RegisterRoutes(api, authMiddleware.NoImpersonation(), authMiddleware.RequirePermission(rbac.PermissionClientsManage))
+
+	// Register invitation management routes; invitations create accounts
+	invitationController.RegisterRoutes(api, authMiddleware.NoImpersonation(), authMiddleware.RequirePermission(rbac.PermissionUsersInvite))
+
+	// Register role management routes; changes also require a recent login
+	rbacController.RegisterRoutes(api, authMiddleware.RequireRecentAuth(reauthMaxAge), authMiddleware.RequirePermission(rbac.PermissionRolesManage))
 
 	// 404 Handler
 	app.Use(func(c *fiber.Ctx) error {
@@ -69,3 +230,31 @@ func SetupRoutes(app *fiber.App, cfg *config.Config, db *gorm.DB, redisClient *r
 		})
 	})
 }
+
+// oauthProviders converts the configured identity providers for the auth module
+func oauthProviders(configs []config.OAuthProviderConfig) []auth.OAuthProviderConfig {
+	providers := make([]auth.OAuthProviderConfig, 0, len(configs))
+	for _, provider := range configs {
+		providers = append(providers, auth.OAuthProviderConfig{
+			Name:         provider.Name,
+			Issuer:       provider.Issuer,
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			RedirectURL:  provider.RedirectURL,
+			Scopes:       provider.Scopes,
+		})
+	}
+	return providers
+}
+
+// corsMiddleware allows any origin without credentials, or the listed origins
+// with credentials so browser clients can use the cookie transport
+func corsMiddleware(origins []string) fiber.Handler {
+	if len(origins) == 0 {
+		return cors.New()
+	}
+	return cors.New(cors.Config{
+		AllowOrigins:     strings.Join(origins, ","),
+		AllowCredentials: true,
+	})
+}
@@ -0,0 +1,255 @@
+package test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// MockOIDCProvider is a local OpenID Connect provider for testing social
+// login. It serves discovery, JWKS and token endpoints; the browser step is
+// replaced by Authorize, which approves an authorization URL directly.
+type MockOIDCProvider struct {
+	Server       *httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	mu        sync.Mutex
+	key       *rsa.PrivateKey
+	kid       string
+	rotations int
+	codes     map[string]mockAuthorization
+}
+
+// mockAuthorization is an issued authorization code waiting to be redeemed
+type mockAuthorization struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	claims        map[string]interface{}
+}
+
+// NewMockOIDCProvider starts a mock provider that accepts the given client
+func NewMockOIDCProvider(clientID, clientSecret string) (*MockOIDCProvider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &MockOIDCProvider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		kid:          "mock-key",
+		codes:        make(map[string]mockAuthorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.handleDiscovery)
+	mux.HandleFunc("/jwks", p.handleJWKS)
+	mux.HandleFunc("/token", p.handleToken)
+	p.Server = httptest.NewServer(mux)
+
+	return p, nil
+}
+
+// Issuer returns the provider's issuer URL
+func (p *MockOIDCProvider) Issuer() string {
+	return p.Server.URL
+}
+
+// Close shuts the provider down
+func (p *MockOIDCProvider) Close() {
+	p.Server.Close()
+}
+
+// Authorize plays the user approving the login at an authorization URL
+// returned by the API. The claims (sub, email, email_verified, name, ...)
+// end up in the ID token. It returns the code and state that the provider
+// would pass to the redirect URL.
+func (p *MockOIDCProvider) Authorize(authorizationURL string, claims map[string]interface{}) (code, state string, err error) {
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := parsed.Query()
+
+	if query.Get("response_type") != "code" {
+		return "", "", fmt.Errorf("unsupported response_type %q", query.Get("response_type"))
+	}
+	if query.Get("client_id") != p.ClientID {
+		return "", "", fmt.Errorf("unknown client_id %q", query.Get("client_id"))
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		return "", "", fmt.Errorf("missing S256 code challenge")
+	}
+
+	idClaims := make(map[string]interface{}, len(claims)+1)
+	for name, value := range claims {
+		idClaims[name] = value
+	}
+	if nonce := query.Get("nonce"); nonce != "" {
+		idClaims["nonce"] = nonce
+	}
+
+	code = randomHex(16)
+	p.mu.Lock()
+	p.codes[code] = mockAuthorization{
+		clientID:      query.Get("client_id"),
+		redirectURI:   query.Get("redirect_uri"),
+		codeChallenge: query.Get("code_challenge"),
+		claims:        idClaims,
+	}
+	p.mu.Unlock()
+
+	return code, query.Get("state"), nil
+}
+
+// RotateKey replaces the signing key with a new one under a new key ID. The
+// JWKS endpoint only publishes the new key from then on.
+func (p *MockOIDCProvider) RotateKey() error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rotations++
+	p.key = key
+	p.kid = fmt.Sprintf("mock-key-%d", p.rotations+1)
+	return nil
+}
+
+// SignIDToken signs arbitrary ID token claims with the provider key, for
+// testing how invalid tokens are rejected
+func (p *MockOIDCProvider) SignIDToken(claims map[string]interface{}) (string, error) {
+	p.mu.Lock()
+	key, kid := p.key, p.kid
+	p.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims(claims))
+	token.Header["kid"] = kid
+	return token.SignedString(key)
+}
+
+func (p *MockOIDCProvider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.Issuer(),
+		"authorization_endpoint":                p.Issuer() + "/authorize",
+		"token_endpoint":                        p.Issuer() + "/token",
+		"jwks_uri":                              p.Issuer() + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *MockOIDCProvider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	key, kid := p.key, p.kid
+	p.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *MockOIDCProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != p.ClientID || clientSecret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	// Codes are single-use
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	authorization, found := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	if !found ||
+		authorization.clientID != clientID ||
+		authorization.redirectURI != r.PostForm.Get("redirect_uri") ||
+		authorization.codeChallenge != s256(r.PostForm.Get("code_verifier")) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss": p.Issuer(),
+		"aud": p.ClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+	}
+	for name, value := range authorization.claims {
+		claims[name] = value
+	}
+
+	idToken, err := p.SignIDToken(claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomHex(16),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+// s256 derives a PKCE S256 code challenge
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	return hex.EncodeToString(randomBytes(n))
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
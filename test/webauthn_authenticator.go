@@ -0,0 +1,253 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// SoftAuthenticator is a software WebAuthn authenticator for testing
+// passkeys. It creates ES256 discoverable credentials and answers the
+// options returned by the register/begin and login/begin endpoints with
+// the JSON a browser would post to the matching finish endpoints.
+type SoftAuthenticator struct {
+	// Origin is reported in the client data; change it to simulate a phishing site
+	Origin string
+	// FakeRPID, when set, is the RP ID the authenticator data is scoped to
+	// instead of the requested one, to simulate a passkey of another site
+	FakeRPID string
+	// SkipUserVerification clears the UV flag, as an authenticator that only
+	// checked user presence would
+	SkipUserVerification bool
+
+	credentials []*softCredential
+}
+
+// softCredential is a passkey held by the authenticator
+type softCredential struct {
+	id         []byte
+	rpID       string
+	userHandle string
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+// webauthnOptions is the subset of creation and request options the authenticator reads
+type webauthnOptions struct {
+	Challenge string `json:"challenge"`
+	RPID      string `json:"rpId"`
+	RP        struct {
+		ID string `json:"id"`
+	} `json:"rp"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	PubKeyCredParams []struct {
+		Alg int64 `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	ExcludeCredentials []struct {
+		ID string `json:"id"`
+	} `json:"excludeCredentials"`
+	AllowCredentials []struct {
+		ID string `json:"id"`
+	} `json:"allowCredentials"`
+}
+
+// NewSoftAuthenticator creates an authenticator used from the given origin
+func NewSoftAuthenticator(origin string) *SoftAuthenticator {
+	return &SoftAuthenticator{Origin: origin}
+}
+
+// Clone returns an authenticator holding copies of the same passkeys,
+// including their signature counters, to simulate a cloned authenticator
+func (a *SoftAuthenticator) Clone() *SoftAuthenticator {
+	clone := *a
+	clone.credentials = make([]*softCredential, len(a.credentials))
+	for i, credential := range a.credentials {
+		copied := *credential
+		clone.credentials[i] = &copied
+	}
+	return &clone
+}
+
+// Register creates a passkey from creation options (the "data" of the
+// register/begin response) and returns the credential to post to register/finish
+func (a *SoftAuthenticator) Register(optionsJSON []byte) (map[string]interface{}, error) {
+	var options webauthnOptions
+	if err := json.Unmarshal(optionsJSON, &options); err != nil {
+		return nil, err
+	}
+
+	supported := false
+	for _, param := range options.PubKeyCredParams {
+		supported = supported || param.Alg == -7
+	}
+	if !supported {
+		return nil, fmt.Errorf("ES256 is not offered")
+	}
+	for _, excluded := range options.ExcludeCredentials {
+		if a.find(options.RP.ID, excluded.ID) != nil {
+			return nil, fmt.Errorf("authenticator already holds an excluded credential")
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	credential := &softCredential{
+		id:         randomBytes(16),
+		rpID:       options.RP.ID,
+		userHandle: options.User.ID,
+		key:        key,
+	}
+
+	coseKey, err := cbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: padTo32(key.PublicKey.X.Bytes()),
+		-3: padTo32(key.PublicKey.Y.Bytes()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Attested credential data: AAGUID (all zero), credential ID length, ID, key
+	attested := make([]byte, 16, 18+len(credential.id)+len(coseKey))
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(credential.id)))
+	attested = append(attested, credential.id...)
+	attested = append(attested, coseKey...)
+
+	authData := a.authenticatorData(credential, 0x45, attested) // UP, UV, AT
+
+	attestation, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a.credentials = append(a.credentials, credential)
+
+	return map[string]interface{}{
+		"id":    encode(credential.id),
+		"rawId": encode(credential.id),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    encode(a.clientData("webauthn.create", options.Challenge)),
+			"attestationObject": encode(attestation),
+			"transports":        []string{"internal"},
+		},
+	}, nil
+}
+
+// Login signs request options (the "data" of the login/begin response) with
+// a passkey for the RP and returns the assertion to post to login/finish
+func (a *SoftAuthenticator) Login(optionsJSON []byte) (map[string]interface{}, error) {
+	var options webauthnOptions
+	if err := json.Unmarshal(optionsJSON, &options); err != nil {
+		return nil, err
+	}
+
+	var credential *softCredential
+	if len(options.AllowCredentials) == 0 {
+		credential = a.find(options.RPID, "")
+	}
+	for _, allowed := range options.AllowCredentials {
+		if credential = a.find(options.RPID, allowed.ID); credential != nil {
+			break
+		}
+	}
+	if credential == nil {
+		return nil, fmt.Errorf("no passkey for %q", options.RPID)
+	}
+
+	credential.signCount++
+	authData := a.authenticatorData(credential, 0x05, nil) // UP, UV
+	clientData := a.clientData("webauthn.get", options.Challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, credential.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"id":    encode(credential.id),
+		"rawId": encode(credential.id),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    encode(clientData),
+			"authenticatorData": encode(authData),
+			"signature":         encode(signature),
+			"userHandle":        credential.userHandle,
+		},
+	}, nil
+}
+
+// find returns a credential for the RP, optionally with the given base64url ID
+func (a *SoftAuthenticator) find(rpID, id string) *softCredential {
+	for _, credential := range a.credentials {
+		if credential.rpID == rpID && (id == "" || encode(credential.id) == id) {
+			return credential
+		}
+	}
+	return nil
+}
+
+// clientData builds the client data JSON a browser would produce
+func (a *SoftAuthenticator) clientData(ceremony, challenge string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+// authenticatorData builds authenticator data for a credential with its
+// current signature counter
+func (a *SoftAuthenticator) authenticatorData(c *softCredential, flags byte, attested []byte) []byte {
+	rpID := c.rpID
+	if a.FakeRPID != "" {
+		rpID = a.FakeRPID
+	}
+	if a.SkipUserVerification {
+		flags &^= 0x04
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, c.signCount)
+	return append(data, attested...)
+}
+
+func padTo32(b []byte) []byte {
+	padded := make([]byte, 32)
+	copy(padded[32-len(b):], b)
+	return padded
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}